@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package archive chunks archive containers along their structure. Chunking a
+// tar archive as a flat stream glues member headers to the neighbouring file
+// contents, so touching one member's mtime changes a chunk of payload too. The
+// chunkers here parse the container as it streams, cut at every member edge,
+// emit headers as their own small chunks and chunk each member's payload
+// independently with a regular Chunker. The output is still a plain boundary
+// stream: concatenating the chunks yields the original archive bytes.
+package archive
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+const blockSize = 512
+
+// maxMetadataSize bounds the PAX and GNU long-name records gathered into a
+// single header segment, as archive/tar does. A larger record ends the tar
+// structure: the rest of the stream is chunked as a flat stream.
+const maxMetadataSize = 1 << 20
+
+type tarState int
+
+const (
+	stateHeader  tarState = iota // expecting the next member header
+	statePayload                 // chunking a member payload
+	stateRaw                     // end of archive, or not a tar: chunk the rest as-is
+	stateDone
+)
+
+// TarChunker splits a tar stream into chunks that never cross a member edge.
+// Each member yields one header chunk (the padding of the previous payload,
+// any PAX or GNU long-name records, and the header block) followed by the
+// chunks of its payload, cut exactly as a Chunker would cut the member file on
+// its own. Payload padding goes with the next header, so a member's payload
+// chunks dedup against the same file stored outside the archive.
+//
+// From the first block that is not a valid header on, which normally is the
+// end-of-archive marker, the rest of the stream is chunked as a flat stream.
+// TarChunker therefore accepts any input, chunks a non-tar input exactly like
+// a Chunker would, and always reassembles to it.
+type TarChunker struct {
+	src     io.Reader
+	chunker *chunkers.Chunker
+	payload io.LimitedReader
+	state   tarState
+
+	header  []byte // pending header segment, emitted at most MaxSize at a time
+	padding int64  // padding owed by the current payload, read with the next header
+}
+
+// NewTarChunker returns a TarChunker reading a tar stream from reader and
+// chunking member payloads with the named algorithm and options.
+func NewTarChunker(algorithm string, reader io.Reader, opts *chunkers.ChunkerOpts) (*TarChunker, error) {
+	t := &TarChunker{src: reader}
+	chunker, err := chunkers.NewChunker(algorithm, &t.payload, opts)
+	if err != nil {
+		return nil, err
+	}
+	t.chunker = chunker
+	return t, nil
+}
+
+// Next returns the next chunk. It returns io.EOF, with no data, once the
+// stream is exhausted. As with Chunker.Next, the returned slice is only valid
+// until the next call.
+func (t *TarChunker) Next() ([]byte, error) {
+	for {
+		if len(t.header) != 0 {
+			n := min(len(t.header), t.chunker.MaxSize())
+			seg := t.header[:n]
+			t.header = t.header[n:]
+			return seg, nil
+		}
+
+		switch t.state {
+		case stateHeader:
+			if err := t.readHeader(); err != nil {
+				return nil, err
+			}
+
+		case statePayload, stateRaw:
+			chunk, err := t.chunker.Next()
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			if err == io.EOF {
+				if t.state == stateRaw {
+					t.state = stateDone
+				} else if t.payload.N != 0 {
+					return nil, io.ErrUnexpectedEOF
+				} else {
+					t.state = stateHeader
+				}
+			}
+			if len(chunk) != 0 {
+				return chunk, nil
+			}
+
+		case stateDone:
+			return nil, io.EOF
+		}
+	}
+}
+
+// readHeader gathers the next header segment into t.header and sets up the
+// chunker for what follows: the member payload, or the raw remainder.
+func (t *TarChunker) readHeader() error {
+	seg := make([]byte, 0, t.padding+blockSize)
+	var paxSize int64 = -1
+
+	if t.padding != 0 {
+		seg = seg[:t.padding]
+		if n, err := io.ReadFull(t.src, seg); err != nil {
+			return t.raw(seg[:n], err)
+		}
+		t.padding = 0
+	}
+
+	for {
+		start := len(seg)
+		seg = append(seg, make([]byte, blockSize)...)
+		block := seg[start:]
+		if n, err := io.ReadFull(t.src, block); err != nil {
+			return t.raw(seg[:start+n], err)
+		}
+		if !validHeader(block) {
+			// The end-of-archive zero block, or not a tar at all.
+			return t.raw(seg, nil)
+		}
+
+		size, ok := parseNumeric(block[124:136])
+		if !ok || size < 0 {
+			return t.raw(seg, nil)
+		}
+		typeflag := block[156]
+
+		switch typeflag {
+		case 'x', 'g', 'L', 'K':
+			// Metadata records describe the next header: keep them in the
+			// same segment.
+			if size > maxMetadataSize {
+				return t.raw(seg, nil)
+			}
+			start := len(seg)
+			seg = append(seg, make([]byte, padded(size))...)
+			if n, err := io.ReadFull(t.src, seg[start:]); err != nil {
+				return t.raw(seg[:start+n], err)
+			}
+			if typeflag == 'x' {
+				if s, ok := paxRecordSize(seg[start : start+int(size)]); ok {
+					paxSize = s
+				}
+			}
+			continue
+		case '1', '2', '3', '4', '5', '6':
+			// Header-only types carry no payload whatever their size says.
+			size = 0
+		}
+		if paxSize >= 0 {
+			size = paxSize
+		}
+
+		t.header = seg
+		t.padding = padded(size) - size
+		t.payload.R = t.src
+		t.payload.N = size
+		t.chunker.Reset(&t.payload)
+		t.state = statePayload
+		return nil
+	}
+}
+
+// raw chunks seg and everything after it as a flat stream. A read error other
+// than EOF is reported; EOF just ends the stream.
+func (t *TarChunker) raw(seg []byte, err error) error {
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	t.padding = 0
+	t.payload.R = io.MultiReader(bytes.NewReader(seg), t.src)
+	t.payload.N = 1<<63 - 1
+	t.chunker.Reset(&t.payload)
+	t.state = stateRaw
+	return nil
+}
+
+// Copy writes every chunk to dst, like Chunker.Copy.
+func (t *TarChunker) Copy(dst io.Writer) (int64, error) {
+	nbytes := int64(0)
+	for {
+		chunk, err := t.Next()
+		if err == io.EOF {
+			return nbytes, io.EOF
+		}
+		if err != nil {
+			return nbytes, err
+		}
+		if _, werr := dst.Write(chunk); werr != nil {
+			return nbytes, werr
+		}
+		nbytes += int64(len(chunk))
+	}
+}
+
+// Split calls callback for every chunk with its offset in the archive, like
+// Chunker.Split.
+func (t *TarChunker) Split(callback func(offset, length uint, chunk []byte) error) error {
+	offset := uint(0)
+	for {
+		chunk, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := callback(offset, uint(len(chunk)), chunk); err != nil {
+			return err
+		}
+		offset += uint(len(chunk))
+	}
+}
+
+func padded(size int64) int64 {
+	return (size + blockSize - 1) &^ (blockSize - 1)
+}
+
+// validHeader reports whether block is a tar header with a valid checksum.
+// Both the unsigned and the historical signed sums are accepted.
+func validHeader(block []byte) bool {
+	want, ok := parseNumeric(block[148:156])
+	if !ok {
+		return false
+	}
+	var unsigned, signed int64
+	for i, c := range block {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		unsigned += int64(c)
+		signed += int64(int8(c))
+	}
+	return want == unsigned || want == signed
+}
+
+// parseNumeric parses an octal header field, or the GNU base-256 encoding
+// used for values that do not fit.
+func parseNumeric(field []byte) (int64, bool) {
+	if len(field) != 0 && field[0]&0x80 != 0 {
+		if field[0]&0x40 != 0 {
+			return 0, false // negative
+		}
+		v := int64(field[0] & 0x3f)
+		for _, c := range field[1:] {
+			if v > (1<<63-1)>>8 {
+				return 0, false
+			}
+			v = v<<8 | int64(c)
+		}
+		return v, true
+	}
+	s := string(bytes.Trim(field, " \x00"))
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseInt(s, 8, 64)
+	return v, err == nil
+}
+
+// paxRecordSize extracts the size override from PAX extended records, each
+// formatted as "%d %s=%s\n".
+func paxRecordSize(records []byte) (int64, bool) {
+	for len(records) != 0 {
+		sp := bytes.IndexByte(records, ' ')
+		if sp <= 0 {
+			return 0, false
+		}
+		n, err := strconv.Atoi(string(records[:sp]))
+		if err != nil || n <= sp || n > len(records) {
+			return 0, false
+		}
+		record := records[sp+1 : n]
+		records = records[n:]
+		if k, v, ok := bytes.Cut(bytes.TrimSuffix(record, []byte("\n")), []byte("=")); ok && string(k) == "size" {
+			size, err := strconv.ParseInt(string(v), 10, 64)
+			return size, err == nil && size >= 0
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+)
+
+const algo = "fastcdc-v1.0.0"
+
+type member struct {
+	name string
+	data []byte
+}
+
+func testMembers() []member {
+	r := rand.New(rand.NewSource(1))
+	var members []member
+	for i, size := range []int{0, 1, 511, 512, 4000, 100 * 1024, 300 * 1024} {
+		data := make([]byte, size)
+		r.Read(data)
+		name := "file" + strings.Repeat("x", i)
+		if i == 3 {
+			// Forces a long-name record in front of the header.
+			name = strings.Repeat("long/", 40) + "name"
+		}
+		members = append(members, member{name: name, data: data})
+	}
+	return members
+}
+
+func makeTar(t *testing.T, members []member, mtime time.Time, format tar.Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.data)), ModTime: mtime, Format: format}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(m.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime, Format: format}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func collect(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	tc, err := NewTarChunker(algo, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	err = tc.Split(func(offset, length uint, chunk []byte) error {
+		if length == 0 || length > 64*1024 {
+			t.Fatalf("chunk at %d has length %d", offset, length)
+		}
+		chunks = append(chunks, append([]byte(nil), chunk...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	return chunks
+}
+
+func digests(chunks [][]byte) map[[32]byte]struct{} {
+	set := make(map[[32]byte]struct{})
+	for _, c := range chunks {
+		set[sha256.Sum256(c)] = struct{}{}
+	}
+	return set
+}
+
+func plainChunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	c, err := chunkers.NewChunker(algo, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if len(chunk) != 0 {
+			chunks = append(chunks, append([]byte(nil), chunk...))
+		}
+		if err == io.EOF {
+			return chunks
+		}
+	}
+}
+
+// TestTarReassembles checks the chunk stream concatenates back to the archive
+// for the tar formats archive/tar can produce.
+func TestTarReassembles(t *testing.T) {
+	for _, format := range []tar.Format{tar.FormatUSTAR, tar.FormatPAX, tar.FormatGNU} {
+		members := testMembers()
+		if format == tar.FormatUSTAR {
+			members[3].name = "short"
+		}
+		data := makeTar(t, members, time.Unix(1700000000, 0), format)
+		if got := bytes.Join(collect(t, data), nil); !bytes.Equal(got, data) {
+			t.Fatalf("%s: reassembled %d bytes, want %d", format, len(got), len(data))
+		}
+	}
+}
+
+// TestTarPayloadChunks checks each member's payload is chunked exactly as the
+// file on its own, so it dedups against copies stored outside the archive.
+func TestTarPayloadChunks(t *testing.T) {
+	members := testMembers()
+	set := digests(collect(t, makeTar(t, members, time.Unix(1700000000, 0), tar.FormatPAX)))
+	for _, m := range members {
+		for _, c := range plainChunks(t, m.data) {
+			if _, ok := set[sha256.Sum256(c)]; !ok {
+				t.Fatalf("%s: payload chunk of %d bytes missing from the archive chunks", m.name, len(c))
+			}
+		}
+	}
+}
+
+// TestTarMetadataChange checks touching every mtime only changes header
+// chunks: all payload chunks still dedup.
+func TestTarMetadataChange(t *testing.T) {
+	members := testMembers()
+	a := collect(t, makeTar(t, members, time.Unix(1700000000, 0), tar.FormatGNU))
+	b := collect(t, makeTar(t, members, time.Unix(1800000000, 0), tar.FormatGNU))
+
+	seen := digests(a)
+	var changed int
+	for _, c := range b {
+		if _, ok := seen[sha256.Sum256(c)]; !ok {
+			changed += len(c)
+		}
+	}
+	// One header segment per member plus the directory entry, each at most
+	// padding + long-name record + header.
+	if limit := (len(members) + 1) * 4 * blockSize; changed > limit {
+		t.Fatalf("%d bytes changed after an mtime update, want <= %d", changed, limit)
+	}
+}
+
+// TestTarNotAnArchive checks a non-tar input is chunked like a flat stream.
+func TestTarNotAnArchive(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	got, want := collect(t, data), plainChunks(t, data)
+	if len(got) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("chunk %d differs from a plain chunker", i)
+		}
+	}
+	if len(collect(t, nil)) != 0 {
+		t.Fatal("empty input produced chunks")
+	}
+}
+
+func TestTarTruncated(t *testing.T) {
+	data := makeTar(t, testMembers(), time.Unix(1700000000, 0), tar.FormatPAX)
+	// Cut inside the 300 KiB payload of the last member.
+	truncated := data[:len(data)-200*1024]
+	tc, _ := NewTarChunker(algo, bytes.NewReader(truncated), nil)
+	if err := tc.Split(func(_, _ uint, _ []byte) error { return nil }); err != io.ErrUnexpectedEOF {
+		t.Fatalf("want io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+// TestTarLargeMetadata checks a metadata record above maxMetadataSize does
+// not fail the stream: the rest is chunked flat and still reassembles.
+func TestTarLargeMetadata(t *testing.T) {
+	records := []member{{name: "pax", data: bytes.Repeat([]byte("x"), 2*maxMetadataSize)}, {name: "file", data: []byte("data")}}
+	data := makeTar(t, records, time.Unix(1700000000, 0), tar.FormatUSTAR)
+	// Turn the first member into a PAX record, archive/tar refusing to
+	// write one that large.
+	data[156] = 'x'
+	var sum int64
+	for i, c := range data[:blockSize] {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	copy(data[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	if !validHeader(data[:blockSize]) {
+		t.Fatal("patched header does not validate")
+	}
+	if got := bytes.Join(collect(t, data), nil); !bytes.Equal(got, data) {
+		t.Fatalf("reassembled %d bytes, want %d", len(got), len(data))
+	}
+}
@@ -19,6 +19,7 @@ package chunkers
 import (
 	"errors"
 	"io"
+	"sort"
 )
 
 type ChunkerOpts struct {
@@ -42,6 +43,17 @@ type Chunker struct {
 
 	cutpoint int
 	isFirst  bool
+
+	// offset is the stream offset of the current window, only needed to
+	// place boundary hints.
+	offset     uint64
+	hints      BoundaryHints
+	nextHint   uint64
+	hasHint    bool
+	mergeHints bool
+
+	// trace, when set, is told the reason of every cut point.
+	trace func(Cut)
 }
 
 func (c *Chunker) MinSize() int {
@@ -66,35 +78,79 @@ func Register(name string, implementation func() ChunkerImplementation) error {
 	return nil
 }
 
-// ErrBufferTooSmall is returned by NewChunkerBuffer when the supplied buffer
-// is smaller than the minimum the chunker needs (MaxSize bytes).
-var ErrBufferTooSmall = errors.New("buffer must be at least MaxSize bytes")
+// Algorithms returns the names of the registered algorithms, sorted, so that
+// tools can cover every algorithm linked in rather than a list of their own.
+func Algorithms() []string {
+	names := make([]string, 0, len(chunkers))
+	for name := range chunkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-func newChunker(algorithm string, opts *ChunkerOpts) (*Chunker, error) {
+// NewImplementation allocates a fresh instance of the named algorithm, for
+// tools and tests that drive its methods directly rather than through a
+// Chunker.
+func NewImplementation(algorithm string) (ChunkerImplementation, error) {
 	implementationAllocator, exists := chunkers[algorithm]
 	if !exists {
 		return nil, errors.New("unknown algorithm")
 	}
+	return implementationAllocator(), nil
+}
+
+// ValidateOptions reports whether the named algorithm accepts opts, as its
+// Validate method judges them, zero sizes taking their defaults as in
+// NewChunker. NewChunker only requires Setup to succeed, which most
+// implementations keep permissive: an unkeyed keyed algorithm or a
+// NormalSize that is not a power of two go through it unnoticed.
+func ValidateOptions(algorithm string, opts *ChunkerOpts) error {
+	implementation, err := NewImplementation(algorithm)
+	if err != nil {
+		return err
+	}
+	defaults := implementation.DefaultOptions()
+	o := *defaults
+	if opts != nil {
+		o = *opts
+		fillDefaults(&o, defaults)
+	}
+	return implementation.Validate(&o)
+}
 
+// fillDefaults sets the zero sizes of opts to those of defaults.
+func fillDefaults(opts, defaults *ChunkerOpts) {
+	if opts.MinSize == 0 {
+		opts.MinSize = defaults.MinSize
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = defaults.MaxSize
+	}
+	if opts.NormalSize == 0 {
+		opts.NormalSize = defaults.NormalSize
+	}
+}
+
+// ErrBufferTooSmall is returned by NewChunkerBuffer when the supplied buffer
+// is smaller than the minimum the chunker needs (MaxSize bytes).
+var ErrBufferTooSmall = errors.New("buffer must be at least MaxSize bytes")
+
+func newChunker(algorithm string, opts *ChunkerOpts) (*Chunker, error) {
 	// Allocate the implementation once and read its defaults from the same
 	// instance; a second throwaway allocation here would be wasteful since
 	// some implementations carry a sizeable table (e.g. FastCDC's 256-entry
 	// Gear array).
-	implementation := implementationAllocator()
+	implementation, err := NewImplementation(algorithm)
+	if err != nil {
+		return nil, err
+	}
 	defaultOpts := implementation.DefaultOptions()
 
 	if opts == nil {
 		opts = defaultOpts
 	} else {
-		if opts.MinSize == 0 {
-			opts.MinSize = defaultOpts.MinSize
-		}
-		if opts.MaxSize == 0 {
-			opts.MaxSize = defaultOpts.MaxSize
-		}
-		if opts.NormalSize == 0 {
-			opts.NormalSize = defaultOpts.NormalSize
-		}
+		fillDefaults(opts, defaultOpts)
 	}
 
 	chunker := &Chunker{}
@@ -151,15 +207,51 @@ func NewChunkerBuffer(algorithm string, reader io.Reader, opts *ChunkerOpts, buf
 	return chunker, nil
 }
 
+// Reset rewinds the chunker onto a new stream, reusing its scan buffer.
+// Boundary hints refer to the previous stream and are dropped.
 func (chunker *Chunker) Reset(reader io.Reader) {
 	chunker.cutpoint = 0
 	chunker.isFirst = true
 	chunker.rd.reset(reader, chunker.rd.buf)
+	chunker.offset = 0
+	chunker.hints = nil
+	chunker.hasHint = false
+}
+
+// SetBoundaryHints forces cut points at the stream offsets supplied by hints:
+// Next never returns a chunk crossing a hint, and content-defined chunking
+// starts afresh after each one, exactly as if the stream began there. Hints at
+// or behind the current position are ignored. Hints typically mark natural
+// boundaries the caller knows about, such as file edges in a pack or record
+// boundaries in a log.
+//
+// A hint close after a cut point yields a chunk shorter than MinSize. With
+// mergeSmall set, such a piece is instead merged with the chunk that follows
+// the hint, as long as MaxSize allows; the hint is then not a cut point, but
+// the chunker still resumes afresh from it.
+//
+// It must be called before the first call to Next, or after Reset.
+func (chunker *Chunker) SetBoundaryHints(hints BoundaryHints, mergeSmall bool) {
+	chunker.hints = hints
+	chunker.hasHint = false
+	chunker.mergeHints = mergeSmall
+	if hints != nil {
+		chunker.nextHint, chunker.hasHint = hints.Next()
+	}
+}
+
+// hintAfter returns the first hint strictly after offset.
+func (chunker *Chunker) hintAfter(offset uint64) (uint64, bool) {
+	for chunker.hasHint && chunker.nextHint <= offset {
+		chunker.nextHint, chunker.hasHint = chunker.hints.Next()
+	}
+	return chunker.nextHint, chunker.hasHint
 }
 
 func (chunker *Chunker) Next() ([]byte, error) {
 	if chunker.cutpoint != 0 {
 		chunker.rd.discard(chunker.cutpoint)
+		chunker.offset += uint64(chunker.cutpoint)
 		chunker.cutpoint = 0
 	}
 
@@ -179,7 +271,11 @@ func (chunker *Chunker) Next() ([]byte, error) {
 		return nil, io.EOF
 	}
 
-	cutpoint := chunker.implementation.Algorithm(chunker.options, data, n)
+	if chunker.hasHint {
+		return chunker.nextHinted(data)
+	}
+
+	cutpoint := chunker.algorithm(data, n, 0, false)
 	chunker.cutpoint = cutpoint
 
 	if cutpoint < chunker.options.MinSize {
@@ -189,6 +285,37 @@ func (chunker *Chunker) Next() ([]byte, error) {
 	return data[:cutpoint], nil
 }
 
+// nextHinted is Next for a window that may contain boundary hints. The
+// algorithm only ever sees the bytes up to the next hint, and starts over
+// after it.
+func (chunker *Chunker) nextHinted(data []byte) ([]byte, error) {
+	n := len(data)
+	base, end := 0, n
+	atHint := false
+	for {
+		end, atHint = n, false
+		if h, ok := chunker.hintAfter(chunker.offset + uint64(base)); ok && h-chunker.offset < uint64(n) {
+			end, atHint = int(h-chunker.offset), true
+		}
+		if !atHint || !chunker.mergeHints || end >= chunker.options.MinSize {
+			break
+		}
+		// The piece up to this hint is too small to stand on its own:
+		// carry it into the chunk starting at the hint.
+		base = end
+	}
+
+	cutpoint := base + chunker.algorithm(data[base:end], end-base, base, atHint)
+	chunker.cutpoint = cutpoint
+
+	// A short chunk normally means the stream is exhausted, unless a hint
+	// cut it short with more data behind it.
+	if cutpoint < chunker.options.MinSize && !(atHint && cutpoint == end) {
+		return data[:cutpoint], io.EOF
+	}
+	return data[:cutpoint], nil
+}
+
 func (chunker *Chunker) Copy(dst io.Writer) (int64, error) {
 	nbytes := int64(0)
 	for {
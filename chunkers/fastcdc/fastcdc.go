@@ -223,12 +223,28 @@ func (c *FastCDC) Validate(options *chunkers.ChunkerOpts) error {
 }
 
 func (c *FastCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
+	return c.algorithm(options, data, n, nil)
+}
+
+// AlgorithmTrace is Algorithm, also reporting which mask matched and the
+// fingerprint at the cut.
+func (c *FastCDC) AlgorithmTrace(options *chunkers.ChunkerOpts, data []byte, n int) (int, chunkers.Cut) {
+	var cut chunkers.Cut
+	return c.algorithm(options, data, n, &cut), cut
+}
+
+// algorithm is Algorithm, filling cut, when it is not nil, with why it cut
+// where it did.
+func (c *FastCDC) algorithm(options *chunkers.ChunkerOpts, data []byte, n int, cut *chunkers.Cut) int {
 	MinSize := options.MinSize
 	MaxSize := options.MaxSize
 	NormalSize := options.NormalSize
 
 	switch {
 	case n <= MinSize:
+		if cut != nil {
+			cut.Reason = chunkers.CutMaxSize
+		}
 		return n
 	case n >= MaxSize:
 		n = MaxSize
@@ -246,8 +262,17 @@ func (c *FastCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) i
 		}
 		fp = (fp << 1) + c.G[data[i]]
 		if (fp & mask) == 0 {
+			if cut != nil {
+				cut.Reason, cut.Fingerprint = chunkers.CutMaskS, fp
+				if i >= NormalSize {
+					cut.Reason = chunkers.CutMaskL
+				}
+			}
 			return i
 		}
 	}
+	if cut != nil {
+		cut.Reason, cut.Fingerprint = chunkers.CutMaxSize, fp
+	}
 	return i
 }
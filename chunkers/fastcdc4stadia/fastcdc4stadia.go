@@ -75,6 +75,20 @@ func (c *FastCDC4Stadia) Validate(options *chunkers.ChunkerOpts) error {
 // [2] https://github.com/dbaarda/rollsum-chunking/blob/master/RESULTS.rst
 // [3] https://www.usenix.org/system/files/conference/atc12/atc12-final293.pdf
 func (c *FastCDC4Stadia) Algorithm(options *chunkers.ChunkerOpts, data []byte, N int) int {
+	return c.algorithm(options, data, N, nil)
+}
+
+// AlgorithmTrace is Algorithm, also reporting whether the cut came from a
+// fingerprint under the threshold or from a regression point, and the
+// fingerprint at the cut.
+func (c *FastCDC4Stadia) AlgorithmTrace(options *chunkers.ChunkerOpts, data []byte, N int) (int, chunkers.Cut) {
+	var cut chunkers.Cut
+	return c.algorithm(options, data, N, &cut), cut
+}
+
+// algorithm is Algorithm, filling cut, when it is not nil, with why it cut
+// where it did.
+func (c *FastCDC4Stadia) algorithm(options *chunkers.ChunkerOpts, data []byte, N int, cut *chunkers.Cut) int {
 
 	// A common case will be n == len(data), but n could certainly be less.
 	// Confirm that it is never more.
@@ -102,6 +116,9 @@ func (c *FastCDC4Stadia) Algorithm(options *chunkers.ChunkerOpts, data []byte, N
 
 	switch {
 	case n <= minSize:
+		if cut != nil {
+			cut.Reason = chunkers.CutMaxSize
+		}
 		return int(n)
 	case n >= maxSize:
 		n = maxSize
@@ -109,6 +126,7 @@ func (c *FastCDC4Stadia) Algorithm(options *chunkers.ChunkerOpts, data []byte, N
 
 	regressionLen := n
 	var regressionMask uint64 // == 0 => match anything
+	var regressionHash uint64
 
 	// "Init hash to all 1's to avoid zero-length chunks with min_size=0."
 	var hash uint64 = math.MaxUint64
@@ -129,10 +147,14 @@ func (c *FastCDC4Stadia) Algorithm(options *chunkers.ChunkerOpts, data []byte, N
 		if hash&regressionMask == 0 {
 
 			if hash <= thresh {
+				if cut != nil {
+					cut.Reason, cut.Fingerprint = chunkers.CutMask, hash
+				}
 				return int(i)
 			}
 
 			regressionLen = i
+			regressionHash = hash
 			regressionMask = math.MaxUint64
 
 			for hash&regressionMask != 0 {
@@ -143,8 +165,14 @@ func (c *FastCDC4Stadia) Algorithm(options *chunkers.ChunkerOpts, data []byte, N
 	}
 	// "Return best regression point we found or the end if it's better."
 	if hash&regressionMask != 0 {
+		if cut != nil {
+			cut.Reason, cut.Fingerprint = chunkers.CutRegression, regressionHash
+		}
 		return int(regressionLen)
 	}
+	if cut != nil {
+		cut.Reason, cut.Fingerprint = chunkers.CutMaxSize, hash
+	}
 	return int(i)
 }
 
@@ -203,6 +203,19 @@ func (c *JC) Validate(options *chunkers.ChunkerOpts) error {
 }
 
 func (c *JC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
+	return c.algorithm(options, data, n, nil)
+}
+
+// AlgorithmTrace is Algorithm, also reporting the fingerprint at the cut and
+// the jumps taken to get there.
+func (c *JC) AlgorithmTrace(options *chunkers.ChunkerOpts, data []byte, n int) (int, chunkers.Cut) {
+	var cut chunkers.Cut
+	return c.algorithm(options, data, n, &cut), cut
+}
+
+// algorithm is Algorithm, filling cut, when it is not nil, with why it cut
+// where it did.
+func (c *JC) algorithm(options *chunkers.ChunkerOpts, data []byte, n int, cut *chunkers.Cut) int {
 	MinSize := options.MinSize
 	MaxSize := options.MaxSize
 	NormalSize := options.NormalSize
@@ -220,6 +233,9 @@ func (c *JC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
 		// Legacy behaviour: return a final sub-NormalSize segment whole
 		// without scanning it. Diverges from the paper; kept for boundary
 		// compatibility with existing "jc"/"jc-v1.0.0" chunk stores.
+		if cut != nil {
+			cut.Reason = chunkers.CutMaxSize
+		}
 		return n
 	case n >= MaxSize:
 		n = MaxSize
@@ -227,18 +243,26 @@ func (c *JC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
 
 	fp := uint64(0)
 	i := MinSize
+	jumps := 0
 
 	for i < n {
 		fp = (fp << 1) + c.G[data[i]]
 		if (fp & c.maskJ) == 0 {
 			if (fp & c.maskC) == 0 {
+				if cut != nil {
+					*cut = chunkers.Cut{Reason: chunkers.CutMask, Fingerprint: fp, Jumps: jumps}
+				}
 				return i
 			}
 			fp = 0
 			i = i + c.jumpLength
+			jumps++
 		} else {
 			i++
 		}
 	}
+	if cut != nil {
+		*cut = chunkers.Cut{Reason: chunkers.CutMaxSize, Fingerprint: fp, Jumps: jumps}
+	}
 	return min(i, n)
 }
@@ -99,6 +99,19 @@ func (c *UltraCDC) Validate(options *chunkers.ChunkerOpts) error {
 //
 // POST INVARIANT: cutpoint <= n. We never return a cutpoint > n.
 func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) (cutpoint int) {
+	return c.algorithm(options, data, n, nil)
+}
+
+// AlgorithmTrace is Algorithm, also reporting which mask matched, or whether
+// the low-entropy threshold was hit, and the Hamming distance at the cut.
+func (c *UltraCDC) AlgorithmTrace(options *chunkers.ChunkerOpts, data []byte, n int) (int, chunkers.Cut) {
+	var cut chunkers.Cut
+	return c.algorithm(options, data, n, &cut), cut
+}
+
+// algorithm is Algorithm, filling cut, when it is not nil, with why it cut
+// where it did.
+func (c *UltraCDC) algorithm(options *chunkers.ChunkerOpts, data []byte, n int, cut *chunkers.Cut) (cutpoint int) {
 
 	// A common case will be n == len(data), but n could certainly be less.
 	// Confirm that it is never more.
@@ -127,6 +140,9 @@ func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int)
 
 	switch {
 	case n <= minSize:
+		if cut != nil {
+			cut.Reason = chunkers.CutMaxSize
+		}
 		cutpoint = n
 		return
 	case n >= maxSize:
@@ -142,6 +158,9 @@ func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int)
 	// Returning here also avoids slicing data[minSize:minSize+8] out of range
 	// when the caller passes a tightly-sized buffer (n == len(data)).
 	if n < minSize+8 {
+		if cut != nil {
+			cut.Reason = chunkers.CutMaxSize
+		}
 		cutpoint = n
 		return
 	}
@@ -189,6 +208,9 @@ func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int)
 
 				// If i == n-8, its largest, then this returns n,
 				// which maintains our POST INVARIANT that cutpoint <= n.
+				if cut != nil {
+					cut.Reason, cut.Fingerprint = chunkers.CutLowEntropy, uint64(dist)
+				}
 				cutpoint = i + 8
 				return
 			}
@@ -204,6 +226,12 @@ func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int)
 				// the precise matching byte i+j. Both preserve the POST
 				// INVARIANT cutpoint <= n: the loop guarantees i <= n-8, so
 				// i+8 <= n, and i+j <= n-8+7 == n-1.
+				if cut != nil {
+					cut.Reason, cut.Fingerprint = chunkers.CutMaskS, uint64(dist)
+					if mask == maskL {
+						cut.Reason = chunkers.CutMaskL
+					}
+				}
 				if c.specFaithful {
 					cutpoint = i + 8
 				} else {
@@ -235,6 +263,9 @@ func (c *UltraCDC) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int)
 	}
 
 	// obviously preserves the POST INVARIANT that cutpoint <= n.
+	if cut != nil {
+		cut.Reason, cut.Fingerprint = chunkers.CutMaxSize, uint64(dist)
+	}
 	cutpoint = n
 	return
 }
@@ -54,6 +54,42 @@ func TestRegister_Duplicate(t *testing.T) {
 	}
 }
 
+func TestAlgorithms(t *testing.T) {
+	names := Algorithms()
+	found := false
+	for i, name := range names {
+		if i > 0 && names[i-1] >= name {
+			t.Fatalf("names not sorted: %q before %q", names[i-1], name)
+		}
+		found = found || name == "testimpl"
+	}
+	if !found {
+		t.Fatalf("testimpl missing from %v", names)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	if err := ValidateOptions("testimpl", nil); err != nil {
+		t.Fatalf("defaults refused: %v", err)
+	}
+	if err := ValidateOptions("nope-algo", nil); err == nil {
+		t.Fatal("unknown algorithm validated")
+	}
+}
+
+func TestNewImplementation(t *testing.T) {
+	impl, err := NewImplementation("testimpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impl.DefaultOptions().NormalSize != 16 {
+		t.Fatalf("got %T", impl)
+	}
+	if _, err := NewImplementation("nope-algo"); err == nil {
+		t.Fatal("unknown algorithm allocated")
+	}
+}
+
 func TestNewChunker_UnknownAlgorithm(t *testing.T) {
 	_, err := NewChunker("nope-algo", bytes.NewReader(nil), nil)
 	if err == nil {
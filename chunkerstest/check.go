@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package chunkerstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// sources are the misbehaving readers Check chunks through. Each delivers
+// all of its input in the end, so the chunks must not change.
+var sources = []struct {
+	name string
+	wrap func(io.Reader) io.Reader
+}{
+	{"short reads", func(r io.Reader) io.Reader { return ShortReader(r, 4093) }},
+	{"one-byte reads", OneByteReader},
+	{"empty reads", func(r io.Reader) io.Reader { return EmptyReadsReader(ShortReader(r, 1021), 50) }},
+	{"data with io.EOF", DataErrReader},
+}
+
+// run chunks ch to the end and returns the chunk lengths. It fails t if a
+// chunk is not the bytes of data at its offset.
+func run(t testing.TB, what string, ch *chunkers.Chunker, data []byte) ([]int, error) {
+	t.Helper()
+	var lengths []int
+	off := 0
+	for {
+		chunk, err := ch.Next()
+		if err != nil && err != io.EOF {
+			return lengths, err
+		}
+		if len(chunk) != 0 {
+			if len(chunk) > len(data)-off || !bytes.Equal(chunk, data[off:off+len(chunk)]) {
+				t.Fatalf("%s: chunk %d at offset %d, %d bytes, is not the input", what, len(lengths), off, len(chunk))
+			}
+			lengths = append(lengths, len(chunk))
+			off += len(chunk)
+		}
+		if err == io.EOF {
+			return lengths, nil
+		}
+	}
+}
+
+// Check chunks data with the named algorithm and opts, which it does not
+// modify, and fails t on every breach of the contract of the Chunker:
+//
+//   - the chunks are the input, in order and whole;
+//   - every chunk holds at most MaxSize bytes, and at least MinSize but for
+//     the last;
+//   - short reads, one-byte reads, runs of empty reads and data returned
+//     along with io.EOF leave the chunks unchanged, as do a scan buffer of
+//     exactly MaxSize and a Reset onto the same input;
+//   - a read error, or a source that stalls until its context is cancelled,
+//     fails Next with that error after a prefix of the chunks, and Next keeps
+//     failing; a source that keeps returning nothing fails it with
+//     io.ErrNoProgress.
+//
+// The data should span many chunks; a few times MaxSize of random bytes and
+// of something repetitive are both worth checking.
+func Check(t testing.TB, algorithm string, opts *chunkers.ChunkerOpts, data []byte) {
+	t.Helper()
+	newChunker := func(rd io.Reader, buf []byte) *chunkers.Chunker {
+		t.Helper()
+		var o *chunkers.ChunkerOpts
+		if opts != nil {
+			c := *opts
+			o = &c
+		}
+		var ch *chunkers.Chunker
+		var err error
+		if buf != nil {
+			ch, err = chunkers.NewChunkerBuffer(algorithm, rd, o, buf)
+		} else {
+			ch, err = chunkers.NewChunker(algorithm, rd, o)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		return ch
+	}
+
+	ch := newChunker(bytes.NewReader(data), nil)
+	minSize, maxSize := ch.MinSize(), ch.MaxSize()
+	want, err := run(t, algorithm, ch, data)
+	if err != nil {
+		t.Fatalf("%s: %v", algorithm, err)
+	}
+	if total := sum(want); total != len(data) {
+		t.Fatalf("%s: chunks cover %d bytes of %d", algorithm, total, len(data))
+	}
+	for i, l := range want {
+		if l > maxSize || (l < minSize && i != len(want)-1) {
+			t.Errorf("%s: chunk %d of %d has %d bytes, outside %d-%d", algorithm, i, len(want), l, minSize, maxSize)
+		}
+	}
+
+	same := func(what string, ch *chunkers.Chunker) {
+		t.Helper()
+		got, err := run(t, what, ch, data)
+		if err != nil {
+			t.Errorf("%s: %v", what, err)
+		} else if !slices.Equal(got, want) {
+			t.Errorf("%s: %d chunks, %d with a plain reader, first differing at %d",
+				what, len(got), len(want), firstDiff(got, want))
+		}
+	}
+	for _, src := range sources {
+		same(algorithm+", "+src.name, newChunker(src.wrap(bytes.NewReader(data)), nil))
+	}
+	ch = newChunker(bytes.NewReader(data), make([]byte, maxSize))
+	same(algorithm+", buffer of MaxSize", ch)
+	ch.Reset(bytes.NewReader(data))
+	same(algorithm+", after Reset", ch)
+
+	fails := func(what string, rd io.Reader, target error) {
+		t.Helper()
+		ch := newChunker(rd, nil)
+		got, err := run(t, what, ch, data)
+		switch {
+		case !errors.Is(err, target):
+			t.Errorf("%s: Next failed with %v, want %v", what, err, target)
+		case len(got) > len(want) || !slices.Equal(got, want[:len(got)]):
+			t.Errorf("%s: chunks before the failure are not a prefix of the chunks", what)
+		default:
+			if _, err := ch.Next(); !errors.Is(err, target) {
+				t.Errorf("%s: Next after the failure returned %v", what, err)
+			}
+		}
+	}
+	if len(data) > 0 {
+		half := int64(len(data) / 2)
+		fails(algorithm+", read error", FailAfterReader(bytes.NewReader(data), half, nil), ErrInjected)
+		fails(algorithm+", read error with data", DataErrReader(FailAfterReader(bytes.NewReader(data), half, nil)), ErrInjected)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := time.AfterFunc(time.Millisecond, cancel)
+		fails(algorithm+", stalled source", StallReader(ctx, bytes.NewReader(data), half), context.Canceled)
+		stop.Stop()
+		cancel()
+	}
+	fails(algorithm+", no progress", EmptyReadsReader(bytes.NewReader(data), 100), io.ErrNoProgress)
+}
+
+func sum(s []int) int {
+	n := 0
+	for _, v := range s {
+		n += v
+	}
+	return n
+}
+
+func firstDiff(a, b []int) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,165 @@
+package chunkerstest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fixed"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/chunkerstest"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
+)
+
+func TestReaders(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 10000, 1)
+	for name, rd := range map[string]io.Reader{
+		"short":       chunkerstest.ShortReader(bytes.NewReader(data), 7),
+		"one-byte":    chunkerstest.OneByteReader(bytes.NewReader(data)),
+		"data-eof":    chunkerstest.DataErrReader(bytes.NewReader(data)),
+		"fail-beyond": chunkerstest.FailAfterReader(bytes.NewReader(data), 20000, nil),
+	} {
+		if err := iotest.TestReader(rd, data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// The last bytes come with io.EOF.
+	rd := chunkerstest.DataErrReader(chunkerstest.ShortReader(bytes.NewReader(data), 4000))
+	var reads []string
+	for {
+		n, err := rd.Read(make([]byte, 3000))
+		reads = append(reads, fmt.Sprint(n, err))
+		if err != nil {
+			break
+		}
+	}
+	if got := strings.Join(reads, ","); got != "3000 <nil>,1000 <nil>,3000 <nil>,1000 <nil>,2000 EOF" {
+		t.Fatalf("DataErrReader reads %s", got)
+	}
+
+	rd = chunkerstest.EmptyReadsReader(bytes.NewReader(data), 3)
+	for i := 0; i < 3; i++ {
+		if n, err := rd.Read(make([]byte, 10)); n != 0 || err != nil {
+			t.Fatalf("empty read %d: %d, %v", i, n, err)
+		}
+	}
+	if n, err := rd.Read(make([]byte, 10)); n != 10 || err != nil {
+		t.Fatalf("read after the empty ones: %d, %v", n, err)
+	}
+
+	got, err := io.ReadAll(chunkerstest.FailAfterReader(bytes.NewReader(data), 5000, nil))
+	if len(got) != 5000 || !errors.Is(err, chunkerstest.ErrInjected) {
+		t.Fatalf("FailAfterReader: %d bytes, %v", len(got), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	got, err = io.ReadAll(chunkerstest.StallReader(ctx, bytes.NewReader(data), 5000))
+	if len(got) != 5000 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("StallReader: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	random, _ := corpus.Bytes(corpus.Random, 1<<20, 1)
+	text, _ := corpus.Bytes(corpus.Text, 1<<20, 1)
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, tc := range []struct {
+		algorithm string
+		opts      *chunkers.ChunkerOpts
+	}{
+		{"fastcdc-v1.0.0", nil},
+		{"kfastcdc", &chunkers.ChunkerOpts{Key: key}},
+		{"fastcdc4stadia", nil},
+		{"jc-v1.1.0", nil},
+		{"ultracdc-v1.0.0", nil},
+		{"fixed-v1.0.0", &chunkers.ChunkerOpts{MinSize: 8 << 10, NormalSize: 8 << 10, MaxSize: 8 << 10}},
+	} {
+		for _, data := range [][]byte{random, text, nil} {
+			chunkerstest.Check(t, tc.algorithm, tc.opts, data)
+		}
+	}
+}
+
+func check(algorithm string, data []byte) []string {
+	return chunkerstest.Record(func(t testing.TB) { chunkerstest.Check(t, algorithm, nil, data) })
+}
+
+// broken is the base of implementations that break the contract.
+type broken struct{}
+
+func (broken) DefaultOptions() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: 1 << 10, NormalSize: 4 << 10, MaxSize: 16 << 10}
+}
+func (broken) Setup(*chunkers.ChunkerOpts) error    { return nil }
+func (broken) Validate(*chunkers.ChunkerOpts) error { return nil }
+
+// tooShort cuts below MinSize.
+type tooShort struct{ broken }
+
+func (tooShort) Algorithm(o *chunkers.ChunkerOpts, _ []byte, n int) int {
+	return min(n, 100)
+}
+
+// pastData cuts by the byte after the window, which depends on how far the
+// scan buffer happens to be filled.
+type pastData struct{ broken }
+
+func (pastData) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int {
+	if n < o.MaxSize {
+		return n
+	}
+	if full := data[:cap(data)]; len(full) > n && full[n]&1 == 1 {
+		return o.MinSize
+	}
+	return o.NormalSize
+}
+
+// Check looks algorithms up by name: register the broken ones once, rather
+// than in a test that may run more than once.
+func init() {
+	_ = chunkers.Register("chunkerstest-too-short", func() chunkers.ChunkerImplementation { return tooShort{} })
+	_ = chunkers.Register("chunkerstest-past-data", func() chunkers.ChunkerImplementation { return pastData{} })
+}
+
+func TestCheckCatches(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 1<<20, 1)
+
+	if f := check("fastcdc-v1.0.0", data); len(f) != 0 {
+		t.Fatalf("fastcdc-v1.0.0: %q", f)
+	}
+	if f := check("chunkerstest-too-short", data); len(f) == 0 || !strings.Contains(f[0], "chunks cover") {
+		t.Fatalf("a chunk below MinSize went unnoticed: %q", f)
+	}
+	if f := check("chunkerstest-past-data", data); len(f) == 0 {
+		t.Fatal("cut points depending on the read pattern went unnoticed")
+	}
+	if f := check("no-such-algorithm", data); len(f) != 1 || !strings.Contains(f[0], "unknown algorithm") {
+		t.Fatalf("unknown algorithm: %q", f)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	f := chunkerstest.Record(func(t testing.TB) {
+		t.Errorf("first %d", 1)
+		t.Fatal("second")
+		t.Error("not reached")
+	})
+	if len(f) != 2 || f[0] != "first 1" || f[1] != "second" {
+		t.Fatalf("recorded %q", f)
+	}
+	if f := chunkerstest.Record(func(testing.TB) {}); len(f) != 0 {
+		t.Fatalf("recorded %q", f)
+	}
+}
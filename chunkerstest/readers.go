@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package chunkerstest helps test code built on chunkers, and chunker
+// implementations themselves, against sources that misbehave the way real
+// ones do: readers that return less than asked, nothing at all, data along
+// with an error, an error partway through, or that block until a context is
+// cancelled. Check runs a registered algorithm through all of them and
+// holds it to the contract of the Chunker.
+package chunkerstest
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrInjected is the error FailAfterReader returns when none is given.
+var ErrInjected = errors.New("chunkerstest: injected read error")
+
+type shortReader struct {
+	r io.Reader
+	n int
+}
+
+func (sr *shortReader) Read(p []byte) (int, error) {
+	if len(p) > sr.n {
+		p = p[:sr.n]
+	}
+	return sr.r.Read(p)
+}
+
+// ShortReader returns a reader that reads at most n bytes from r per call,
+// however large the buffer it is given.
+func ShortReader(r io.Reader, n int) io.Reader {
+	return &shortReader{r: r, n: max(n, 1)}
+}
+
+// OneByteReader returns a reader that reads a single byte from r per call.
+func OneByteReader(r io.Reader) io.Reader {
+	return ShortReader(r, 1)
+}
+
+type emptyReadsReader struct {
+	r     io.Reader
+	n     int
+	empty int
+}
+
+func (er *emptyReadsReader) Read(p []byte) (int, error) {
+	if er.empty < er.n {
+		er.empty++
+		return 0, nil
+	}
+	er.empty = 0
+	return er.r.Read(p)
+}
+
+// EmptyReadsReader returns a reader that answers n reads in a row with
+// (0, nil) before each read it passes on to r. The Chunker tolerates up to
+// 99 in a row, as bufio.Reader does, and fails with io.ErrNoProgress past
+// that.
+func EmptyReadsReader(r io.Reader, n int) io.Reader {
+	return &emptyReadsReader{r: r, n: n}
+}
+
+type dataErrReader struct {
+	r      io.Reader
+	buf    []byte
+	unread []byte
+	err    error
+}
+
+func (dr *dataErrReader) fill() {
+	n, err := dr.r.Read(dr.buf)
+	dr.unread, dr.err = dr.buf[:n], err
+}
+
+func (dr *dataErrReader) Read(p []byte) (int, error) {
+	if len(dr.unread) == 0 && dr.err == nil {
+		dr.fill()
+	}
+	n := copy(p, dr.unread)
+	dr.unread = dr.unread[n:]
+	// Look ahead once the buffered data is out, so that the error ending r
+	// goes with the last bytes rather than on a read of its own.
+	if len(dr.unread) == 0 && dr.err == nil && n > 0 {
+		dr.fill()
+	}
+	if len(dr.unread) == 0 {
+		return n, dr.err
+	}
+	return n, nil
+}
+
+// DataErrReader returns a reader that returns the error that ends r, io.EOF
+// or another, together with the last bytes of data rather than on a read of
+// its own, as io.Reader allows.
+func DataErrReader(r io.Reader) io.Reader {
+	return &dataErrReader{r: r, buf: make([]byte, 4096)}
+}
+
+type failAfterReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (fr *failAfterReader) Read(p []byte) (int, error) {
+	if fr.n <= 0 {
+		return 0, fr.err
+	}
+	if int64(len(p)) > fr.n {
+		p = p[:fr.n]
+	}
+	n, err := fr.r.Read(p)
+	fr.n -= int64(n)
+	if fr.n <= 0 && err == nil {
+		err = fr.err
+	}
+	return n, err
+}
+
+// FailAfterReader returns a reader that reads n bytes from r, then fails
+// with err, or ErrInjected if err is nil. The error comes with the read
+// that completes the n bytes. A source that ends before n bytes ends as r
+// does.
+func FailAfterReader(r io.Reader, n int64, err error) io.Reader {
+	if err == nil {
+		err = ErrInjected
+	}
+	return &failAfterReader{r: r, n: n, err: err}
+}
+
+type stallReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   int64
+}
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	if sr.n <= 0 {
+		<-sr.ctx.Done()
+		return 0, sr.ctx.Err()
+	}
+	if int64(len(p)) > sr.n {
+		p = p[:sr.n]
+	}
+	n, err := sr.r.Read(p)
+	sr.n -= int64(n)
+	return n, err
+}
+
+// StallReader returns a reader that reads n bytes from r, then blocks until
+// ctx is done and fails with its error, the way a network source stalls
+// until its caller gives up on it.
+func StallReader(ctx context.Context, r io.Reader, n int64) io.Reader {
+	return &stallReader{ctx: ctx, r: r, n: n}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package chunkerstest
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// Recorder is a testing.TB that records failures instead of reporting them,
+// to test checks such as Check themselves: that they catch an implementation
+// known to be broken. Only the failure methods are implemented; run checks
+// with Record, as its Fatal methods end the goroutine they are called on.
+type Recorder struct {
+	testing.TB
+	Failures []string
+}
+
+func (r *Recorder) Helper() {}
+
+func (r *Recorder) Error(args ...any) {
+	r.Failures = append(r.Failures, fmt.Sprint(args...))
+}
+
+func (r *Recorder) Errorf(format string, args ...any) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+func (r *Recorder) Fail() {
+	r.Failures = append(r.Failures, "failed")
+}
+
+func (r *Recorder) Failed() bool {
+	return len(r.Failures) != 0
+}
+
+func (r *Recorder) Fatal(args ...any) {
+	r.Error(args...)
+	runtime.Goexit()
+}
+
+func (r *Recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *Recorder) FailNow() {
+	r.Fail()
+	runtime.Goexit()
+}
+
+// Record runs check with a Recorder on a goroutine of its own and returns
+// the failures it recorded, up to the first fatal one.
+func Record(check func(testing.TB)) []string {
+	r := &Recorder{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		check(r)
+	}()
+	<-done
+	return r.Failures
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 )
 
 func runAnalyze(args []string) error {
@@ -26,11 +27,26 @@ func runAnalyze(args []string) error {
 	chunker := fs.String("chunker", "fastcdc-v1.0.0", "chunking algorithm")
 	var o opts
 	o.register(fs)
+	fs.StringVar(&o.similarity, "similarity", "", "also measure delta compression of similar chunks: broder | finesse")
+	fs.BoolVar(&o.byType, "by-type", false, "break the result down by file extension (implied by -r)")
+	recursive := fs.Bool("r", false, "walk the given directories recursively")
+	var w walkOpts
+	w.register(fs)
+	format := registerFormat(fs, true)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	files, err := readFiles(fs.Args())
+	var files corpus
+	var walk *walkCorpus
+	var err error
+	if *recursive {
+		o.byType = true
+		walk, err = newWalkCorpus(fs.Args(), w)
+		files = walk
+	} else {
+		files, err = inputs(fs.Args())
+	}
 	if err != nil {
 		return err
 	}
@@ -39,17 +55,69 @@ func runAnalyze(args []string) error {
 	if err != nil {
 		return err
 	}
+
+	switch *format {
+	case "json":
+		out := analyzeJSON{header: newHeader("analyze"), Options: o.json(), Result: res.json()}
+		if walk != nil {
+			out.Skipped = &skippedJSON{walk.excluded, walk.tooLarge, walk.links, walk.errors}
+		}
+		return emitJSON(os.Stdout, out)
+	case "csv":
+		return writeResultsCSV(os.Stdout, res)
+	}
+
 	printResult(res)
+	if walk != nil {
+		fmt.Printf("skipped:     %d excluded, %d over -max-file-size, %d symlink(s), %d unreadable\n",
+			walk.excluded, walk.tooLarge, walk.links, walk.errors)
+	}
+	if len(res.types) != 0 {
+		fmt.Println()
+		printTypes(res)
+	}
 	return nil
 }
 
+type analyzeJSON struct {
+	header
+	Options optsJSON     `json:"options"`
+	Result  resultJSON   `json:"result"`
+	Skipped *skippedJSON `json:"skipped,omitempty"`
+}
+
+// skippedJSON counts the files a recursive walk left out.
+type skippedJSON struct {
+	Excluded   int `json:"excluded"`
+	TooLarge   int `json:"too_large"`
+	Symlinks   int `json:"symlinks"`
+	Unreadable int `json:"unreadable"`
+}
+
+// printTypes prints the per-file-type breakdown, largest types first.
+func printTypes(r *result) {
+	fmt.Printf("%-12s %8s %10s %10s %10s %8s %8s\n", "type", "files", "size", "unique", "chunks", "unique#", "ratio")
+	for _, t := range r.types {
+		fmt.Printf("%-12s %8d %10s %10s %10d %8d %8.4f\n", t.name, t.files,
+			humanBytes(t.totalBytes), humanBytes(t.uniqueBytes), t.chunks, t.uniqueChunk, t.dedupRatio())
+	}
+}
+
 func printResult(r *result) {
 	mn, p50, avg, p95, mx, stddev := r.distribution()
-	fmt.Printf("algorithm:   %s\n", r.algorithm)
+	fmt.Printf("algorithm:   %s%s\n", r.algorithm, keyNote(r.key))
 	fmt.Printf("input:       %s in %d chunk(s)\n", humanBytes(r.totalBytes), r.chunks)
 	fmt.Printf("dedup ratio: %.4f (%s unique of %s; %.2f%% saved)\n",
 		r.dedupRatio(), humanBytes(r.uniqueBytes), humanBytes(r.totalBytes),
 		100*(1-r.dedupRatio()))
+	if r.deltaChunks != 0 || r.deltaSaved != 0 {
+		fmt.Printf("delta ratio: %.4f (%d similar chunk(s) delta-encoded; %s or %.2f%% saved beyond dedup)\n",
+			r.deltaRatio(), r.deltaChunks, humanBytes(r.deltaSaved),
+			100*float64(r.deltaSaved)/float64(r.totalBytes))
+	}
+	if r.sampleShift != 0 {
+		fmt.Printf("             (estimated from 1 in %d chunk digests; raise -mem for exact figures)\n", 1<<r.sampleShift)
+	}
 	fmt.Printf("chunk size:  min=%d p50=%d avg=%d p95=%d max=%d stddev=%.0f\n",
 		mn, p50, avg, p95, mx, stddev)
 	fmt.Printf("throughput:  %.1f MB/s\n", r.throughputMBs())
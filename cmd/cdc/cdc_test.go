@@ -18,8 +18,26 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+
+	workload "github.com/PlakarKorp/go-cdc-chunkers/corpus"
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
 )
 
 // buildCorpus makes a base file plus two files that share a large common
@@ -34,6 +52,18 @@ func buildCorpus(t *testing.T) [][]byte {
 	return [][]byte{a, b}
 }
 
+// memCorpus is a corpus of in-memory files.
+type memCorpus [][]byte
+
+func (mc memCorpus) each(fn func(name string, r io.Reader) error) error {
+	for i, data := range mc {
+		if err := fn(fmt.Sprintf("file%d", i), bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func bytesOf(r *rand.Rand, n int) []byte {
 	b := make([]byte, n)
 	r.Read(b)
@@ -43,7 +73,7 @@ func bytesOf(r *rand.Rand, n int) []byte {
 func TestMeasureDedup(t *testing.T) {
 	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
 	files := buildCorpus(t)
-	res, err := measure("fastcdc-v1.0.0", files, o)
+	res, err := measure("fastcdc-v1.0.0", memCorpus(files), o)
 	if err != nil {
 		t.Fatalf("measure: %v", err)
 	}
@@ -56,25 +86,72 @@ func TestMeasureDedup(t *testing.T) {
 	}
 }
 
-func TestResyncSharedMonotonic(t *testing.T) {
+func TestResyncSingleInsertion(t *testing.T) {
 	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
-	r := rand.New(rand.NewSource(99))
-	orig := make([]byte, 2*1024*1024)
-	r.Read(orig)
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, bytesOf(rand.New(rand.NewSource(99)), 2<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
 
 	// A single small insertion should leave most of a good chunker's output
 	// shared. We assert v1 retains the bulk of its chunks — this is both a
-	// smoke test of resyncShared and a guard that v1's resync stays healthy.
-	edited := applyInsertions(orig, 1, 1, 1)
-	shared, no, ne, err := resyncShared("fastcdc-v1.0.0", orig, edited, o)
+	// smoke test of resyncFile and a guard that v1's resync stays healthy.
+	m := &edits.Model{Kinds: []edits.Kind{edits.Insert}, Size: 1}
+	plan, err := m.Plan(2<<20, 1, 1)
 	if err != nil {
-		t.Fatalf("resyncShared: %v", err)
+		t.Fatal(err)
 	}
-	if no == 0 || ne == 0 {
-		t.Fatalf("expected chunks on both sides, got o=%d e=%d", no, ne)
+	row, err := resyncFile("fastcdc-v1.0.0", path, []edits.Plan{plan}, 1, o)
+	if err != nil {
+		t.Fatalf("resyncFile: %v", err)
 	}
-	if shared < 0.80 {
-		t.Fatalf("v1 resync unexpectedly low: %.2f (a single byte edit should localise)", shared)
+	if row.ChunksOrig == 0 || row.ChunksEdited == 0 {
+		t.Fatalf("expected chunks on both sides, got o=%d e=%d", row.ChunksOrig, row.ChunksEdited)
+	}
+	if row.Shared < 0.80 {
+		t.Fatalf("v1 resync unexpectedly low: %.2f (a single byte edit should localise)", row.Shared)
+	}
+}
+
+// applyInsertions is the in-memory edit the streaming insertion plan must match:
+// n random insertions of editSize bytes, each anywhere in the file as edited
+// so far.
+func applyInsertions(data []byte, n, editSize int, seed int64) []byte {
+	r := rand.New(rand.NewSource(seed))
+	out := append([]byte(nil), data...)
+	for i := 0; i < n; i++ {
+		pos := 0
+		if len(out) > 0 {
+			pos = r.Intn(len(out))
+		}
+		ins := make([]byte, editSize)
+		r.Read(ins)
+		out = append(out[:pos], append(ins, out[pos:]...)...)
+	}
+	return out
+}
+
+func TestEditPlanMatchesInsertions(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	for _, size := range []int{0, 1, 100, 64 * 1024} {
+		data := bytesOf(r, size)
+		for _, n := range []int{0, 1, 16, 200} {
+			for _, editSize := range []int{0, 1, 7} {
+				want := applyInsertions(data, n, editSize, 3)
+				m := &edits.Model{Kinds: []edits.Kind{edits.Insert}, Size: editSize}
+				plan, err := m.Plan(int64(size), n, 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(plan.Reader(bytes.NewReader(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) || plan.Size() != int64(len(want)) {
+					t.Fatalf("size=%d edits=%d editSize=%d: streamed edit differs", size, n, editSize)
+				}
+			}
+		}
 	}
 }
 
@@ -85,3 +162,790 @@ func TestApplyInsertionsGrows(t *testing.T) {
 		t.Fatalf("expected %d bytes, got %d", len(data)+15, len(out))
 	}
 }
+
+// TestResyncDamage checks the per-edit damage on edits whose effect is known:
+// an overwrite confined to one chunk invalidates about one chunk, and no edit
+// at all invalidates none.
+func TestResyncDamage(t *testing.T) {
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, bytesOf(rand.New(rand.NewSource(8)), 2<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &edits.Model{Kinds: []edits.Kind{edits.Overwrite}, Size: 1}
+	plans := make([]edits.Plan, 5)
+	for i := range plans {
+		plans[i], _ = m.Plan(2<<20, 4, int64(i))
+	}
+	row, err := resyncFile("fastcdc-v1.0.0", path, plans, 4, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.DamagePerEdit < 0.9 || row.DamagePerEdit > 3 || row.Shared < 0.9 {
+		t.Fatalf("1-byte overwrites: damage %.2f/edit, shared %.2f", row.DamagePerEdit, row.Shared)
+	}
+	if row.SharedCI95 <= 0 {
+		t.Fatalf("expected a confidence interval over 5 trials")
+	}
+
+	none, _ := m.Plan(2<<20, 0, 1)
+	row, err = resyncFile("fastcdc-v1.0.0", path, []edits.Plan{none}, 0, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Shared != 1 || row.LostChunks != 0 || row.NewChunks != 0 || row.SharedCI95 != 0 {
+		t.Fatalf("unedited file: %+v", row)
+	}
+}
+
+// TestMeasureSimilarity builds two files that differ by sparse byte flips, so
+// almost no chunk dedups exactly but nearly every chunk of the second file
+// has a near-duplicate base in the first.
+func TestMeasureSimilarity(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	a := bytesOf(r, 1024*1024)
+	b := append([]byte(nil), a...)
+	for i := 0; i < len(b); i += 4096 {
+		b[i+r.Intn(4096)] ^= 0xff
+	}
+
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024, similarity: "finesse"}
+	res, err := measure("fastcdc-v1.0.0", memCorpus{a, b}, o)
+	if err != nil {
+		t.Fatalf("measure: %v", err)
+	}
+	if res.deltaChunks == 0 {
+		t.Fatal("no similar chunk found between near-duplicate files")
+	}
+	// Exact dedup finds next to nothing; deltas should recover most of the
+	// second file.
+	if res.deltaSaved < int64(len(b))/2 {
+		t.Fatalf("delta saved only %d of %d bytes", res.deltaSaved, len(b))
+	}
+	if res.deltaRatio() >= res.dedupRatio() {
+		t.Fatalf("delta ratio %.4f not better than dedup ratio %.4f", res.deltaRatio(), res.dedupRatio())
+	}
+
+	o.similarity = "nope"
+	if _, err := measure("fastcdc-v1.0.0", memCorpus{a}, o); err == nil {
+		t.Fatal("expected an error for an unknown similarity method")
+	}
+}
+
+// TestSplitJoin splits two versions of a file into one store and joins them
+// back, checking the second split only stores the chunks that changed.
+func TestSplitJoin(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "store")
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
+	files := buildCorpus(t)
+
+	var stored int
+	for i, data := range files {
+		path := filepath.Join(dir, "in")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		manifest := filepath.Join(dir, "m"+string(rune('0'+i)))
+		st, err := split("fastcdc-v1.0.0", path, store, manifest, o)
+		if err != nil {
+			t.Fatalf("split: %v", err)
+		}
+		if st.size != int64(len(data)) {
+			t.Fatalf("split %d bytes, want %d", st.size, len(data))
+		}
+		if i == 1 && st.stored >= st.chunks {
+			t.Fatalf("second version stored all %d chunks, want dedup", st.chunks)
+		}
+		stored += st.stored
+
+		// One non-empty line per chunk counted, and nothing else.
+		raw, err := os.ReadFile(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+		if len(lines)-2 != st.chunks {
+			t.Fatalf("%d chunk lines in the manifest, split counted %d", len(lines)-2, st.chunks)
+		}
+		mf, err := os.Open(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pr, err := profile.NewReader(mf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; err == nil; n++ {
+			_, err = pr.Next()
+		}
+		mf.Close()
+		if err != io.EOF || n-1 != st.chunks {
+			t.Fatalf("read %d chunks from the manifest, split counted %d: %v", n-1, st.chunks, err)
+		}
+
+		var out bytes.Buffer
+		if _, err := join(manifest, store, &out); err != nil {
+			t.Fatalf("join: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatal("joined file differs from the input")
+		}
+	}
+
+	chunks, _ := filepath.Glob(filepath.Join(store, "*", "*"))
+	if len(chunks) != stored {
+		t.Fatalf("%d chunk files in store, want %d", len(chunks), stored)
+	}
+
+	// Corrupt the first chunk of the first file: join must refuse it.
+	mf, err := os.Open(filepath.Join(dir, "m0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	pr, err := profile.NewReader(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := pr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chunkPath(store, first.Digest), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := join(filepath.Join(dir, "m0"), store, io.Discard); err == nil {
+		t.Fatal("join accepted a corrupt chunk")
+	}
+
+	// A digest that is not hex names no chunk, even at the right length,
+	// and an empty chunk line is no chunk either.
+	outside := filepath.Join(dir, "outside")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`{"offset":0,"length":6,"digest":"../../` + strings.Repeat("a", 58) + `"}`,
+		`{"offset":0,"length":6,"digest":"` + strings.Repeat("A", 64) + `"}`,
+		`{"offset":0,"length":0,"digest":"` + strings.Repeat("a", 64) + `"}`,
+	} {
+		crafted := filepath.Join(dir, "crafted")
+		mf := `{"cdc_profile":1,"algorithm":"fastcdc-v1.0.0"}` + "\n" + line + "\n" +
+			`{"end":true,"chunks":1,"size":6,"digest":"` + strings.Repeat("0", 64) + `"}` + "\n"
+		if err := os.WriteFile(crafted, []byte(mf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := join(crafted, store, io.Discard); err == nil || !strings.Contains(err.Error(), "chunk") {
+			t.Fatalf("join accepted %s: %v", line, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "in")
+	data := bytesOf(rand.New(rand.NewSource(12)), 1<<20)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024, key: key}
+	manifest := filepath.Join(dir, "m")
+	if _, err := split("kfastcdc", path, filepath.Join(dir, "store"), manifest, o); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(input []byte, key []byte, rewrite func(*profile.Header)) (*verifyResult, error) {
+		t.Helper()
+		mf, err := os.ReadFile(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rewrite != nil {
+			hdr, rest, _ := bytes.Cut(mf, []byte("\n"))
+			var h profile.Header
+			if err := json.Unmarshal(hdr, &h); err != nil {
+				t.Fatal(err)
+			}
+			rewrite(&h)
+			hdr, _ = json.Marshal(h)
+			mf = append(append(hdr, '\n'), rest...)
+		}
+		pr, err := profile.NewReader(bytes.NewReader(mf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return verify(pr, bytes.NewReader(input), key, 2)
+	}
+
+	v, err := check(data, key, nil)
+	if err != nil || v.Divergence != nil || !v.FileMatches {
+		t.Fatalf("unchanged file: %+v, %v", v, err)
+	}
+	if _, err := check(data, nil, nil); err == nil {
+		t.Fatal("keyed manifest verified without a key")
+	}
+
+	// The manifest records the key fingerprint, so another key is refused;
+	// with a manifest that does not, it cuts the same file elsewhere.
+	other := bytes.Repeat([]byte{8}, 32)
+	if _, err := check(data, other, nil); err == nil {
+		t.Fatal("manifest verified with another key")
+	}
+	v, err = check(data, other, func(h *profile.Header) { h.Key = "" })
+	if err != nil || v.Divergence == nil || v.Divergence.Kind != divergeCut || !v.FileMatches {
+		t.Fatalf("other key: %+v, %v", v, err)
+	}
+	if v.Divergence.Index != 0 || len(v.Divergence.Manifest) != 2 || len(v.Divergence.File) != 2 {
+		t.Fatalf("unexpected divergence %+v", v.Divergence)
+	}
+
+	// A flipped byte changes one chunk's content only.
+	edited := append([]byte(nil), data...)
+	edited[500000] ^= 0xff
+	v, err = check(edited, key, nil)
+	if err != nil || v.Divergence == nil || v.FileMatches {
+		t.Fatalf("edited file: %+v, %v", v, err)
+	}
+	d := v.Divergence
+	if d.Offset > 500000 || d.Offset+int64(d.File[0].Length) <= 500000 || len(d.Before) != 2 || d.Index != v.Chunks {
+		t.Fatalf("edited file diverges at %+v", d)
+	}
+
+	// A truncated file runs out of chunks.
+	v, err = check(data[:len(data)/2], key, nil)
+	if err != nil || v.Divergence == nil || v.FileMatches {
+		t.Fatalf("truncated file: %+v, %v", v, err)
+	}
+
+	// Other sizes recorded in the manifest: the cut points move.
+	v, err = check(data, key, func(h *profile.Header) { h.NormalSize = 16 * 1024 })
+	if err != nil || v.Divergence == nil || v.Divergence.Kind != divergeCut {
+		t.Fatalf("other sizes: %+v, %v", v, err)
+	}
+
+	// A zero-length chunk line is a corrupt manifest, not a chunk to skip.
+	mf, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, rest, _ := bytes.Cut(mf, []byte("\n"))
+	empty := `{"offset":0,"length":0,"digest":"` + strings.Repeat("0", 64) + `"}`
+	pr, err := profile.NewReader(bytes.NewReader([]byte(string(hdr) + "\n" + empty + "\n" + string(rest))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := verify(pr, bytes.NewReader(data), key, 2); err == nil {
+		t.Fatalf("manifest with an empty chunk line verified: %+v", v)
+	}
+
+	// A manifest is a profile: one in the binary encoding serves too.
+	g, err := profile.NewGenerator(bytes.NewReader(data), "kfastcdc", o.chunkerOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bin bytes.Buffer
+	if _, err := profile.Encode(&bin, profile.Binary, g); err != nil {
+		t.Fatal(err)
+	}
+	if pr, err = profile.NewReader(&bin); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := verify(pr, bytes.NewReader(data), key, 2); err != nil || v.Divergence != nil || !v.FileMatches {
+		t.Fatalf("binary profile: %+v, %v", v, err)
+	}
+}
+
+func TestKeyFlags(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, shortFile := filepath.Join(dir, "key"), filepath.Join(dir, "short")
+	fileKey, envKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	os.WriteFile(keyFile, fileKey, 0o600)
+	os.WriteFile(shortFile, []byte{1, 2, 3}, 0o600)
+	t.Setenv("CDC_TEST_KEY", hex.EncodeToString(envKey))
+	t.Setenv("CDC_TEST_SHORT", "0a0b0c")
+
+	parse := func(args ...string) (*opts, error) {
+		var o opts
+		fs := flag.NewFlagSet("t", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		o.register(fs)
+		return &o, fs.Parse(args)
+	}
+	if o, err := parse("-key-file", keyFile); err != nil || !bytes.Equal(o.key, fileKey) {
+		t.Fatalf("-key-file: %v %x", err, o.key)
+	}
+	if o, err := parse("-key-env", "CDC_TEST_KEY"); err != nil || !bytes.Equal(o.chunkerOpts().Key, envKey) {
+		t.Fatalf("-key-env: %v %x", err, o.key)
+	}
+	o, err := parse("-key-hex", hex.EncodeToString(envKey))
+	if err != nil || !bytes.Equal(o.key, envKey) {
+		t.Fatalf("-key-hex: %v %x", err, o.key)
+	}
+	if fp := o.json().Key; len(fp) != 16 || strings.Contains(hex.EncodeToString(envKey), fp) {
+		t.Fatalf("fingerprint %q", fp)
+	}
+	for _, args := range [][]string{
+		{"-key-env", "CDC_TEST_UNSET"},
+		{"-key-env", "CDC_TEST_SHORT"},
+		{"-key-file", shortFile},
+		{"-key-hex", "zz"},
+		{"-key-file", keyFile, "-key-env", "CDC_TEST_KEY"},
+		{"-key-file", filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, err := parse(args...); err == nil {
+			t.Fatalf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
+	data := append(bytesOf(rand.New(rand.NewSource(4)), 1<<20), make([]byte, 256*1024)...)
+
+	var cuts []inspectCut
+	reasons, err := inspect("fastcdc-v1.0.0", bytes.NewReader(data), o, func(c inspectCut) error {
+		cuts = append(cuts, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var off uint64
+	for i, c := range cuts {
+		if c.Index != i || c.Offset != off {
+			t.Fatalf("cut %d: index %d at %d, want %d", i, c.Index, c.Offset, off)
+		}
+		off += uint64(c.Length)
+	}
+	if off != uint64(len(data)) {
+		t.Fatalf("cuts cover %d of %d bytes", off, len(data))
+	}
+
+	seen := make(map[string]int)
+	for _, r := range reasons {
+		seen[r.Reason] = r.Chunks
+	}
+	if seen["maskS"]+seen["maskL"] == 0 || seen["max-size"] < 3 || seen["end-of-stream"] > 1 {
+		t.Fatalf("reasons %v", reasons)
+	}
+}
+
+func TestGen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "img")
+	if err := runGen([]string{"-kind", "vm-image", "-size", "300K", "-seed", "3", "-out", path}); err != nil {
+		t.Fatal(err)
+	}
+	want, err := workload.Bytes(workload.VMImage, 300<<10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("gen wrote %d bytes, not the corpus workload: %v", len(got), err)
+	}
+
+	series := filepath.Join(dir, "series")
+	if err := runGen([]string{"-kind", "text", "-size", "64K", "-versions", "3", "-edit-rate", "0.01", "-out", series}); err != nil {
+		t.Fatal(err)
+	}
+	v0, _ := os.ReadFile(filepath.Join(series, "v0"))
+	v2, err := os.ReadFile(filepath.Join(series, "v2"))
+	if err != nil || len(v0) != 64<<10 || bytes.Equal(v0, v2) {
+		t.Fatalf("series: v0 %d bytes, v2 %d bytes: %v", len(v0), len(v2), err)
+	}
+
+	if err := runGen([]string{"-kind", "nope"}); !errors.Is(err, workload.ErrKind) {
+		t.Fatalf("unknown kind: %v", err)
+	}
+	if err := runGen([]string{"-versions", "2"}); err == nil {
+		t.Fatal("a series to stdout was accepted")
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	out := fs.String("out", "", "")
+	args, err := parseInterspersed(fs, []string{"a", "-out", "dir", "b"})
+	if err != nil || *out != "dir" || len(args) != 2 || args[0] != "a" || args[1] != "b" {
+		t.Fatalf("got %v %q %v", args, *out, err)
+	}
+}
+
+// TestMeasureDistributionExact checks the size histogram gives the same
+// figures as sorting every chunk length.
+func TestMeasureDistributionExact(t *testing.T) {
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
+	files := buildCorpus(t)
+	res, err := measure("fastcdc-v1.0.0", memCorpus(files), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lengths []int
+	for _, data := range files {
+		c, _ := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), o.chunkerOpts())
+		c.Split(func(_, length uint, _ []byte) error {
+			if length != 0 {
+				lengths = append(lengths, int(length))
+			}
+			return nil
+		})
+	}
+	sort.Ints(lengths)
+	var sum int
+	for _, l := range lengths {
+		sum += l
+	}
+	mn, p50, avg, p95, mx, _ := res.distribution()
+	if mn != lengths[0] || mx != lengths[len(lengths)-1] ||
+		p50 != lengths[len(lengths)*50/100] || p95 != lengths[len(lengths)*95/100] ||
+		avg != sum/len(lengths) {
+		t.Fatalf("distribution %d/%d/%d/%d/%d differs from the sorted lengths", mn, p50, avg, p95, mx)
+	}
+}
+
+// TestDedupSetBounded checks the dedup set stays exact under its limit and
+// within it above, with a sensible estimate.
+func TestDedupSetBounded(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	exact := newDedupSet(0)
+	bounded := newDedupSet(1000)
+	for i := 0; i < 50000; i++ {
+		var d [32]byte
+		r.Read(d[:])
+		for _, s := range []*dedupSet{exact, bounded} {
+			s.add(d, 100, 0)
+			s.add(d, 100, 0)
+		}
+	}
+	if exact.uniqueChunks() != 50000 || exact.uniqueBytes() != 5000000 {
+		t.Fatalf("exact set counted %d chunks", exact.uniqueChunks())
+	}
+	if len(bounded.entries) > 1000 || bounded.shift == 0 {
+		t.Fatalf("bounded set holds %d entries at shift %d", len(bounded.entries), bounded.shift)
+	}
+	if est := bounded.uniqueChunks(); est < 40000 || est > 60000 {
+		t.Fatalf("estimate %d too far from 50000", est)
+	}
+}
+
+// TestMemBudgetShared checks the dedup set and the delta bases share -mem
+// rather than each taking all of it.
+func TestMemBudgetShared(t *testing.T) {
+	o := &opts{mem: 3}
+	if dedup, delta := o.memBudgets(); dedup != 3<<20 || delta != 0 {
+		t.Fatalf("without similarity: %d + %d", dedup, delta)
+	}
+	o.similarity = "finesse"
+	dedup, delta := o.memBudgets()
+	if dedup+delta != 3<<20 || dedup == 0 || delta == 0 {
+		t.Fatalf("with similarity: %d + %d of %d", dedup, delta, 3<<20)
+	}
+	if o.dedupLimit() != int(dedup/dedupEntrySize) {
+		t.Fatalf("dedup limit %d from a share of %d", o.dedupLimit(), dedup)
+	}
+
+	ds, err := newDeltaState("finesse", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(13))
+	for i := 0; i < 100; i++ {
+		chunk := bytesOf(r, 64*1024)
+		if _, err := ds.add(sha256.Sum256(chunk), chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ds.held > ds.budget || len(ds.bases) == 0 || len(ds.bases) == 100 {
+		t.Fatalf("%d bases, %d bytes held over a budget of %d", len(ds.bases), ds.held, ds.budget)
+	}
+}
+
+func TestInputsStdinOnce(t *testing.T) {
+	if _, err := inputs([]string{"-", "a", "-"}); err == nil {
+		t.Fatal("stdin accepted twice")
+	}
+	if _, err := inputs(nil); err == nil {
+		t.Fatal("no input accepted")
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	if _, cleanup, err := spoolStdin([]string{"-", "-"}); err == nil {
+		cleanup()
+		t.Fatal("stdin spooled twice")
+	}
+	if spooled, _ := os.ReadDir(tmp); len(spooled) != 0 {
+		t.Fatalf("%d spool file(s) left behind", len(spooled))
+	}
+}
+
+// TestWalkCorpus checks selection rules of the recursive walk and the
+// per-type breakdown, with dedup across files of different types.
+func TestWalkCorpus(t *testing.T) {
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(13))
+	shared := bytesOf(r, 256*1024)
+	write := func(name string, data []byte) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.img", shared)
+	write("sub/b.IMG", shared)
+	write("sub/c.log", bytesOf(r, 64*1024))
+	write("skip/d.img", shared)
+	write("big.iso", bytesOf(r, 512*1024))
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "e.log"), bytesOf(r, 64*1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// A loop back to the root must not be walked again.
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := walkOpts{symlinks: "skip", maxSize: 300 * 1024}
+	w.exclude.Set("skip")
+	wc, err := newWalkCorpus([]string{dir}, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024, byType: true}
+	res, err := measure("fastcdc-v1.0.0", wc, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wc.excluded != 1 || wc.tooLarge != 1 || wc.links != 2 {
+		t.Fatalf("excluded=%d tooLarge=%d links=%d", wc.excluded, wc.tooLarge, wc.links)
+	}
+	if len(res.types) != 2 || res.types[0].name != ".img" || res.types[0].files != 2 {
+		t.Fatalf("unexpected breakdown %+v", res.types[0])
+	}
+	// The second .img is a copy of the first: half the type dedups away.
+	if img := res.types[0]; img.uniqueBytes != img.totalBytes/2 {
+		t.Fatalf(".img unique %d of %d", img.uniqueBytes, img.totalBytes)
+	}
+	if log := res.types[1]; log.dedupRatio() != 1 {
+		t.Fatalf(".log ratio %.4f", log.dedupRatio())
+	}
+
+	// Following symlinks reaches the outside directory, once.
+	wc.opts.symlinks = "follow"
+	wc.opts.include.Set("*.log")
+	res, err = measure("fastcdc-v1.0.0", wc, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.types) != 1 || res.types[0].files != 2 || res.types[0].dedupRatio() != 1 {
+		t.Fatalf("follow: unexpected breakdown %+v", res.types)
+	}
+}
+
+func TestByteSizeFlag(t *testing.T) {
+	var b byteSize
+	for in, want := range map[string]int64{"0": 0, "512": 512, "4k": 4096, "3M": 3 << 20, "1G": 1 << 30} {
+		if err := b.Set(in); err != nil || int64(b) != want {
+			t.Fatalf("%s: got %d, %v", in, b, err)
+		}
+	}
+	if b.Set("x") == nil || b.Set("-1") == nil {
+		t.Fatal("bad sizes accepted")
+	}
+}
+
+// TestOutputSchema checks the JSON document is versioned and carries the full
+// distribution, and that CSV rows all match the header.
+func TestOutputSchema(t *testing.T) {
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024, byType: true}
+	res, err := measure("fastcdc-v1.0.0", memCorpus(buildCorpus(t)), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := emitJSON(&buf, analyzeJSON{header: newHeader("analyze"), Options: o.json(), Result: res.json()}); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema  int    `json:"schema_version"`
+		Command string `json:"command"`
+		Result  struct {
+			Chunks       int `json:"chunks"`
+			Distribution struct {
+				Histogram []sizeCount `json:"histogram"`
+			} `json:"distribution"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Schema != schemaVersion || doc.Command != "analyze" {
+		t.Fatalf("header %d %q", doc.Schema, doc.Command)
+	}
+	var n int64
+	for _, b := range doc.Result.Distribution.Histogram {
+		n += b.Count
+	}
+	if n != int64(doc.Result.Chunks) || n == 0 {
+		t.Fatalf("histogram counts %d chunks, result has %d", n, doc.Result.Chunks)
+	}
+
+	buf.Reset()
+	if err := writeResultsCSV(&buf, res, res); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1 + 2*(1+len(res.types)); len(records) != want {
+		t.Fatalf("%d CSV records, want %d", len(records), want)
+	}
+}
+
+func TestTuneSweep(t *testing.T) {
+	grid, err := tuneGrid([]string{"fastcdc-v1.0.0", "jc-v1.1.0"}, "4096,16384", "1,4", "8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grid) != 8 {
+		t.Fatalf("grid has %d configurations, want 8", len(grid))
+	}
+
+	o := &opts{}
+	rows, skipped, err := tuneSweep(memCorpus(buildCorpus(t)), grid, o, 64, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// min-div 1 makes min == avg, which every algorithm rejects.
+	if len(rows) != 4 || len(skipped) != 4 {
+		t.Fatalf("%d rows, %d skipped", len(rows), len(skipped))
+	}
+	for i, r := range rows {
+		if i > 0 && r.DedupRatio < rows[i-1].DedupRatio {
+			t.Fatal("rows not sorted by dedup ratio")
+		}
+		if r.MetadataBytes != int64(r.UniqueChunks)*64 || r.StoredRatio <= r.DedupRatio {
+			t.Fatalf("bad metadata accounting: %+v", r)
+		}
+	}
+	best := recommend(rows)
+	if best < 0 || !rows[best].Pareto {
+		t.Fatalf("recommended row %d is not on the frontier", best)
+	}
+
+	if _, _, err := tuneSweep(memCorpus{nil}, []tuneConfig{{"nope", 1, 2, 3}}, o, 64, 1); err == nil {
+		t.Fatal("unknown algorithm accepted")
+	}
+
+	// Setup takes both; Validate refuses a NormalSize that is not a power of
+	// two, and a keyed algorithm without a key.
+	refused := []tuneConfig{{"fastcdc-v1.0.0", 3072, 12288, 98304}, {"kfastcdc", 4096, 16384, 131072}}
+	if _, skipped, err := tuneSweep(memCorpus(buildCorpus(t)), refused, o, 64, 1); err == nil || len(skipped) != 2 {
+		t.Fatalf("refused configurations measured: %q, %v", skipped, err)
+	}
+}
+
+func TestPareto(t *testing.T) {
+	rows := []tuneRow{
+		{DedupRatio: 0.5, MetadataBytes: 100, ThroughputMBs: 10, StoredRatio: 0.6},
+		{DedupRatio: 0.6, MetadataBytes: 50, ThroughputMBs: 10, StoredRatio: 0.65},
+		{DedupRatio: 0.6, MetadataBytes: 100, ThroughputMBs: 5, StoredRatio: 0.7}, // dominated by both
+	}
+	markPareto(rows)
+	if !rows[0].Pareto || !rows[1].Pareto || rows[2].Pareto {
+		t.Fatalf("frontier %v %v %v", rows[0].Pareto, rows[1].Pareto, rows[2].Pareto)
+	}
+	if recommend(rows) != 0 {
+		t.Fatal("recommendation is not the lowest stored ratio")
+	}
+}
+
+// TestDiffFiles diffs a file against a version with a block replaced, a block
+// deleted and a block repeated, and checks the accounting adds up.
+func TestDiffFiles(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	old := bytesOf(r, 2<<20)
+	var edited []byte
+	edited = append(edited, old[:500000]...)
+	edited = append(edited, bytesOf(r, 5000)...)
+	edited = append(edited, old[505000:1500000]...)
+	edited = append(edited, old[1800000:]...)
+	edited = append(edited, old[1900000:2000000]...)
+
+	o := &opts{min: 2 * 1024, avg: 8 * 1024, max: 64 * 1024}
+	d, err := diffFiles("fastcdc-v1.0.0", bytes.NewReader(old), bytes.NewReader(edited), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.OldBytes != int64(len(old)) || d.NewBytes != int64(len(edited)) {
+		t.Fatalf("sizes %d/%d", d.OldBytes, d.NewBytes)
+	}
+	if d.SharedBytes+d.RepeatBytes+d.TransferBytes != d.NewBytes {
+		t.Fatal("shared + repeat + transfer != new size")
+	}
+	if d.TransferBytes == 0 || d.TransferBytes > 100000 {
+		t.Fatalf("transfer %d bytes for a 5000-byte change", d.TransferBytes)
+	}
+	if d.RemovedBytes < 300000 {
+		t.Fatalf("only %d bytes removed, 300000 were deleted", d.RemovedBytes)
+	}
+
+	// Regions tile both files and the script rebuilds the new one.
+	for _, side := range []struct {
+		regions []diffRegion
+		size    int64
+	}{{d.NewRegions, d.NewBytes}, {d.OldRegions, d.OldBytes}} {
+		var off int64
+		for _, reg := range side.regions {
+			if reg.Offset != off {
+				t.Fatalf("region at %d, want %d", reg.Offset, off)
+			}
+			off += reg.Length
+		}
+		if off != side.size {
+			t.Fatalf("regions cover %d of %d bytes", off, side.size)
+		}
+	}
+	var rebuilt []byte
+	for _, op := range d.script {
+		switch {
+		case op.Op == "insert":
+			rebuilt = append(rebuilt, edited[op.Offset:op.Offset+op.Length]...)
+		case op.Source == "old":
+			rebuilt = append(rebuilt, old[*op.SourceOffset:*op.SourceOffset+op.Length]...)
+		default:
+			rebuilt = append(rebuilt, rebuilt[*op.SourceOffset:*op.SourceOffset+op.Length]...)
+		}
+	}
+	if !bytes.Equal(rebuilt, edited) {
+		t.Fatal("edit script does not rebuild the new file")
+	}
+
+	// The script starts with a copy from offset 0 of the old file: the
+	// offset must survive in JSON, and only inserts leave it out.
+	for _, op := range d.script {
+		js, err := json.Marshal(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has := strings.Contains(string(js), `"source_offset"`); has != (op.Op == "copy") {
+			t.Fatalf("%s op encoded as %s", op.Op, js)
+		}
+	}
+	if js, _ := json.Marshal(d.script[0]); !strings.Contains(string(js), `"source_offset":0`) {
+		t.Fatalf("first op encoded as %s", js)
+	}
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 )
 
 func runCompare(args []string) error {
@@ -28,11 +29,18 @@ func runCompare(args []string) error {
 	tol := fs.Float64("tol", 0.02, "dedup-ratio regression tolerance (fraction) for exit status")
 	var o opts
 	o.register(fs)
+	format := registerFormat(fs, true)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	files, err := readFiles(fs.Args())
+	// Each algorithm reads the inputs in turn: stdin must be spooled.
+	paths, cleanup, err := spoolStdin(fs.Args())
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	files, err := inputs(paths)
 	if err != nil {
 		return err
 	}
@@ -46,18 +54,46 @@ func runCompare(args []string) error {
 		return fmt.Errorf("%s: %w", *b, err)
 	}
 
-	printComparison(ra, rb)
-
 	// Exit non-zero if the candidate's dedup ratio is worse than the baseline
 	// by more than the tolerance — so this is usable as a CI regression gate.
 	// (A higher ratio means less dedup, i.e. a regression.)
-	if rb.dedupRatio() > ra.dedupRatio()*(1+*tol) {
+	regression := rb.dedupRatio() > ra.dedupRatio()*(1+*tol)
+
+	switch *format {
+	case "json":
+		err = emitJSON(os.Stdout, compareJSON{
+			header:     newHeader("compare"),
+			Options:    o.json(),
+			Tolerance:  *tol,
+			Baseline:   ra.json(),
+			Candidate:  rb.json(),
+			Regression: regression,
+		})
+	case "csv":
+		err = writeResultsCSV(os.Stdout, ra, rb)
+	default:
+		printComparison(ra, rb)
+	}
+	if err != nil {
+		return err
+	}
+
+	if regression {
 		return fmt.Errorf("dedup regression: %s ratio %.4f exceeds %s %.4f by more than %.0f%%",
 			*b, rb.dedupRatio(), *a, ra.dedupRatio(), *tol*100)
 	}
 	return nil
 }
 
+type compareJSON struct {
+	header
+	Options    optsJSON   `json:"options"`
+	Tolerance  float64    `json:"tolerance"`
+	Baseline   resultJSON `json:"baseline"`
+	Candidate  resultJSON `json:"candidate"`
+	Regression bool       `json:"regression"`
+}
+
 func printComparison(a, b *result) {
 	amn, ap50, aavg, ap95, amx, astd := a.distribution()
 	bmn, bp50, bavg, bp95, bmx, bstd := b.distribution()
@@ -78,4 +114,7 @@ func printComparison(a, b *result) {
 	fmt.Printf("%-16s %18.1f %18.1f %10s\n", "throughput MB/s", a.throughputMBs(), b.throughputMBs(), delta(a.throughputMBs(), b.throughputMBs()))
 	fmt.Printf("\n  %s size: min=%d p50=%d p95=%d max=%d\n", a.algorithm, amn, ap50, ap95, amx)
 	fmt.Printf("  %s size: min=%d p50=%d p95=%d max=%d\n", b.algorithm, bmn, bp50, bp95, bmx)
+	if a.sampleShift != 0 || b.sampleShift != 0 {
+		fmt.Printf("\n  dedup ratios estimated from a sample of chunk digests; raise -mem for exact figures\n")
+	}
 }
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// dedupEntrySize is a rough per-entry cost of a dedupSet, map overhead
+// included, used to turn a memory budget into an entry limit.
+const dedupEntrySize = 64
+
+type dedupEntry struct {
+	length uint32
+	saved  uint32 // bytes saved by delta-encoding the chunk, if any
+	kind   uint32 // caller-defined class of the input that introduced the chunk
+}
+
+// kindSums are the sampled unique figures of one kind of input.
+type kindSums struct {
+	chunks int64
+	bytes  int64
+}
+
+// dedupSet is the set of distinct chunk digests seen so far, bounded in
+// memory. It holds every digest until it reaches its limit, and from then on
+// keeps a uniform sample: only digests whose low shift bits are zero, with
+// shift raised (and the set thinned) every time the limit is hit again. Since
+// chunk digests are uniformly distributed, the sample scaled by 2^shift is an
+// unbiased estimate of the full set, and a repeated chunk is either always or
+// never sampled, so dedup within the sample is exact. Below the limit nothing
+// is ever estimated.
+type dedupSet struct {
+	entries map[[32]byte]dedupEntry
+	limit   int // 0 means unbounded
+	shift   uint
+
+	bytes  int64 // sums over the sampled entries
+	saved  int64
+	deltas int
+	kinds  []kindSums
+}
+
+func newDedupSet(limit int) *dedupSet {
+	return &dedupSet{entries: make(map[[32]byte]dedupEntry), limit: limit}
+}
+
+func sampleKey(digest [32]byte) uint64 {
+	return binary.LittleEndian.Uint64(digest[:8])
+}
+
+// sampled reports whether digest belongs to the sample at the given shift.
+func sampled(digest [32]byte, shift uint) bool {
+	return sampleKey(digest)&(1<<shift-1) == 0
+}
+
+// add records a chunk and reports whether it is new to the (sampled) set.
+// Chunks outside the sample are never new. A new chunk is accounted to kind,
+// so that unique figures can be broken down by the kind of input that first
+// brought each chunk.
+func (s *dedupSet) add(digest [32]byte, length, kind int) bool {
+	if !sampled(digest, s.shift) {
+		return false
+	}
+	if _, ok := s.entries[digest]; ok {
+		return false
+	}
+	s.entries[digest] = dedupEntry{length: uint32(length), kind: uint32(kind)}
+	s.bytes += int64(length)
+	for len(s.kinds) <= kind {
+		s.kinds = append(s.kinds, kindSums{})
+	}
+	s.kinds[kind].chunks++
+	s.kinds[kind].bytes += int64(length)
+	if s.limit != 0 && len(s.entries) > s.limit {
+		s.thin()
+	}
+	return true
+}
+
+// setSaved records the delta-encoding savings of a chunk just added.
+func (s *dedupSet) setSaved(digest [32]byte, saved int) {
+	e, ok := s.entries[digest]
+	if !ok || saved <= 0 {
+		return
+	}
+	if e.saved == 0 {
+		s.deltas++
+	}
+	s.saved += int64(saved) - int64(e.saved)
+	e.saved = uint32(saved)
+	s.entries[digest] = e
+}
+
+// thin halves the sampling rate until the set fits its limit again.
+func (s *dedupSet) thin() {
+	for len(s.entries) > s.limit {
+		s.shift++
+		for d, e := range s.entries {
+			if !sampled(d, s.shift) {
+				s.drop(d, e)
+			}
+		}
+	}
+}
+
+func (s *dedupSet) drop(digest [32]byte, e dedupEntry) {
+	delete(s.entries, digest)
+	s.bytes -= int64(e.length)
+	s.saved -= int64(e.saved)
+	s.kinds[e.kind].chunks--
+	s.kinds[e.kind].bytes -= int64(e.length)
+	if e.saved != 0 {
+		s.deltas--
+	}
+}
+
+func (s *dedupSet) contains(digest [32]byte) bool {
+	_, ok := s.entries[digest]
+	return ok
+}
+
+func (s *dedupSet) scale(n int64) int64 { return n << s.shift }
+
+func (s *dedupSet) uniqueChunks() int  { return int(s.scale(int64(len(s.entries)))) }
+func (s *dedupSet) uniqueBytes() int64 { return s.scale(s.bytes) }
+func (s *dedupSet) deltaChunks() int   { return int(s.scale(int64(s.deltas))) }
+func (s *dedupSet) deltaSaved() int64  { return s.scale(s.saved) }
+
+// kind returns the estimated unique chunks and bytes introduced by kind.
+func (s *dedupSet) kind(kind int) (chunks int, bytes int64) {
+	if kind >= len(s.kinds) {
+		return 0, 0
+	}
+	return int(s.scale(s.kinds[kind].chunks)), s.scale(s.kinds[kind].bytes)
+}
+
+// sizeHistogram accumulates chunk lengths for the size distribution. Lengths
+// are bounded by the chunker's MaxSize, so counting each distinct length is
+// at once a bounded streaming sketch and exact: quantiles come out the same
+// as from the sorted list of every length.
+type sizeHistogram struct {
+	counts map[int]int64
+	n      int64
+	sum    int64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{counts: make(map[int]int64)}
+}
+
+func (h *sizeHistogram) add(length int) {
+	h.counts[length]++
+	h.n++
+	h.sum += int64(length)
+}
+
+// distribution returns min/p50/avg/p95/max and the standard deviation, with
+// the quantiles picked at the same ranks as indexing a sorted slice.
+func (h *sizeHistogram) distribution() (mn, p50, avg, p95, mx int, stddev float64) {
+	if h.n == 0 {
+		return
+	}
+	lengths := make([]int, 0, len(h.counts))
+	for l := range h.counts {
+		lengths = append(lengths, l)
+	}
+	sort.Ints(lengths)
+	mn = lengths[0]
+	mx = lengths[len(lengths)-1]
+
+	at := func(rank int64) int {
+		var seen int64
+		for _, l := range lengths {
+			seen += h.counts[l]
+			if rank < seen {
+				return l
+			}
+		}
+		return mx
+	}
+	p50 = at(h.n * 50 / 100)
+	p95 = at(h.n * 95 / 100)
+
+	mean := float64(h.sum) / float64(h.n)
+	avg = int(mean)
+	var sq float64
+	for _, l := range lengths {
+		d := float64(l) - mean
+		sq += float64(h.counts[l]) * d * d
+	}
+	stddev = math.Sqrt(sq / float64(h.n))
+	return
+}
+
+// buckets returns every distinct length with its count, shortest first.
+func (h *sizeHistogram) buckets() []sizeCount {
+	out := make([]sizeCount, 0, len(h.counts))
+	for l, n := range h.counts {
+		out = append(out, sizeCount{Length: l, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Length < out[j].Length })
+	return out
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// diff shows two versions of a file in chunk terms: which ranges of the new
+// version are carried by chunks the old one already had, which are new, and
+// so what a chunk-based sync would actually transfer. Unlike resync, the
+// edits are whatever happened between two real files.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	chunker := fs.String("chunker", "fastcdc-v1.0.0", "chunking algorithm")
+	script := fs.String("script", "", "also write the JSON edit script to this file (- for stdout, instead of the report)")
+	var o opts
+	o.register(fs)
+	format := registerFormat(fs, true)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 2 {
+		return fmt.Errorf("usage: cdc diff -chunker NAME OLD NEW")
+	}
+	if paths[0] == "-" && paths[1] == "-" {
+		return fmt.Errorf("stdin (-) given more than once")
+	}
+
+	oldf, err := openInput(paths[0])
+	if err != nil {
+		return err
+	}
+	defer oldf.Close()
+	newf, err := openInput(paths[1])
+	if err != nil {
+		return err
+	}
+	defer newf.Close()
+
+	d, err := diffFiles(*chunker, oldf, newf, &o)
+	if err != nil {
+		return err
+	}
+
+	if *script != "" {
+		w := io.Writer(os.Stdout)
+		if *script != "-" {
+			f, err := os.Create(*script)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := emitJSON(w, editScriptJSON{header: newHeader("diff-script"), Algorithm: *chunker,
+			Options: o.json(), NewBytes: d.NewBytes, Ops: d.script}); err != nil {
+			return err
+		}
+		if *script == "-" {
+			return nil
+		}
+	}
+
+	switch *format {
+	case "json":
+		return emitJSON(os.Stdout, diffJSON{header: newHeader("diff"), Algorithm: *chunker,
+			Options: o.json(), Old: paths[0], New: paths[1], diffResult: d})
+	case "csv":
+		return writeDiffCSV(os.Stdout, d)
+	}
+	printDiff(paths[0], paths[1], d)
+	return nil
+}
+
+// Region kinds. In the new file a region is shared (its chunks are in the
+// old file), repeat (its chunks appeared earlier in the new file only) or
+// new; in the old file it is kept or removed.
+const (
+	regionShared  = "shared"
+	regionRepeat  = "repeat"
+	regionNew     = "new"
+	regionKept    = "kept"
+	regionRemoved = "removed"
+)
+
+// diffRegion is a run of consecutive chunks of the same kind.
+type diffRegion struct {
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Kind   string `json:"kind"`
+	Chunks int    `json:"chunks"`
+}
+
+// editOp rebuilds the new file range [Offset, Offset+Length): a copy takes it
+// from Source ("old", or "new" for a range already rebuilt) at SourceOffset,
+// an insert takes it from the new file itself, which is what gets transferred.
+// An insert has no source: SourceOffset is nil, and left out rather than 0,
+// which is a real offset.
+type editOp struct {
+	Op           string `json:"op"`
+	Offset       int64  `json:"offset"`
+	Length       int64  `json:"length"`
+	Source       string `json:"source,omitempty"`
+	SourceOffset *int64 `json:"source_offset,omitempty"`
+}
+
+type diffResult struct {
+	OldBytes       int64        `json:"old_bytes"`
+	OldChunks      int          `json:"old_chunks"`
+	NewBytes       int64        `json:"new_bytes"`
+	NewChunks      int          `json:"new_chunks"`
+	SharedBytes    int64        `json:"shared_bytes"`
+	RepeatBytes    int64        `json:"repeat_bytes"`
+	TransferBytes  int64        `json:"transfer_bytes"`
+	TransferChunks int          `json:"transfer_chunks"`
+	RemovedBytes   int64        `json:"removed_bytes"`
+	NewRegions     []diffRegion `json:"new_regions"`
+	OldRegions     []diffRegion `json:"old_regions"`
+
+	script []editOp
+}
+
+type diffJSON struct {
+	header
+	Algorithm string   `json:"algorithm"`
+	Options   optsJSON `json:"options"`
+	Old       string   `json:"old"`
+	New       string   `json:"new"`
+	*diffResult
+}
+
+type editScriptJSON struct {
+	header
+	Algorithm string   `json:"algorithm"`
+	Options   optsJSON `json:"options"`
+	NewBytes  int64    `json:"new_bytes"`
+	Ops       []editOp `json:"ops"`
+}
+
+type oldChunk struct {
+	offset int64
+	length int
+	first  int // index of the first chunk with the same digest
+	used   bool
+}
+
+// diffFiles chunks both versions, each read once as a stream. The old side
+// is indexed by digest, a few dozen bytes per chunk; the new side is
+// classified chunk by chunk against it.
+func diffFiles(algo string, oldr, newr io.Reader, o *opts) (*diffResult, error) {
+	d := &diffResult{}
+	var olds []oldChunk
+	index := make(map[[32]byte]int)
+	err := eachChunk(algo, oldr, o, func(offset int64, chunk []byte) {
+		digest := sha256.Sum256(chunk)
+		first, ok := index[digest]
+		if !ok {
+			first = len(olds)
+			index[digest] = first
+		}
+		olds = append(olds, oldChunk{offset: offset, length: len(chunk), first: first})
+		d.OldBytes += int64(len(chunk))
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.OldChunks = len(olds)
+
+	seen := make(map[[32]byte]int64) // new-only chunks, by first offset
+	err = eachChunk(algo, newr, o, func(offset int64, chunk []byte) {
+		length := int64(len(chunk))
+		digest := sha256.Sum256(chunk)
+		d.NewBytes += length
+		d.NewChunks++
+
+		if i, ok := index[digest]; ok {
+			olds[i].used = true
+			d.SharedBytes += length
+			d.addRegion(&d.NewRegions, offset, length, regionShared)
+			d.addOp(editOp{Op: "copy", Offset: offset, Length: length, Source: "old", SourceOffset: &olds[i].offset})
+		} else if first, ok := seen[digest]; ok {
+			d.RepeatBytes += length
+			d.addRegion(&d.NewRegions, offset, length, regionRepeat)
+			d.addOp(editOp{Op: "copy", Offset: offset, Length: length, Source: "new", SourceOffset: &first})
+		} else {
+			seen[digest] = offset
+			d.TransferBytes += length
+			d.TransferChunks++
+			d.addRegion(&d.NewRegions, offset, length, regionNew)
+			d.addOp(editOp{Op: "insert", Offset: offset, Length: length})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A chunk repeated in the old file is kept if any copy of it is used.
+	for i := range olds {
+		kind := regionRemoved
+		if olds[olds[i].first].used {
+			kind = regionKept
+		}
+		d.addRegion(&d.OldRegions, olds[i].offset, int64(olds[i].length), kind)
+	}
+	for _, r := range d.OldRegions {
+		if r.Kind == regionRemoved {
+			d.RemovedBytes += r.Length
+		}
+	}
+	return d, nil
+}
+
+func (d *diffResult) addRegion(regions *[]diffRegion, offset, length int64, kind string) {
+	if n := len(*regions); n != 0 && (*regions)[n-1].Kind == kind {
+		(*regions)[n-1].Length += length
+		(*regions)[n-1].Chunks++
+		return
+	}
+	*regions = append(*regions, diffRegion{Offset: offset, Length: length, Kind: kind, Chunks: 1})
+}
+
+// addOp appends op, merged into the previous one when it simply continues it.
+func (d *diffResult) addOp(op editOp) {
+	if n := len(d.script); n != 0 {
+		last := &d.script[n-1]
+		if last.Op == op.Op && last.Source == op.Source &&
+			(op.Op == "insert" || *last.SourceOffset+last.Length == *op.SourceOffset) {
+			last.Length += op.Length
+			return
+		}
+	}
+	d.script = append(d.script, op)
+}
+
+// eachChunk calls fn with every chunk of r and its offset.
+func eachChunk(algo string, r io.Reader, o *opts, fn func(offset int64, chunk []byte)) error {
+	ch, err := chunkers.NewChunker(algo, r, o.chunkerOpts())
+	if err != nil {
+		return err
+	}
+	var offset int64
+	for {
+		chunk, err := ch.Next()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(chunk) != 0 {
+			fn(offset, chunk)
+			offset += int64(len(chunk))
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func printDiff(oldPath, newPath string, d *diffResult) {
+	pct := func(n, of int64) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+
+	fmt.Printf("old: %s, %s in %d chunk(s)\n", oldPath, humanBytes(d.OldBytes), d.OldChunks)
+	fmt.Printf("new: %s, %s in %d chunk(s)\n\n", newPath, humanBytes(d.NewBytes), d.NewChunks)
+
+	fmt.Printf("new file regions:\n")
+	fmt.Printf("  %14s %14s %8s  %s\n", "offset", "length", "chunks", "kind")
+	for _, r := range d.NewRegions {
+		fmt.Printf("  %14d %14d %8d  %s\n", r.Offset, r.Length, r.Chunks, r.Kind)
+	}
+	fmt.Printf("\nold file regions:\n")
+	fmt.Printf("  %14s %14s %8s  %s\n", "offset", "length", "chunks", "kind")
+	for _, r := range d.OldRegions {
+		fmt.Printf("  %14d %14d %8d  %s\n", r.Offset, r.Length, r.Chunks, r.Kind)
+	}
+
+	fmt.Printf("\nshared:   %s (%.2f%% of new) in chunks the old file has\n", humanBytes(d.SharedBytes), pct(d.SharedBytes, d.NewBytes))
+	if d.RepeatBytes != 0 {
+		fmt.Printf("repeated: %s (%.2f%%) in chunks seen earlier in the new file\n", humanBytes(d.RepeatBytes), pct(d.RepeatBytes, d.NewBytes))
+	}
+	fmt.Printf("transfer: %s (%.2f%% of new) in %d chunk(s)\n", humanBytes(d.TransferBytes), pct(d.TransferBytes, d.NewBytes), d.TransferChunks)
+	fmt.Printf("removed:  %s (%.2f%% of old) no longer referenced\n", humanBytes(d.RemovedBytes), pct(d.RemovedBytes, d.OldBytes))
+}
+
+// writeDiffCSV writes the regions of both files, one per row.
+func writeDiffCSV(w io.Writer, d *diffResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "offset", "length", "chunks", "kind"})
+	for _, side := range []struct {
+		name    string
+		regions []diffRegion
+	}{{"new", d.NewRegions}, {"old", d.OldRegions}} {
+		for _, r := range side.regions {
+			cw.Write([]string{side.name, itoa(r.Offset), itoa(r.Length), itoa(r.Chunks), r.Kind})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
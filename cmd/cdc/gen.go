@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
+	// Imported as workload: corpus names the input interface of this command.
+	workload "github.com/PlakarKorp/go-cdc-chunkers/corpus"
+)
+
+// gen writes a synthetic workload from the corpus package, so that a figure
+// measured on it can be reproduced anywhere from the kind, size and seed. A
+// single workload goes to stdout or -out; a versioned series goes to files
+// v0, v1, ... in the -out directory.
+func runGen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	var kinds []string
+	for _, k := range workload.Kinds() {
+		kinds = append(kinds, string(k))
+	}
+	kind := fs.String("kind", "random", "workload: "+strings.Join(kinds, ", "))
+	size := byteSize(64 << 20)
+	fs.Var(&size, "size", "bytes to generate, of version 0 for a series (K, M, G suffixes)")
+	seed := fs.Int64("seed", 1, "PRNG seed")
+	out := fs.String("out", "-", "output file, - for stdout; the directory of a series")
+	versions := fs.Int("versions", 1, "versions of the file, each edited from the previous one")
+	rate := fs.Float64("edit-rate", 0.01, "fraction of bytes edited between versions")
+	model := fs.String("model", "insert,delete,overwrite", "edit mixture, as for resync")
+	editSize := fs.Int("edit-size", 64, "bytes inserted, deleted, overwritten or moved by each edit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: cdc gen -kind KIND [-size SIZE] [-seed N] [-out PATH]")
+	}
+	k, err := workload.ParseKind(*kind)
+	if err != nil {
+		return err
+	}
+
+	if *versions <= 1 {
+		rd, err := workload.New(k, int64(size), *seed)
+		if err != nil {
+			return err
+		}
+		return writeTo(*out, func(w io.Writer) error {
+			_, err := io.Copy(w, rd)
+			return err
+		})
+	}
+
+	if *out == "-" {
+		return fmt.Errorf("a series of versions needs -out DIR")
+	}
+	m, err := edits.ParseModel(*model)
+	if err != nil {
+		return err
+	}
+	m.Size = *editSize
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	return workload.Series(k, int64(size), *seed, *versions, *rate, m, func(i int, data []byte) error {
+		path := filepath.Join(*out, fmt.Sprintf("v%d", i))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", path, humanBytes(int64(len(data))))
+		return nil
+	})
+}
+
+// writeTo runs fn on a buffered writer to path, "-" standing for stdout.
+func writeTo(path string, fn func(io.Writer) error) error {
+	f := os.Stdout
+	if path != "-" {
+		var err error
+		if f, err = os.Create(path); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriterSize(f, 1<<20)
+	err := fn(bw)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if f != os.Stdout {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
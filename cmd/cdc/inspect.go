@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// inspect explains every cut point of a file: which mask matched, whether
+// MaxSize or the end of the stream forced the cut, and the fingerprint the
+// algorithm tested there. It is the tool for a chunk that looks wrong.
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	chunker := fs.String("chunker", "fastcdc-v1.0.0", "chunking algorithm")
+	summary := fs.Bool("summary", false, "only print the count of cuts per reason")
+	var o opts
+	o.register(fs)
+	format := registerFormat(fs, true)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 {
+		return fmt.Errorf("usage: cdc inspect -chunker NAME FILE")
+	}
+	in, err := openInput(paths[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Text and CSV stream one line per chunk; JSON needs them all first.
+	var emit func(inspectCut) error
+	var cuts []inspectCut
+	switch {
+	case *summary:
+	case *format == "json":
+		emit = func(c inspectCut) error { cuts = append(cuts, c); return nil }
+	case *format == "csv":
+		cw := csv.NewWriter(os.Stdout)
+		defer cw.Flush()
+		cw.Write([]string{"chunk", "offset", "length", "reason", "fingerprint", "jumps"})
+		emit = func(c inspectCut) error {
+			return cw.Write([]string{itoa(c.Index), strconv.FormatUint(c.Offset, 10), itoa(c.Length),
+				c.Reason, c.Fingerprint, itoa(c.Jumps)})
+		}
+	default:
+		fmt.Printf("%s: %s (min=%d normal=%d max=%d%s)\n\n", paths[0], *chunker, o.min, o.avg, o.max, keyNote(o.key))
+		fmt.Printf("%8s %14s %10s  %-14s %-18s %s\n", "chunk", "offset", "length", "reason", "fingerprint", "jumps")
+		emit = func(c inspectCut) error {
+			_, err := fmt.Printf("%8d %14d %10d  %-14s %-18s %d\n", c.Index, c.Offset, c.Length, c.Reason, c.Fingerprint, c.Jumps)
+			return err
+		}
+	}
+
+	reasons, err := inspect(*chunker, in, &o, emit)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		return emitJSON(os.Stdout, inspectJSON{header: newHeader("inspect"), Algorithm: *chunker,
+			Options: o.json(), File: paths[0], Reasons: reasons, Chunks: cuts})
+	case "csv":
+		if *summary {
+			cw := csv.NewWriter(os.Stdout)
+			cw.Write([]string{"reason", "chunks", "bytes"})
+			for _, r := range reasons {
+				cw.Write([]string{r.Reason, itoa(r.Chunks), itoa(r.Bytes)})
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+		return nil
+	}
+
+	var total int
+	for _, r := range reasons {
+		total += r.Chunks
+	}
+	if !*summary {
+		fmt.Println()
+	}
+	fmt.Printf("%-14s %10s %8s %12s\n", "reason", "chunks", "%", "bytes")
+	for _, r := range reasons {
+		fmt.Printf("%-14s %10d %7.2f%% %12s\n", r.Reason, r.Chunks, 100*float64(r.Chunks)/float64(total), humanBytes(r.Bytes))
+	}
+	return nil
+}
+
+type inspectCut struct {
+	Index       int    `json:"chunk"`
+	Offset      uint64 `json:"offset"`
+	Length      int    `json:"length"`
+	Reason      string `json:"reason"`
+	Fingerprint string `json:"fingerprint"` // hex
+	Jumps       int    `json:"jumps"`
+}
+
+type reasonCount struct {
+	Reason string `json:"reason"`
+	Chunks int    `json:"chunks"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type inspectJSON struct {
+	header
+	Algorithm string        `json:"algorithm"`
+	Options   optsJSON      `json:"options"`
+	File      string        `json:"file"`
+	Reasons   []reasonCount `json:"reasons"`
+	Chunks    []inspectCut  `json:"chunks,omitempty"`
+}
+
+// inspect chunks r with tracing on, calls emit (if set) for every cut and
+// returns the count of cuts per reason, in the order of chunkers.CutReason.
+func inspect(algo string, r io.Reader, o *opts, emit func(inspectCut) error) ([]reasonCount, error) {
+	ch, err := chunkers.NewChunker(algo, r, o.chunkerOpts())
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[chunkers.CutReason]*reasonCount)
+	var emitErr error
+	index := 0
+	ch.SetTrace(func(c chunkers.Cut) {
+		if c.Length == 0 || emitErr != nil {
+			return
+		}
+		rc := counts[c.Reason]
+		if rc == nil {
+			rc = &reasonCount{Reason: c.Reason.String()}
+			counts[c.Reason] = rc
+		}
+		rc.Chunks++
+		rc.Bytes += int64(c.Length)
+		if emit != nil {
+			emitErr = emit(inspectCut{Index: index, Offset: c.Offset, Length: c.Length, Reason: c.Reason.String(),
+				Fingerprint: fmt.Sprintf("%016x", c.Fingerprint), Jumps: c.Jumps})
+		}
+		index++
+	})
+	for {
+		_, err := ch.Next()
+		if emitErr != nil {
+			return nil, emitErr
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var reasons []reasonCount
+	for reason := chunkers.CutUnknown; reason <= chunkers.CutHint; reason++ {
+		if rc := counts[reason]; rc != nil {
+			reasons = append(reasons, *rc)
+		}
+	}
+	return reasons, nil
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"flag"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// registerKey adds the flags giving the key of keyed algorithms: -key-file,
+// -key-env and -key-hex, shared with the other tools. Reports only ever show
+// the key's fingerprint.
+func (o *opts) registerKey(fs *flag.FlagSet) {
+	keyflag.Register(fs, &o.key)
+}
+
+// keyNote is the ", key FINGERPRINT" suffix of text report headers.
+func keyNote(key []byte) string {
+	if key == nil {
+		return ""
+	}
+	return ", key " + keyflag.Fingerprint(key)
+}
@@ -20,9 +20,17 @@
 //
 // Subcommands:
 //
-//	cdc analyze  -chunker NAME [opts] FILE...
+//	cdc analyze  -chunker NAME [opts] [-similarity METHOD] FILE...
+//	cdc analyze  -chunker NAME [opts] -r [walk opts] DIR...
 //	cdc compare  -a NAME -b NAME [opts] FILE...
-//	cdc resync   -a NAME -b NAME [opts] [-edits N] FILE
+//	cdc resync   -a NAME -b NAME [opts] [-edits N] [-model MIX] [-trials N] FILE
+//	cdc tune     -chunker NAME[,NAME...] [opts] [-avgs LIST] FILE...
+//	cdc diff     -chunker NAME [opts] [-script FILE] OLD NEW
+//	cdc split    -chunker NAME [opts] FILE -out DIR
+//	cdc join     MANIFEST -store DIR > FILE
+//	cdc verify   -manifest MANIFEST FILE
+//	cdc inspect  -chunker NAME [opts] [-summary] FILE
+//	cdc gen      -kind KIND [-size SIZE] [-seed N] [-versions N -edit-rate F] [-out PATH]
 package main
 
 import (
@@ -34,14 +42,38 @@ func usage() {
 	fmt.Fprintf(os.Stderr, `cdc - analyze and compare content-defined chunkers
 
 usage:
-  cdc analyze -chunker NAME [-min N -avg N -max N] FILE...
+  cdc analyze -chunker NAME [-min N -avg N -max N] [-similarity broder|finesse] [-by-type] FILE...
+  cdc analyze -chunker NAME [-min N -avg N -max N] -r [-include GLOB] [-exclude GLOB]
+              [-symlinks skip|follow] [-max-file-size SIZE] DIR...
   cdc compare -a NAME -b NAME [-min N -avg N -max N] FILE...
-  cdc resync  -a NAME -b NAME [-min N -avg N -max N] [-edits N] [-edit-size N] FILE
+  cdc resync  -a NAME -b NAME [-min N -avg N -max N] [-edits N] [-edit-size N]
+              [-model insert|delete|overwrite|move|append|prepend[:W],...] [-cluster SIZE]
+              [-trials N] FILE
+  cdc tune    -chunker NAME[,NAME...] [-avgs LIST] [-min-div LIST] [-max-mul LIST]
+              [-entry-bytes N] [-j N] FILE...
+  cdc diff    -chunker NAME [-min N -avg N -max N] [-script FILE|-] OLD NEW
+  cdc split   -chunker NAME [-min N -avg N -max N] [-manifest PATH] FILE -out DIR
+  cdc join    MANIFEST -store DIR > FILE
+  cdc verify  -manifest MANIFEST [-context N] FILE
+  cdc inspect -chunker NAME [-min N -avg N -max N] [-summary] FILE
+  cdc gen     -kind random|low-entropy|zero-pages|text|vm-image|tar [-size SIZE] [-seed N]
+              [-versions N [-edit-rate F] [-model MIX] [-edit-size N]] [-out PATH|DIR]
 
 Common options:
   -min  minimum chunk size in bytes (default 2048)
   -avg  average/normal chunk size in bytes (default 8192)
   -max  maximum chunk size in bytes (default 65536)
+  -mem  memory budget for dedup state in MiB (default 1024, 0 for unbounded);
+        with -similarity, the delta bases take half of it
+  -key-file PATH, -key-env VAR, -key-hex HEX
+        32-byte key of keyed algorithms: raw in the file, hex-encoded in the
+        environment variable or on the command line; reports only show its
+        fingerprint; verify takes the key the same way
+  -format text|json|csv
+        output format; json is versioned (schema_version), csv is for the
+        tabular analyze/compare/resync/diff/inspect. join reports to stderr.
+
+Inputs are streamed; FILE may be - for stdin.
 `)
 }
 
@@ -59,6 +91,20 @@ func main() {
 		err = runCompare(os.Args[2:])
 	case "resync":
 		err = runResync(os.Args[2:])
+	case "tune":
+		err = runTune(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "split":
+		err = runSplit(os.Args[2:])
+	case "join":
+		err = runJoin(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "inspect":
+		err = runInspect(os.Args[2:])
+	case "gen":
+		err = runGen(os.Args[2:])
 	case "-h", "--help", "help":
 		usage()
 		return
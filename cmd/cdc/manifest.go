@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
+)
+
+// A manifest is the boundary profile of a file, written in the JSON encoding
+// of the profile package: a header with the algorithm and sizes, one line
+// per chunk, and a trailer with the size and SHA-256 of the whole file,
+// which join checks after reassembly. The chunk digests name the chunks in
+// the store. Being a profile, a manifest can be checked with cdcprofile, and
+// a profile in either encoding serves as a manifest.
+
+// storeChunks stores the chunks of a profile being generated as they are
+// pulled from it. The generator reads its input through a tee into pending,
+// so the bytes of each chunk are at the front of pending once it is cut.
+type storeChunks struct {
+	*profile.Generator
+	pending     bytes.Buffer
+	store       string
+	stored      int
+	storedBytes int64
+}
+
+func (sc *storeChunks) Next() (profile.Chunk, error) {
+	c, err := sc.Generator.Next()
+	if err != nil {
+		return c, err
+	}
+	isNew, err := writeChunk(sc.store, c.Digest, sc.pending.Next(c.Length))
+	if err != nil {
+		return profile.Chunk{}, err
+	}
+	if isNew {
+		sc.stored++
+		sc.storedBytes += int64(c.Length)
+	}
+	return c, nil
+}
+
+// chunkPath is where a chunk lives in a store directory. Chunks are spread
+// over 256 subdirectories by the first digest byte so that a store holding
+// millions of chunks stays usable.
+func chunkPath(store string, digest [sha256.Size]byte) string {
+	name := hex.EncodeToString(digest[:])
+	return filepath.Join(store, name[:2], name)
+}
+
+// writeChunk stores a chunk under its digest unless it is already there. It
+// writes to a temporary file and renames it so a crash never leaves a
+// partial chunk behind under a valid name. It reports whether the chunk was
+// new.
+func writeChunk(store string, digest [sha256.Size]byte, chunk []byte) (bool, error) {
+	path := chunkPath(store, digest)
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".chunk-*")
+	if err != nil {
+		return false, err
+	}
+	if _, err := tmp.Write(chunk); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// schemaVersion versions the machine-readable output of every subcommand.
+// Within a version, fields and CSV columns are only ever added, never
+// renamed, removed or reordered, so stored results stay comparable.
+const schemaVersion = 1
+
+// format is the -format flag shared by the subcommands.
+type format string
+
+func registerFormat(fs *flag.FlagSet, tabular bool) *format {
+	f := format("text")
+	usage := "output: text | json"
+	if tabular {
+		usage += " | csv"
+	}
+	fs.Func("format", usage+" (default text)", func(v string) error {
+		switch {
+		case v == "text", v == "json", v == "csv" && tabular:
+			f = format(v)
+			return nil
+		}
+		return fmt.Errorf("unsupported format %q", v)
+	})
+	return &f
+}
+
+// header opens every JSON document.
+type header struct {
+	Schema  int    `json:"schema_version"`
+	Command string `json:"command"`
+}
+
+func newHeader(command string) header {
+	return header{Schema: schemaVersion, Command: command}
+}
+
+type optsJSON struct {
+	MinSize    int    `json:"min_size"`
+	NormalSize int    `json:"normal_size"`
+	MaxSize    int    `json:"max_size"`
+	MemMiB     int    `json:"mem_mib"`
+	Similarity string `json:"similarity,omitempty"`
+	Keyed      bool   `json:"keyed,omitempty"`
+	Key        string `json:"key_fingerprint,omitempty"`
+}
+
+func (o *opts) json() optsJSON {
+	return optsJSON{MinSize: o.min, NormalSize: o.avg, MaxSize: o.max, MemMiB: o.mem, Similarity: o.similarity, Keyed: o.key != nil,
+		Key: keyflag.Fingerprint(o.key)}
+}
+
+type sizeCount struct {
+	Length int   `json:"length"`
+	Count  int64 `json:"count"`
+}
+
+type distributionJSON struct {
+	Min       int         `json:"min"`
+	P50       int         `json:"p50"`
+	Avg       int         `json:"avg"`
+	P95       int         `json:"p95"`
+	Max       int         `json:"max"`
+	Stddev    float64     `json:"stddev"`
+	Histogram []sizeCount `json:"histogram"` // every distinct chunk length
+}
+
+type typeJSON struct {
+	Type         string  `json:"type"`
+	Files        int     `json:"files"`
+	TotalBytes   int64   `json:"total_bytes"`
+	Chunks       int     `json:"chunks"`
+	UniqueBytes  int64   `json:"unique_bytes"`
+	UniqueChunks int     `json:"unique_chunks"`
+	DedupRatio   float64 `json:"dedup_ratio"`
+}
+
+type resultJSON struct {
+	Algorithm     string           `json:"algorithm"`
+	TotalBytes    int64            `json:"total_bytes"`
+	Chunks        int              `json:"chunks"`
+	UniqueBytes   int64            `json:"unique_bytes"`
+	UniqueChunks  int              `json:"unique_chunks"`
+	DedupRatio    float64          `json:"dedup_ratio"`
+	DeltaChunks   int              `json:"delta_chunks"`
+	DeltaSaved    int64            `json:"delta_saved"`
+	DeltaRatio    float64          `json:"delta_ratio"`
+	SampleRate    int64            `json:"sample_rate"` // 1 when dedup figures are exact, else 1 in N
+	ElapsedSec    float64          `json:"elapsed_sec"`
+	ThroughputMBs float64          `json:"throughput_mb_s"`
+	Distribution  distributionJSON `json:"distribution"`
+	Types         []typeJSON       `json:"types,omitempty"`
+}
+
+func (r *result) json() resultJSON {
+	mn, p50, avg, p95, mx, stddev := r.distribution()
+	out := resultJSON{
+		Algorithm:     r.algorithm,
+		TotalBytes:    r.totalBytes,
+		Chunks:        r.chunks,
+		UniqueBytes:   r.uniqueBytes,
+		UniqueChunks:  r.uniqueChunk,
+		DedupRatio:    r.dedupRatio(),
+		DeltaChunks:   r.deltaChunks,
+		DeltaSaved:    r.deltaSaved,
+		DeltaRatio:    r.deltaRatio(),
+		SampleRate:    1 << r.sampleShift,
+		ElapsedSec:    r.duration.Seconds(),
+		ThroughputMBs: r.throughputMBs(),
+		Distribution: distributionJSON{
+			Min: mn, P50: p50, Avg: avg, P95: p95, Max: mx, Stddev: stddev,
+			Histogram: r.sizes.buckets(),
+		},
+	}
+	for _, t := range r.types {
+		out.Types = append(out.Types, typeJSON{
+			Type:         t.name,
+			Files:        t.files,
+			TotalBytes:   t.totalBytes,
+			Chunks:       t.chunks,
+			UniqueBytes:  t.uniqueBytes,
+			UniqueChunks: t.uniqueChunk,
+			DedupRatio:   t.dedupRatio(),
+		})
+	}
+	return out
+}
+
+func emitJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// resultColumns is the CSV layout of analyze and compare: one row for the
+// whole corpus (type "*") per algorithm, then one per file type when broken
+// down, which leaves the distribution columns empty.
+var resultColumns = []string{
+	"algorithm", "type", "files", "total_bytes", "chunks", "unique_bytes", "unique_chunks", "dedup_ratio",
+	"delta_chunks", "delta_saved", "delta_ratio", "sample_rate",
+	"min", "p50", "avg", "p95", "max", "stddev", "elapsed_sec", "throughput_mb_s",
+}
+
+func writeResultsCSV(w io.Writer, results ...*result) error {
+	cw := csv.NewWriter(w)
+	cw.Write(resultColumns)
+	for _, r := range results {
+		mn, p50, avg, p95, mx, stddev := r.distribution()
+		cw.Write([]string{
+			r.algorithm, "*", "", itoa(r.totalBytes), itoa(r.chunks), itoa(r.uniqueBytes), itoa(r.uniqueChunk), ftoa(r.dedupRatio()),
+			itoa(r.deltaChunks), itoa(r.deltaSaved), ftoa(r.deltaRatio()), itoa(int64(1) << r.sampleShift),
+			itoa(mn), itoa(p50), itoa(avg), itoa(p95), itoa(mx), ftoa(stddev), ftoa(r.duration.Seconds()), ftoa(r.throughputMBs()),
+		})
+		for _, t := range r.types {
+			cw.Write([]string{
+				r.algorithm, t.name, itoa(t.files), itoa(t.totalBytes), itoa(t.chunks), itoa(t.uniqueBytes), itoa(t.uniqueChunk), ftoa(t.dedupRatio()),
+				"", "", "", itoa(int64(1) << r.sampleShift),
+				"", "", "", "", "", "", "", "",
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func itoa[T int | int64](v T) string { return strconv.FormatInt(int64(v), 10) }
+
+func ftoa(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
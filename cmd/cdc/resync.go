@@ -17,14 +17,16 @@
 package main
 
 import (
-	"bytes"
 	"crypto/sha256"
+	"encoding/csv"
 	"flag"
 	"fmt"
 	"io"
-	"math/rand"
+	"os"
+	"time"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
 )
 
 // resync measures the property that actually makes content-defined chunking
@@ -40,77 +42,221 @@ func runResync(args []string) error {
 	fs := flag.NewFlagSet("resync", flag.ExitOnError)
 	a := fs.String("a", "fastcdc-v1.0.0", "baseline algorithm")
 	b := fs.String("b", "fastcdc-v2.0.0", "candidate algorithm")
-	edits := fs.Int("edits", 16, "number of random edits to apply")
-	editSize := fs.Int("edit-size", 1, "bytes inserted at each edit (insertion shifts the tail)")
+	n := fs.Int("edits", 16, "number of random edits to apply")
+	editSize := fs.Int("edit-size", 1, "bytes inserted, deleted, overwritten or moved by each edit")
+	model := fs.String("model", "insert", "edit mixture: insert, delete, overwrite, move, append, prepend, weighted as insert:3,delete:1")
+	var cluster byteSize
+	fs.Var(&cluster, "cluster", "keep all edits within this many bytes of the first (K, M suffixes), 0 to spread them")
+	trials := fs.Int("trials", 1, "independent trials, with seeds seed, seed+1, ...")
 	seed := fs.Int64("seed", 1, "PRNG seed for edit positions")
 	var o opts
 	o.register(fs)
+	format := registerFormat(fs, true)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if *trials < 1 {
+		return fmt.Errorf("-trials must be at least 1")
+	}
+	m, err := edits.ParseModel(*model)
+	if err != nil {
+		return err
+	}
+	m.Size, m.Cluster = *editSize, int64(cluster)
 
-	paths := fs.Args()
+	paths, cleanup, err := spoolStdin(fs.Args())
+	defer cleanup()
+	if err != nil {
+		return err
+	}
 	if len(paths) != 1 {
 		return fmt.Errorf("resync takes exactly one file")
 	}
-	files, err := readFiles(paths)
+	st, err := os.Stat(paths[0])
 	if err != nil {
 		return err
 	}
-	orig := files[0]
-	edited := applyInsertions(orig, *edits, *editSize, *seed)
-
-	fmt.Printf("file: %s, %d insertion(s) of %d byte(s) => edited %s\n\n",
-		humanBytes(int64(len(orig))), *edits, *editSize, humanBytes(int64(len(edited))))
+	plans := make([]edits.Plan, *trials)
+	var editedBytes int64
+	for i := range plans {
+		if plans[i], err = m.Plan(st.Size(), *n, *seed+int64(i)); err != nil {
+			return err
+		}
+		editedBytes += plans[i].Size()
+	}
 
-	fmt.Printf("%-16s %12s %12s %12s\n", "algorithm", "shared%", "chunks(o)", "chunks(e)")
+	out := resyncJSON{
+		header:      newHeader("resync"),
+		Options:     o.json(),
+		FileBytes:   st.Size(),
+		Edits:       *n,
+		EditSize:    *editSize,
+		Seed:        *seed,
+		EditedBytes: editedBytes / int64(len(plans)),
+		Model:       m.String(),
+		Cluster:     m.Cluster,
+		Trials:      len(plans),
+	}
 	for _, algo := range []string{*a, *b} {
-		shared, no, ne, err := resyncShared(algo, orig, edited, &o)
+		start := time.Now()
+		row, err := resyncFile(algo, paths[0], plans, *n, &o)
 		if err != nil {
 			return fmt.Errorf("%s: %w", algo, err)
 		}
-		fmt.Printf("%-16s %11.2f%% %12d %12d\n", algo, 100*shared, no, ne)
+		row.ElapsedSec = time.Since(start).Seconds()
+		out.Results = append(out.Results, *row)
+	}
+
+	switch *format {
+	case "json":
+		return emitJSON(os.Stdout, out)
+	case "csv":
+		cw := csv.NewWriter(os.Stdout)
+		cw.Write([]string{"algorithm", "shared", "chunks_orig", "chunks_edited", "elapsed_sec",
+			"shared_ci95", "lost_chunks", "new_chunks", "damage_per_edit", "damage_ci95"})
+		for _, r := range out.Results {
+			cw.Write([]string{r.Algorithm, ftoa(r.Shared), itoa(r.ChunksOrig), itoa(r.ChunksEdited), ftoa(r.ElapsedSec),
+				ftoa(r.SharedCI95), ftoa(r.LostChunks), ftoa(r.NewChunks), ftoa(r.DamagePerEdit), ftoa(r.DamageCI95)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	fmt.Printf("file: %s, %d edit(s) of %d byte(s), model %s", humanBytes(st.Size()), *n, *editSize, m)
+	if m.Cluster > 0 {
+		fmt.Printf(" clustered within %s", humanBytes(m.Cluster))
+	}
+	fmt.Printf(" => edited %s", humanBytes(out.EditedBytes))
+	if len(plans) > 1 {
+		fmt.Printf(" (mean of %d trials)", len(plans))
+	}
+	fmt.Printf("\n\n")
+
+	fmt.Printf("%-16s %12s %9s %12s %12s %12s\n", "algorithm", "shared%", "±95%", "chunks(o)", "chunks(e)", "damage/edit")
+	for _, r := range out.Results {
+		fmt.Printf("%-16s %11.2f%% %8.2f%% %12d %12d %12.2f\n", r.Algorithm, 100*r.Shared, 100*r.SharedCI95,
+			r.ChunksOrig, r.ChunksEdited, r.DamagePerEdit)
 	}
 
 	fmt.Printf("\nshared%% = fraction of the edited file's bytes carried by chunks\n")
 	fmt.Printf("identical to ones in the original (higher is better resync/dedup).\n")
+	fmt.Printf("damage/edit = chunks of the original each edit invalidated (lower is better).\n")
 	return nil
 }
 
-// resyncShared chunks both versions and returns the fraction of the edited
-// file's bytes that live in chunks whose digest also appears in the original.
-func resyncShared(algo string, orig, edited []byte, o *opts) (shared float64, nOrig, nEdited int, err error) {
-	origSet, _, err := chunkDigests(algo, orig, o)
+type resyncJSON struct {
+	header
+	Options     optsJSON    `json:"options"`
+	FileBytes   int64       `json:"file_bytes"`
+	Edits       int         `json:"edits"`
+	EditSize    int         `json:"edit_size"`
+	Seed        int64       `json:"seed"`
+	EditedBytes int64       `json:"edited_bytes"` // mean over the trials
+	Results     []resyncRow `json:"results"`
+	Model       string      `json:"model"`
+	Cluster     int64       `json:"cluster"`
+	Trials      int         `json:"trials"`
+}
+
+// resyncRow holds the means over the trials, with the half-width of their
+// 95% confidence interval (0 for a single trial).
+type resyncRow struct {
+	Algorithm     string  `json:"algorithm"`
+	Shared        float64 `json:"shared"` // fraction of the edited bytes in chunks of the original
+	ChunksOrig    int     `json:"chunks_orig"`
+	ChunksEdited  int     `json:"chunks_edited"`
+	ElapsedSec    float64 `json:"elapsed_sec"`
+	SharedCI95    float64 `json:"shared_ci95"`
+	LostChunks    float64 `json:"lost_chunks"` // chunks of the original absent from the edited file
+	NewChunks     float64 `json:"new_chunks"`  // chunks of the edited file absent from the original
+	DamagePerEdit float64 `json:"damage_per_edit"`
+	DamageCI95    float64 `json:"damage_ci95"`
+}
+
+// resyncFile chunks path once, then streams it through every plan and
+// measures how well algo resynchronises.
+func resyncFile(algo, path string, plans []edits.Plan, n int, o *opts) (*resyncRow, error) {
+	orig, err := os.Open(path)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
-	editedSet, editedBytes, err := chunkDigests(algo, edited, o)
+	defer orig.Close()
+	origSet, _, err := chunkDigests(algo, orig, o)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
+	}
+
+	row := &resyncRow{Algorithm: algo, ChunksOrig: origSet.uniqueChunks()}
+	var shared, damage []float64
+	var chunksEdited int
+	for _, plan := range plans {
+		editedSet, editedBytes, err := chunkDigests(algo, plan.Reader(orig), o)
+		if err != nil {
+			return nil, err
+		}
+		t := compareResync(origSet, editedSet, editedBytes)
+		shared = append(shared, t.shared)
+		if n > 0 {
+			damage = append(damage, float64(t.lost)/float64(n))
+		}
+		chunksEdited += t.nEdited
+		row.LostChunks += float64(t.lost) / float64(len(plans))
+		row.NewChunks += float64(t.added) / float64(len(plans))
 	}
+	row.ChunksEdited = chunksEdited / len(plans)
+	row.Shared, row.SharedCI95 = edits.MeanCI95(shared)
+	row.DamagePerEdit, row.DamageCI95 = edits.MeanCI95(damage)
+	return row, nil
+}
 
+// resyncTrial compares one edited file with the original.
+type resyncTrial struct {
+	shared         float64
+	nOrig, nEdited int
+	lost, added    int // distinct chunks only on one side
+}
+
+// compareResync compares the two sets at the coarser of their sampling
+// rates: a digest sampled there is sampled in both, so its presence is
+// exact.
+func compareResync(origSet, editedSet *dedupSet, editedBytes int64) resyncTrial {
+	t := resyncTrial{nOrig: origSet.uniqueChunks(), nEdited: editedSet.uniqueChunks()}
+	shift := max(origSet.shift, editedSet.shift)
 	var sharedBytes int64
-	for d, ln := range editedSet {
-		if _, ok := origSet[d]; ok {
-			sharedBytes += int64(ln) // ln is the (constant) length for this digest
+	for d, e := range editedSet.entries {
+		if !sampled(d, shift) {
+			continue
+		}
+		if origSet.contains(d) {
+			sharedBytes += int64(e.length) // the (constant) length for this digest
+		} else {
+			t.added++
+		}
+	}
+	for d := range origSet.entries {
+		if sampled(d, shift) && !editedSet.contains(d) {
+			t.lost++
 		}
 	}
-	if editedBytes == 0 {
-		return 0, len(origSet), len(editedSet), nil
+	t.lost <<= shift
+	t.added <<= shift
+	sharedBytes <<= shift
+	if editedBytes != 0 {
+		t.shared = float64(sharedBytes) / float64(editedBytes)
 	}
-	return float64(sharedBytes) / float64(editedBytes), len(origSet), len(editedSet), nil
+	return t
 }
 
-// chunkDigests returns the set of distinct chunk digests (mapped to their
-// length) and the total bytes chunked. Because content-defined chunks of the
-// same digest always have the same length, storing one length per digest is
+// chunkDigests returns the set of distinct chunk digests (with their length)
+// and the total bytes chunked. Because content-defined chunks of the same
+// digest always have the same length, storing one length per digest is
 // exact.
-func chunkDigests(algo string, data []byte, o *opts) (map[[32]byte]int, int64, error) {
-	ch, err := chunkers.NewChunker(algo, bytes.NewReader(data), o.chunkerOpts())
+func chunkDigests(algo string, r io.Reader, o *opts) (*dedupSet, int64, error) {
+	ch, err := chunkers.NewChunker(algo, r, o.chunkerOpts())
 	if err != nil {
 		return nil, 0, err
 	}
-	set := make(map[[32]byte]int)
+	set := newDedupSet(o.dedupLimit())
 	var total int64
 	for {
 		chunk, err := ch.Next()
@@ -119,7 +265,7 @@ func chunkDigests(algo string, data []byte, o *opts) (map[[32]byte]int, int64, e
 		}
 		if len(chunk) != 0 {
 			total += int64(len(chunk))
-			set[sha256.Sum256(chunk)] = len(chunk)
+			set.add(sha256.Sum256(chunk), len(chunk), 0)
 		}
 		if err == io.EOF {
 			break
@@ -127,21 +273,3 @@ func chunkDigests(algo string, data []byte, o *opts) (map[[32]byte]int, int64, e
 	}
 	return set, total, nil
 }
-
-// applyInsertions returns a copy of data with n random single-position
-// insertions of editSize bytes. Insertions (rather than overwrites) shift the
-// tail, which is the hard case for chunk re-synchronisation.
-func applyInsertions(data []byte, n, editSize int, seed int64) []byte {
-	r := rand.New(rand.NewSource(seed))
-	out := append([]byte(nil), data...)
-	for i := 0; i < n; i++ {
-		pos := 0
-		if len(out) > 0 {
-			pos = r.Intn(len(out))
-		}
-		ins := make([]byte, editSize)
-		r.Read(ins)
-		out = append(out[:pos], append(ins, out[pos:]...)...)
-	}
-	return out
-}
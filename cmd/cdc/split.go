@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
+)
+
+func runSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	chunker := fs.String("chunker", "fastcdc-v1.0.0", "chunking algorithm")
+	out := fs.String("out", "", "store directory the chunks are written to")
+	manifest := fs.String("manifest", "", "manifest path (default OUT/FILE.manifest)")
+	var o opts
+	o.register(fs)
+	format := registerFormat(fs, false)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 || *out == "" {
+		return fmt.Errorf("usage: cdc split -chunker NAME FILE -out DIR")
+	}
+	if *manifest == "" {
+		*manifest = filepath.Join(*out, filepath.Base(paths[0])+".manifest")
+	}
+
+	start := time.Now()
+	st, err := split(*chunker, paths[0], *out, *manifest, &o)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return emitJSON(os.Stdout, splitJSON{
+			header:      newHeader("split"),
+			Algorithm:   *chunker,
+			Options:     o.json(),
+			File:        paths[0],
+			Store:       *out,
+			Manifest:    *manifest,
+			Bytes:       st.size,
+			Chunks:      st.chunks,
+			Stored:      st.stored,
+			StoredBytes: st.storedBytes,
+			ElapsedSec:  time.Since(start).Seconds(),
+		})
+	}
+	fmt.Printf("%s: %s in %d chunks, %d new (%s) stored in %s\n",
+		paths[0], humanBytes(st.size), st.chunks, st.stored, humanBytes(st.storedBytes), *out)
+	fmt.Printf("manifest: %s\n", *manifest)
+	return nil
+}
+
+type splitJSON struct {
+	header
+	Algorithm   string   `json:"algorithm"`
+	Options     optsJSON `json:"options"`
+	File        string   `json:"file"`
+	Store       string   `json:"store"`
+	Manifest    string   `json:"manifest"`
+	Bytes       int64    `json:"bytes"`
+	Chunks      int      `json:"chunks"`
+	Stored      int      `json:"stored"` // chunks new to the store
+	StoredBytes int64    `json:"stored_bytes"`
+	ElapsedSec  float64  `json:"elapsed_sec"`
+}
+
+type splitStats struct {
+	size        int64
+	chunks      int
+	stored      int
+	storedBytes int64
+}
+
+// split chunks path into the store and writes its manifest. The file is
+// read once, as a stream: only the chunker buffer is ever held in memory.
+// Chunks already present in the store are not rewritten, so splitting
+// several versions of a file into the same store deduplicates them.
+func split(algorithm, path, store, manifest string, o *opts) (*splitStats, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	sc := &storeChunks{store: store}
+	if sc.Generator, err = profile.NewGenerator(io.TeeReader(src, &sc.pending), algorithm, o.chunkerOpts()); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(store, 0o755); err != nil {
+		return nil, err
+	}
+
+	mf, err := os.Create(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer mf.Close()
+	tr, err := profile.Encode(mf, profile.JSON, sc)
+	if err != nil {
+		return nil, err
+	}
+	st := &splitStats{size: tr.Size, chunks: int(tr.Chunks), stored: sc.stored, storedBytes: sc.storedBytes}
+	return st, mf.Close()
+}
+
+func runJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	store := fs.String("store", "", "store directory holding the chunks")
+	format := registerFormat(fs, false)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 || *store == "" {
+		return fmt.Errorf("usage: cdc join MANIFEST -store DIR > FILE")
+	}
+	start := time.Now()
+	n, err := join(paths[0], *store, os.Stdout)
+	if *format == "json" {
+		// The file itself goes to stdout: the report goes to stderr.
+		out := joinJSON{
+			header:     newHeader("join"),
+			Manifest:   paths[0],
+			Store:      *store,
+			Bytes:      n,
+			Verified:   err == nil,
+			ElapsedSec: time.Since(start).Seconds(),
+		}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		if jerr := emitJSON(os.Stderr, out); err == nil {
+			err = jerr
+		}
+	}
+	return err
+}
+
+type joinJSON struct {
+	header
+	Manifest   string  `json:"manifest"`
+	Store      string  `json:"store"`
+	Bytes      int64   `json:"bytes"`
+	Verified   bool    `json:"verified"`
+	Error      string  `json:"error,omitempty"`
+	ElapsedSec float64 `json:"elapsed_sec"`
+}
+
+// join rebuilds the file described by manifest onto w, one chunk at a time.
+// Every chunk is checked against its digest before it is written, and the
+// whole output against the manifest trailer once the last chunk is out.
+func join(manifest, store string, w io.Writer) (int64, error) {
+	mf, err := os.Open(manifest)
+	if err != nil {
+		return 0, err
+	}
+	defer mf.Close()
+	pr, err := profile.NewReader(mf)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", manifest, err)
+	}
+
+	whole := sha256.New()
+	var size int64
+	var buf bytes.Buffer
+	for {
+		c, err := pr.Next()
+		if err == io.EOF {
+			tr := pr.Trailer()
+			if tr.Size != size || !bytes.Equal(tr.Digest[:], whole.Sum(nil)) {
+				return size, fmt.Errorf("reassembled file does not match the manifest digest")
+			}
+			return size, nil
+		}
+		if err != nil {
+			return size, fmt.Errorf("%s: %w", manifest, err)
+		}
+
+		buf.Reset()
+		if err := readChunk(&buf, store, c.Digest); err != nil {
+			return size, fmt.Errorf("chunk at offset %d: %w", c.Offset, err)
+		}
+		if buf.Len() != c.Length || sha256.Sum256(buf.Bytes()) != c.Digest {
+			return size, fmt.Errorf("chunk %x at offset %d is corrupt", c.Digest, c.Offset)
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return size, err
+		}
+		whole.Write(buf.Bytes())
+		size += int64(buf.Len())
+	}
+}
+
+func readChunk(buf *bytes.Buffer, store string, digest [sha256.Size]byte) error {
+	f, err := os.Open(chunkPath(store, digest))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = buf.ReadFrom(f)
+	return err
+}
+
+// parseInterspersed parses flags that may appear after positional arguments,
+// as in "cdc split FILE -out DIR", which the flag package alone stops at.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -17,12 +17,10 @@
 package main
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"flag"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"sort"
 	"time"
@@ -32,41 +30,105 @@ import (
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/similarity"
 )
 
 // opts groups the size options every subcommand shares.
 type opts struct {
 	min, avg, max int
+
+	// mem is the memory budget, in MiB, for the state of a measurement;
+	// 0 means unbounded. The dedup set and, with a similarity method, the
+	// delta bases share it (see memBudgets). Past its share, dedup figures
+	// are estimated from a uniform sample of the chunk digests.
+	mem int
+
+	// similarity, when set, is the resemblance method ("broder" or
+	// "finesse") used to also measure delta compression against similar
+	// chunks, on top of exact dedup.
+	similarity string
+
+	// byType breaks the result down by file type (extension).
+	byType bool
+
+	// key is the key of keyed algorithms, nil otherwise.
+	key []byte
 }
 
 func (o *opts) register(fs *flag.FlagSet) {
 	fs.IntVar(&o.min, "min", 2*1024, "minimum chunk size in bytes")
 	fs.IntVar(&o.avg, "avg", 8*1024, "average/normal chunk size in bytes")
 	fs.IntVar(&o.max, "max", 64*1024, "maximum chunk size in bytes")
+	fs.IntVar(&o.mem, "mem", 1024, "memory budget for dedup and delta state in MiB, 0 for unbounded")
+	o.registerKey(fs)
 }
 
 func (o *opts) chunkerOpts() *chunkers.ChunkerOpts {
-	return &chunkers.ChunkerOpts{MinSize: o.min, NormalSize: o.avg, MaxSize: o.max}
+	return &chunkers.ChunkerOpts{MinSize: o.min, NormalSize: o.avg, MaxSize: o.max, Key: o.key}
+}
+
+// memBudgets splits the memory budget, in bytes, between the dedup set and
+// the delta bases: half each when a similarity method is measured, all of it
+// to the dedup set otherwise. Both are 0, unbounded, when the budget is.
+func (o *opts) memBudgets() (dedup, delta int64) {
+	total := int64(o.mem) << 20
+	if o.similarity == "" {
+		return total, 0
+	}
+	return total / 2, total - total/2
 }
 
-// chunkStat is the per-chunk record we keep: its length and content digest.
-// The digest is what lets us count unique chunks for the dedup ratio.
-type chunkStat struct {
-	length int
-	digest [32]byte
+// dedupLimit is the number of digests the dedup state may hold.
+func (o *opts) dedupLimit() int {
+	dedup, _ := o.memBudgets()
+	return int(dedup / dedupEntrySize)
 }
 
 // result is the full measurement of running one algorithm over one corpus.
 type result struct {
 	algorithm string
+	key       []byte // of keyed algorithms, only ever shown as a fingerprint
 
 	totalBytes  int64
 	chunks      int
 	uniqueBytes int64 // sum of lengths of distinct chunks (by digest)
 	uniqueChunk int
 
-	lengths  []int // every chunk length, for the distribution
+	sizes    *sizeHistogram // every chunk length, for the distribution
 	duration time.Duration
+
+	// Delta compression beyond exact dedup, only measured with a similarity
+	// method: how many unique chunks found a similar base, and how many
+	// bytes storing them as deltas saves.
+	deltaChunks int
+	deltaSaved  int64
+
+	// sampleShift is non-zero when the dedup state outgrew the memory
+	// budget: unique and delta figures are then estimated from one digest
+	// in 2^sampleShift.
+	sampleShift uint
+
+	// types is the per-file-type breakdown, when asked for.
+	types []*typeResult
+}
+
+// typeResult is the share of one file type in a measurement. Dedup is still
+// cross-file: a chunk is unique to the type of the file that first had it,
+// so a type whose files mostly repeat chunks seen elsewhere gets a low ratio.
+type typeResult struct {
+	name        string
+	files       int
+	totalBytes  int64
+	chunks      int
+	uniqueBytes int64
+	uniqueChunk int
+}
+
+func (t *typeResult) dedupRatio() float64 {
+	if t.totalBytes == 0 {
+		return 0
+	}
+	return float64(t.uniqueBytes) / float64(t.totalBytes)
 }
 
 // dedupRatio is uniqueBytes/totalBytes: the fraction of the corpus that must
@@ -78,6 +140,15 @@ func (r *result) dedupRatio() float64 {
 	return float64(r.uniqueBytes) / float64(r.totalBytes)
 }
 
+// deltaRatio is the fraction of the corpus left to store once similar unique
+// chunks are delta-encoded against their base.
+func (r *result) deltaRatio() float64 {
+	if r.totalBytes == 0 {
+		return 0
+	}
+	return float64(r.uniqueBytes-r.deltaSaved) / float64(r.totalBytes)
+}
+
 func (r *result) throughputMBs() float64 {
 	if r.duration == 0 {
 		return 0
@@ -89,60 +160,89 @@ func (r *result) throughputMBs() float64 {
 // chunk lengths. Chunk-size variance matters: a tight distribution around the
 // target is a sign of a well-behaved chunker.
 func (r *result) distribution() (mn, p50, avg, p95, mx int, stddev float64) {
-	if len(r.lengths) == 0 {
-		return
-	}
-	sorted := append([]int(nil), r.lengths...)
-	sort.Ints(sorted)
-	mn = sorted[0]
-	mx = sorted[len(sorted)-1]
-	p50 = sorted[len(sorted)*50/100]
-	p95 = sorted[len(sorted)*95/100]
-
-	var sum int64
-	for _, l := range sorted {
-		sum += int64(l)
-	}
-	mean := float64(sum) / float64(len(sorted))
-	avg = int(mean)
-
-	var sq float64
-	for _, l := range sorted {
-		d := float64(l) - mean
-		sq += d * d
-	}
-	stddev = math.Sqrt(sq / float64(len(sorted)))
-	return
-}
-
-// measure chunks every file with the given algorithm, accumulating per-chunk
-// digests into seen so the dedup ratio is computed across the whole corpus
-// (cross-file dedup, not just within a single file). It returns the aggregate
-// result.
-func measure(algorithm string, files [][]byte, o *opts) (*result, error) {
-	res := &result{algorithm: algorithm}
-	seen := make(map[[32]byte]struct{})
-
-	for _, data := range files {
-		ch, err := chunkers.NewChunker(algorithm, bytes.NewReader(data), o.chunkerOpts())
+	return r.sizes.distribution()
+}
+
+// corpus yields the inputs of a measurement one reader at a time, so that a
+// measurement never holds more than the chunker buffer of any input.
+type corpus interface {
+	each(fn func(name string, r io.Reader) error) error
+}
+
+// fileCorpus streams files from disk, "-" standing for stdin.
+type fileCorpus []string
+
+func (fc fileCorpus) each(fn func(name string, r io.Reader) error) error {
+	for _, p := range fc {
+		f, err := openInput(p)
+		if err != nil {
+			return err
+		}
+		err = fn(p, f)
+		f.Close()
 		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// measure chunks every input with the given algorithm, accumulating per-chunk
+// digests so the dedup ratio is computed across the whole corpus (cross-file
+// dedup, not just within a single file). It returns the aggregate result.
+func measure(algorithm string, in corpus, o *opts) (*result, error) {
+	res := &result{algorithm: algorithm, key: o.key, sizes: newSizeHistogram()}
+	seen := newDedupSet(o.dedupLimit())
+
+	var delta *deltaState
+	if o.similarity != "" {
+		var err error
+		_, budget := o.memBudgets()
+		if delta, err = newDeltaState(o.similarity, budget); err != nil {
 			return nil, err
 		}
+	}
+
+	kinds := make(map[string]int)
+	err := in.each(func(name string, r io.Reader) error {
+		ch, err := chunkers.NewChunker(algorithm, r, o.chunkerOpts())
+		if err != nil {
+			return err
+		}
+		kind := 0
+		var tr *typeResult
+		if o.byType {
+			typ := fileType(name)
+			k, ok := kinds[typ]
+			if !ok {
+				k = len(res.types)
+				kinds[typ] = k
+				res.types = append(res.types, &typeResult{name: typ})
+			}
+			kind, tr = k, res.types[k]
+			tr.files++
+		}
 		start := time.Now()
 		for {
 			chunk, err := ch.Next()
 			if err != nil && err != io.EOF {
-				return nil, err
+				return err
 			}
 			if len(chunk) != 0 {
 				res.chunks++
 				res.totalBytes += int64(len(chunk))
-				res.lengths = append(res.lengths, len(chunk))
+				res.sizes.add(len(chunk))
+				if tr != nil {
+					tr.chunks++
+					tr.totalBytes += int64(len(chunk))
+				}
 				d := sha256.Sum256(chunk)
-				if _, ok := seen[d]; !ok {
-					seen[d] = struct{}{}
-					res.uniqueChunk++
-					res.uniqueBytes += int64(len(chunk))
+				if seen.add(d, len(chunk), kind) && delta != nil {
+					saved, err := delta.add(d, chunk)
+					if err != nil {
+						return err
+					}
+					seen.setSaved(d, saved)
 				}
 			}
 			if err == io.EOF {
@@ -150,24 +250,144 @@ func measure(algorithm string, files [][]byte, o *opts) (*result, error) {
 			}
 		}
 		res.duration += time.Since(start)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.uniqueChunk = seen.uniqueChunks()
+	res.uniqueBytes = seen.uniqueBytes()
+	res.deltaChunks = seen.deltaChunks()
+	res.deltaSaved = seen.deltaSaved()
+	res.sampleShift = seen.shift
+	for k, tr := range res.types {
+		tr.uniqueChunk, tr.uniqueBytes = seen.kind(k)
 	}
+	sort.SliceStable(res.types, func(i, j int) bool {
+		return res.types[i].totalBytes > res.types[j].totalBytes
+	})
 	return res, nil
 }
 
-// readFiles loads every path into memory.
-func readFiles(paths []string) ([][]byte, error) {
+// deltaEntrySize is a rough per-base cost of a deltaState on top of the
+// chunk data: the map entry of the base and the index entries of its sketch.
+const deltaEntrySize = 320
+
+// deltaState tracks the resemblance index of the unique chunks seen so far.
+// Bases are copies of chunk data, so they are only kept until budget bytes
+// are held, index included; later chunks are still looked up but no longer
+// indexed.
+type deltaState struct {
+	opts   *similarity.Options
+	index  *similarity.Index
+	bases  map[[32]byte][]byte
+	held   int64
+	budget int64 // 0 means unbounded
+}
+
+func newDeltaState(method string, budget int64) (*deltaState, error) {
+	m, err := similarity.ParseMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	so := similarity.DefaultOptions()
+	so.Method = m
+	return &deltaState{
+		opts:   so,
+		index:  similarity.NewIndex(),
+		bases:  make(map[[32]byte][]byte),
+		budget: budget,
+	}, nil
+}
+
+// add looks for a similar base for a new unique chunk and returns the savings
+// of delta-encoding it, then indexes the chunk as a candidate base.
+func (ds *deltaState) add(digest [32]byte, chunk []byte) (int, error) {
+	sketch, err := similarity.NewSketch(ds.opts, chunk)
+	if err != nil {
+		return 0, err
+	}
+	saved := 0
+	if base, _, ok := ds.index.Lookup(sketch); ok {
+		if d := similarity.Encode(ds.bases[base], chunk); len(d) < len(chunk) {
+			saved = len(chunk) - len(d)
+		}
+	}
+	if cost := int64(len(chunk)) + deltaEntrySize; ds.budget == 0 || ds.held+cost <= ds.budget {
+		// chunk aliases the chunker's buffer: keep a copy as the base.
+		ds.index.Add(digest, sketch)
+		ds.bases[digest] = append([]byte(nil), chunk...)
+		ds.held += cost
+	}
+	return saved, nil
+}
+
+// inputs checks the paths of a subcommand and returns them as a corpus.
+// stdin may only appear once, as it can only be read once.
+func inputs(paths []string) (fileCorpus, error) {
 	if len(paths) == 0 {
 		return nil, fmt.Errorf("need at least one input file")
 	}
-	files := make([][]byte, 0, len(paths))
+	if err := stdinOnce(paths); err != nil {
+		return nil, err
+	}
+	return fileCorpus(paths), nil
+}
+
+// stdinOnce checks "-" appears at most once in paths.
+func stdinOnce(paths []string) error {
+	stdin := 0
 	for _, p := range paths {
-		data, err := os.ReadFile(p)
+		if p == "-" {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return fmt.Errorf("stdin (-) given more than once")
+	}
+	return nil
+}
+
+// openInput opens path for streaming; "-" is stdin.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// spoolStdin copies stdin to a temporary file when it is one of paths, for
+// the subcommands that read their inputs more than once. It returns the paths
+// with "-" replaced, and a cleanup function removing the spool. As stdin can
+// only be spooled once, "-" may only appear once.
+func spoolStdin(paths []string) ([]string, func(), error) {
+	cleanup := func() {}
+	if err := stdinOnce(paths); err != nil {
+		return nil, cleanup, err
+	}
+	out := append([]string(nil), paths...)
+	for i, p := range out {
+		if p != "-" {
+			continue
+		}
+		f, err := os.CreateTemp("", "cdc-stdin-*")
 		if err != nil {
-			return nil, err
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.Remove(f.Name()) }
+		if _, err := io.Copy(f, os.Stdin); err != nil {
+			f.Close()
+			cleanup()
+			return nil, func() {}, err
+		}
+		if err := f.Close(); err != nil {
+			cleanup()
+			return nil, func() {}, err
 		}
-		files = append(files, data)
+		out[i] = f.Name()
 	}
-	return files, nil
+	return out, cleanup, nil
 }
 
 // humanBytes formats a byte count compactly.
@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// tune answers "which sizes should I use for this data?". Smaller chunks find
+// more duplicates but each unique chunk costs an index entry, and throughput
+// moves with the chunk size too, so there is no single best point: tune
+// measures a grid of configurations, keeps the ones no other configuration
+// beats on every axis (the Pareto frontier), and recommends the one storing
+// the fewest bytes once index entries are accounted for.
+func runTune(args []string) error {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	algos := fs.String("chunker", "fastcdc-v1.0.0", "algorithm(s) to sweep, comma-separated")
+	avgs := fs.String("avgs", "4096,8192,16384,32768,65536", "average sizes to sweep, comma-separated")
+	minDivs := fs.String("min-div", "2,4,8", "min = avg / d for each d, comma-separated")
+	maxMuls := fs.String("max-mul", "4,8", "max = avg * m for each m, comma-separated")
+	entryBytes := fs.Int("entry-bytes", 64, "index metadata cost per unique chunk, in bytes")
+	jobs := fs.Int("j", runtime.NumCPU(), "configurations measured in parallel")
+	var o opts
+	o.register(fs)
+	format := registerFormat(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *entryBytes < 0 || *jobs < 1 {
+		return fmt.Errorf("-entry-bytes must be >= 0 and -j >= 1")
+	}
+
+	grid, err := tuneGrid(splitList(*algos), *avgs, *minDivs, *maxMuls)
+	if err != nil {
+		return err
+	}
+
+	paths, cleanup, err := spoolStdin(fs.Args())
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	files, err := inputs(paths)
+	if err != nil {
+		return err
+	}
+
+	// Every worker holds its own dedup state: share the budget.
+	if o.mem != 0 {
+		o.mem = max(1, o.mem / *jobs)
+	}
+	rows, skipped, err := tuneSweep(files, grid, &o, int64(*entryBytes), *jobs)
+	if err != nil {
+		return err
+	}
+	best := recommend(rows)
+
+	switch *format {
+	case "json":
+		return emitJSON(os.Stdout, tuneJSON{
+			header:      newHeader("tune"),
+			EntryBytes:  *entryBytes,
+			Jobs:        *jobs,
+			Results:     rows,
+			Skipped:     skipped,
+			Recommended: rows[best],
+		})
+	case "csv":
+		cw := csv.NewWriter(os.Stdout)
+		cw.Write([]string{"algorithm", "min", "avg", "max", "dedup_ratio", "chunks", "unique_chunks",
+			"metadata_bytes", "stored_ratio", "throughput_mb_s", "pareto", "recommended"})
+		for i, r := range rows {
+			cw.Write([]string{r.Algorithm, itoa(r.Min), itoa(r.Avg), itoa(r.Max), ftoa(r.DedupRatio),
+				itoa(r.Chunks), itoa(r.UniqueChunks), itoa(r.MetadataBytes), ftoa(r.StoredRatio),
+				ftoa(r.ThroughputMBs), strconv.FormatBool(r.Pareto), strconv.FormatBool(i == best)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	fmt.Printf("corpus: %s, %d configuration(s), index entry = %d bytes\n\n",
+		humanBytes(rows[0].TotalBytes), len(rows), *entryBytes)
+	fmt.Printf("  %-16s %7s %7s %8s %8s %10s %10s %8s %9s\n",
+		"algorithm", "min", "avg", "max", "dedup", "chunks", "metadata", "stored", "MB/s")
+	for i, r := range rows {
+		mark := " "
+		if i == best {
+			mark = ">"
+		} else if r.Pareto {
+			mark = "*"
+		}
+		fmt.Printf("%s %-16s %7d %7d %8d %8.4f %10d %10s %8.4f %9.1f\n", mark, r.Algorithm, r.Min, r.Avg, r.Max,
+			r.DedupRatio, r.Chunks, humanBytes(r.MetadataBytes), r.StoredRatio, r.ThroughputMBs)
+	}
+	for _, s := range skipped {
+		fmt.Printf("  skipped %s\n", s)
+	}
+	r := rows[best]
+	fmt.Printf("\n* Pareto frontier: no other configuration has better dedup, less metadata and more throughput.\n")
+	fmt.Printf("stored = (unique bytes + metadata) / input; throughput measured with %d run(s) in parallel.\n", *jobs)
+	fmt.Printf("\nrecommended: -chunker %s -min %d -avg %d -max %d (stored %.4f)\n",
+		r.Algorithm, r.Min, r.Avg, r.Max, r.StoredRatio)
+	return nil
+}
+
+type tuneConfig struct {
+	algorithm     string
+	min, avg, max int
+}
+
+type tuneRow struct {
+	Algorithm     string  `json:"algorithm"`
+	Min           int     `json:"min"`
+	Avg           int     `json:"avg"`
+	Max           int     `json:"max"`
+	TotalBytes    int64   `json:"total_bytes"`
+	DedupRatio    float64 `json:"dedup_ratio"`
+	Chunks        int     `json:"chunks"`
+	UniqueChunks  int     `json:"unique_chunks"`
+	MetadataBytes int64   `json:"metadata_bytes"` // unique chunks * entry bytes
+	StoredRatio   float64 `json:"stored_ratio"`   // (unique bytes + metadata) / total
+	ThroughputMBs float64 `json:"throughput_mb_s"`
+	Pareto        bool    `json:"pareto"`
+}
+
+type tuneJSON struct {
+	header
+	EntryBytes  int       `json:"entry_bytes"`
+	Jobs        int       `json:"jobs"`
+	Results     []tuneRow `json:"results"`
+	Skipped     []string  `json:"skipped,omitempty"`
+	Recommended tuneRow   `json:"recommended"`
+}
+
+// tuneGrid expands the sweep lists into configurations.
+func tuneGrid(algos []string, avgs, minDivs, maxMuls string) ([]tuneConfig, error) {
+	parse := func(name, list string) ([]int, error) {
+		var out []int
+		for _, s := range splitList(list) {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("-%s: bad value %q", name, s)
+			}
+			out = append(out, n)
+		}
+		if len(out) == 0 {
+			return nil, fmt.Errorf("-%s: empty list", name)
+		}
+		return out, nil
+	}
+	if len(algos) == 0 {
+		return nil, fmt.Errorf("-chunker: empty list")
+	}
+	a, err := parse("avgs", avgs)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parse("min-div", minDivs)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parse("max-mul", maxMuls)
+	if err != nil {
+		return nil, err
+	}
+
+	var grid []tuneConfig
+	for _, algo := range algos {
+		for _, avg := range a {
+			for _, div := range d {
+				for _, mul := range m {
+					grid = append(grid, tuneConfig{algo, avg / div, avg, avg * mul})
+				}
+			}
+		}
+	}
+	return grid, nil
+}
+
+// tuneSweep measures every configuration the algorithm accepts, jobs at a
+// time. Configurations that are not ordered min < avg < max, or that the
+// algorithm refuses or fails to set up with, are reported as skipped rather
+// than failing the sweep. Rows come back sorted by dedup ratio, with the
+// frontier marked.
+func tuneSweep(in corpus, grid []tuneConfig, base *opts, entryBytes int64, jobs int) ([]tuneRow, []string, error) {
+	var valid []tuneConfig
+	var skipped []string
+	known := make(map[string]bool)
+	for _, c := range grid {
+		// With its default options, an algorithm only fails if unknown.
+		if !known[c.algorithm] {
+			if _, err := chunkers.NewChunker(c.algorithm, bytes.NewReader(nil), nil); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", c.algorithm, err)
+			}
+			known[c.algorithm] = true
+		}
+		if c.min <= 0 || c.min >= c.avg || c.avg >= c.max {
+			skipped = append(skipped, fmt.Sprintf("%s min=%d avg=%d max=%d: need 0 < min < avg < max", c.algorithm, c.min, c.avg, c.max))
+			continue
+		}
+		// Setup alone lets through options the algorithm does not support,
+		// such as a NormalSize that is not a power of two: validate too.
+		co := &chunkers.ChunkerOpts{MinSize: c.min, NormalSize: c.avg, MaxSize: c.max, Key: base.key}
+		err := chunkers.ValidateOptions(c.algorithm, co)
+		if err == nil {
+			_, err = chunkers.NewChunker(c.algorithm, bytes.NewReader(nil), co)
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s min=%d avg=%d max=%d: %v", c.algorithm, c.min, c.avg, c.max, err))
+			continue
+		}
+		valid = append(valid, c)
+	}
+	if len(valid) == 0 {
+		return nil, skipped, fmt.Errorf("no valid configuration in the grid")
+	}
+
+	rows := make([]tuneRow, len(valid))
+	errs := make([]error, len(valid))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(jobs, len(valid)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				c := valid[i]
+				o := *base
+				o.min, o.avg, o.max = c.min, c.avg, c.max
+				o.similarity, o.byType = "", false
+				res, err := measure(c.algorithm, in, &o)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s min=%d avg=%d max=%d: %w", c.algorithm, c.min, c.avg, c.max, err)
+					continue
+				}
+				rows[i] = tuneResult(c, res, entryBytes)
+			}
+		}()
+	}
+	for i := range valid {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	markPareto(rows)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].DedupRatio < rows[j].DedupRatio })
+	return rows, skipped, nil
+}
+
+func tuneResult(c tuneConfig, res *result, entryBytes int64) tuneRow {
+	row := tuneRow{
+		Algorithm:     c.algorithm,
+		Min:           c.min,
+		Avg:           c.avg,
+		Max:           c.max,
+		TotalBytes:    res.totalBytes,
+		DedupRatio:    res.dedupRatio(),
+		Chunks:        res.chunks,
+		UniqueChunks:  res.uniqueChunk,
+		MetadataBytes: int64(res.uniqueChunk) * entryBytes,
+		ThroughputMBs: res.throughputMBs(),
+	}
+	if res.totalBytes != 0 {
+		row.StoredRatio = float64(res.uniqueBytes+row.MetadataBytes) / float64(res.totalBytes)
+	}
+	return row
+}
+
+// dominates reports whether a is at least as good as b on every axis and
+// strictly better on one: lower dedup ratio, less metadata, more throughput.
+func dominates(a, b *tuneRow) bool {
+	if a.DedupRatio > b.DedupRatio || a.MetadataBytes > b.MetadataBytes || a.ThroughputMBs < b.ThroughputMBs {
+		return false
+	}
+	return a.DedupRatio < b.DedupRatio || a.MetadataBytes < b.MetadataBytes || a.ThroughputMBs > b.ThroughputMBs
+}
+
+func markPareto(rows []tuneRow) {
+	for i := range rows {
+		rows[i].Pareto = true
+		for j := range rows {
+			if i != j && dominates(&rows[j], &rows[i]) {
+				rows[i].Pareto = false
+				break
+			}
+		}
+	}
+}
+
+// recommend picks the frontier configuration storing the fewest bytes, index
+// included, preferring the faster one on a tie.
+func recommend(rows []tuneRow) int {
+	best := -1
+	for i := range rows {
+		if !rows[i].Pareto {
+			continue
+		}
+		if best < 0 || rows[i].StoredRatio < rows[best].StoredRatio ||
+			rows[i].StoredRatio == rows[best].StoredRatio && rows[i].ThroughputMBs > rows[best].ThroughputMBs {
+			best = i
+		}
+	}
+	return best
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
+)
+
+// verify re-chunks a file with the algorithm and sizes its manifest records
+// and checks every cut point against it. A chunker whose cut points change
+// across an upgrade silently stops deduplicating against existing stores:
+// this is the check to run before rolling one out.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	manifest := fs.String("manifest", "", "manifest written by cdc split")
+	context := fs.Int("context", 3, "chunks of context to show around a divergence")
+	var o opts
+	o.registerKey(fs)
+	format := registerFormat(fs, false)
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 || *manifest == "" {
+		return fmt.Errorf("usage: cdc verify -manifest MANIFEST FILE")
+	}
+
+	mf, err := os.Open(*manifest)
+	if err != nil {
+		return err
+	}
+	defer mf.Close()
+	pr, err := profile.NewReader(mf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *manifest, err)
+	}
+	in, err := openInput(paths[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	v, err := verify(pr, in, o.key, max(*context, 1))
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		err = emitJSON(os.Stdout, verifyJSON{header: newHeader("verify"), Manifest: *manifest, File: paths[0], verifyResult: v})
+	} else {
+		printVerify(*manifest, paths[0], v)
+	}
+	if err == nil && v.Divergence != nil {
+		err = fmt.Errorf("%s diverges from %s at chunk %d (offset %d)", paths[0], *manifest, v.Divergence.Index, v.Divergence.Offset)
+	}
+	return err
+}
+
+// Divergence kinds.
+const (
+	divergeCut     = "cut"     // the chunk ends elsewhere
+	divergeContent = "content" // same cut points, different bytes
+	divergeMissing = "missing" // the file ends before the manifest
+	divergeExtra   = "extra"   // the file goes on past the manifest
+)
+
+type verifyChunk struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Digest string `json:"digest"`
+}
+
+type verifyDivergence struct {
+	Index    int           `json:"index"`
+	Offset   int64         `json:"offset"`
+	Kind     string        `json:"kind"`
+	Before   []verifyChunk `json:"before"`   // the last matching chunks
+	Manifest []verifyChunk `json:"manifest"` // from the divergence on, as recorded
+	File     []verifyChunk `json:"file"`     // from the divergence on, as chunked now
+}
+
+type verifyResult struct {
+	Algorithm     string            `json:"algorithm"`
+	MinSize       int               `json:"min_size"`
+	NormalSize    int               `json:"normal_size"`
+	MaxSize       int               `json:"max_size"`
+	Keyed         bool              `json:"keyed"`
+	Key           string            `json:"key_fingerprint,omitempty"`
+	Chunks        int               `json:"chunks"` // chunks matching before the divergence, if any
+	FileBytes     int64             `json:"file_bytes"`
+	ManifestBytes int64             `json:"manifest_bytes"`
+	FileMatches   bool              `json:"file_matches"` // same size and SHA-256 as the manifest records
+	Divergence    *verifyDivergence `json:"divergence,omitempty"`
+}
+
+type verifyJSON struct {
+	header
+	Manifest string `json:"manifest"`
+	File     string `json:"file"`
+	*verifyResult
+}
+
+// errDiverged stops Diff at the first chunk that differs.
+var errDiverged = errors.New("diverged")
+
+// verify profiles r and diffs the manifest against it, both as streams. At
+// the first chunk that differs it keeps up to context chunks on each side,
+// then reads both to the end anyway: whether the whole file still matches
+// the manifest digest tells a changed file from a changed chunker.
+func verify(pr *profile.Reader, r io.Reader, key []byte, context int) (*verifyResult, error) {
+	hdr := pr.Header()
+	switch {
+	case hdr.Keyed && key == nil:
+		return nil, fmt.Errorf("the manifest was written with a keyed chunker: give the key with -key-file, -key-env or -key-hex")
+	case !hdr.Keyed && key != nil:
+		return nil, fmt.Errorf("the manifest was written without a key")
+	case hdr.Key != "" && hdr.Key != keyflag.Fingerprint(key):
+		return nil, fmt.Errorf("the manifest was written with key %s, not %s", hdr.Key, keyflag.Fingerprint(key))
+	}
+	g, err := profile.NewGenerator(r, hdr.Algorithm, hdr.Opts(key))
+	if err != nil {
+		return nil, err
+	}
+
+	v := &verifyResult{Algorithm: hdr.Algorithm, MinSize: hdr.MinSize, NormalSize: hdr.NormalSize, MaxSize: hdr.MaxSize, Keyed: hdr.Keyed,
+		Key: keyflag.Fingerprint(key)}
+	recorded := &numbered{Source: pr, context: context}
+	file := &numbered{Source: g, context: context}
+	_, err = profile.Diff(recorded, file, func(m profile.Mismatch) error {
+		switch m.Kind {
+		case profile.HeaderMismatch:
+			return fmt.Errorf("the chunker reports %s %s, the manifest %s", m.Field, m.Got, m.Want)
+		case profile.TrailerMismatch:
+			return nil // the chunks all match: checked below
+		}
+		return errDiverged
+	})
+	if err != nil && err != errDiverged {
+		return nil, err
+	}
+	v.Chunks = recorded.index
+	if err == errDiverged {
+		// Diff stops on the first chunk of either side that the other
+		// does not have, and both sides are at it: the chunks before it
+		// all matched.
+		m, f := recorded.cur, file.cur
+		d := &verifyDivergence{Before: slices.Clone(recorded.before)}
+		switch {
+		case f == nil:
+			d.Kind, d.Index, d.Offset = divergeMissing, m.Index, m.Offset
+		case m == nil:
+			d.Kind, d.Index, d.Offset = divergeExtra, f.Index, f.Offset
+		case m.Offset != f.Offset || m.Length != f.Length:
+			d.Kind, d.Index, d.Offset = divergeCut, f.Index, f.Offset
+		default:
+			d.Kind, d.Index, d.Offset = divergeContent, f.Index, f.Offset
+		}
+		v.Chunks = d.Index
+		for _, side := range []struct {
+			src    *numbered
+			chunks *[]verifyChunk
+		}{{recorded, &d.Manifest}, {file, &d.File}} {
+			for side.src.cur != nil {
+				if len(*side.chunks) < context {
+					*side.chunks = append(*side.chunks, *side.src.cur)
+				}
+				if _, err := side.src.Next(); err != nil && err != io.EOF {
+					return nil, err
+				}
+			}
+		}
+		v.Divergence = d
+	}
+
+	wt, ft := pr.Trailer(), g.Trailer()
+	v.FileBytes, v.ManifestBytes = ft.Size, wt.Size
+	v.FileMatches = wt.Size == ft.Size && wt.Digest == ft.Digest
+	if v.Divergence == nil && !v.FileMatches {
+		return nil, fmt.Errorf("the manifest trailer does not match its own chunks")
+	}
+	return v, nil
+}
+
+// numbered numbers the chunks of a profile as Diff pulls them, keeping the
+// last one returned, nil once the profile is done, and up to context chunks
+// before it.
+type numbered struct {
+	profile.Source
+	context int
+	index   int // chunks returned
+	cur     *verifyChunk
+	before  []verifyChunk
+}
+
+func (n *numbered) Next() (profile.Chunk, error) {
+	if n.cur != nil {
+		n.before = append(n.before, *n.cur)
+		if len(n.before) > n.context {
+			n.before = n.before[1:]
+		}
+	}
+	c, err := n.Source.Next()
+	if err != nil {
+		n.cur = nil
+		return c, err
+	}
+	n.cur = &verifyChunk{Index: n.index, Offset: c.Offset, Length: c.Length, Digest: hex.EncodeToString(c.Digest[:])}
+	n.index++
+	return c, nil
+}
+
+func printVerify(manifest, file string, v *verifyResult) {
+	keyed := ""
+	if v.Keyed {
+		keyed = ", key " + v.Key
+	}
+	fmt.Printf("manifest: %s (%s, min=%d normal=%d max=%d%s)\n", manifest, v.Algorithm, v.MinSize, v.NormalSize, v.MaxSize, keyed)
+	fmt.Printf("file:     %s, %s\n", file, humanBytes(v.FileBytes))
+
+	d := v.Divergence
+	if d == nil {
+		fmt.Printf("\nok: all %d cut points match\n", v.Chunks)
+		return
+	}
+
+	fmt.Printf("\ndivergence at chunk %d, offset %d: ", d.Index, d.Offset)
+	switch d.Kind {
+	case divergeCut:
+		fmt.Printf("cut point moved (manifest cuts at %d, file at %d)\n",
+			d.Manifest[0].Offset+int64(d.Manifest[0].Length), d.File[0].Offset+int64(d.File[0].Length))
+	case divergeContent:
+		fmt.Printf("same cut points, different content\n")
+	case divergeMissing:
+		fmt.Printf("the file ends before the manifest\n")
+	case divergeExtra:
+		fmt.Printf("the file goes on past the manifest\n")
+	}
+
+	fmt.Printf("\n     %8s %14s %10s  %s\n", "chunk", "offset", "length", "digest")
+	for _, rows := range []struct {
+		mark   string
+		chunks []verifyChunk
+	}{{"=", d.Before}, {"M", d.Manifest}, {"F", d.File}} {
+		for _, c := range rows.chunks {
+			fmt.Printf("  %s  %8d %14d %10d  %.16s\n", rows.mark, c.Index, c.Offset, c.Length, c.Digest)
+		}
+	}
+	fmt.Printf("  (= matching, M as recorded in the manifest, F as chunked now)\n\n")
+
+	if v.FileMatches {
+		fmt.Printf("the file is the one the manifest describes: the chunker now cuts it\n")
+		fmt.Printf("differently (algorithm, sizes or key changed), breaking dedup against it.\n")
+	} else {
+		fmt.Printf("the file differs from the one the manifest describes (%s, %s recorded).\n",
+			humanBytes(v.FileBytes), humanBytes(v.ManifestBytes))
+	}
+}
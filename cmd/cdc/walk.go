@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// patterns is a repeatable glob flag.
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(v string) error {
+	if _, err := path.Match(v, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", v, err)
+	}
+	*p = append(*p, v)
+	return nil
+}
+
+// match reports whether a pattern matches the entry at rel, a slash-separated
+// path relative to the walk root. Patterns without a slash match the base name
+// at any depth, as in .gitignore; others match the whole relative path.
+func (p patterns) match(rel string) bool {
+	for _, pat := range p {
+		name := rel
+		if !strings.Contains(pat, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// byteSize is a size flag accepting K, M, G and T suffixes (powers of 1024).
+type byteSize int64
+
+func (b *byteSize) String() string { return strconv.FormatInt(int64(*b), 10) }
+
+func (b *byteSize) Set(v string) error {
+	mult := int64(1)
+	if n := len(v); n != 0 {
+		if i := strings.IndexByte("KMGT", v[n-1]&^0x20); i >= 0 {
+			mult = 1 << (10 * (i + 1))
+			v = v[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("bad size %q", v)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
+// walkOpts selects the files of a recursive walk.
+type walkOpts struct {
+	include  patterns // when set, only matching files are read
+	exclude  patterns // matching files are skipped, matching directories pruned
+	symlinks string   // "skip" or "follow"
+	maxSize  byteSize // larger files are skipped; 0 means no limit
+}
+
+func (w *walkOpts) register(fs *flag.FlagSet) {
+	fs.Var(&w.include, "include", "only read files matching this glob (repeatable)")
+	fs.Var(&w.exclude, "exclude", "skip files and directories matching this glob (repeatable)")
+	fs.StringVar(&w.symlinks, "symlinks", "skip", "symlink policy: skip | follow")
+	fs.Var(&w.maxSize, "max-file-size", "skip files larger than this (K, M, G suffixes), 0 for no limit")
+}
+
+// walkCorpus reads every regular file under its roots, depth first in name
+// order, selecting files as it goes rather than listing the tree upfront.
+type walkCorpus struct {
+	roots []string
+	opts  walkOpts
+
+	// What the last walk left out, for the report.
+	excluded, tooLarge, links, errors int
+}
+
+func newWalkCorpus(roots []string, opts walkOpts) (*walkCorpus, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("need at least one directory")
+	}
+	if opts.symlinks != "skip" && opts.symlinks != "follow" {
+		return nil, fmt.Errorf("unknown symlink policy %q", opts.symlinks)
+	}
+	return &walkCorpus{roots: roots, opts: opts}, nil
+}
+
+func (wc *walkCorpus) each(fn func(name string, r io.Reader) error) error {
+	wc.excluded, wc.tooLarge, wc.links, wc.errors = 0, 0, 0, 0
+	for _, root := range wc.roots {
+		fi, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		visited := make(map[string]bool)
+		if fi.IsDir() {
+			err = wc.walkDir(root, ".", visited, fn)
+		} else {
+			err = wc.file(root, filepath.Base(root), fi, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wc *walkCorpus) walkDir(dir, rel string, visited map[string]bool, fn func(string, io.Reader) error) error {
+	// Following symlinks can close a loop: never enter a directory twice.
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		wc.errors++
+		return nil
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		r := path.Join(rel, e.Name())
+		if wc.opts.exclude.match(r) {
+			wc.excluded++
+			continue
+		}
+
+		fi, err := e.Info()
+		if err != nil {
+			wc.errors++
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if wc.opts.symlinks == "skip" {
+				wc.links++
+				continue
+			}
+			if fi, err = os.Stat(p); err != nil {
+				wc.errors++ // dangling
+				continue
+			}
+		}
+
+		if fi.IsDir() {
+			err = wc.walkDir(p, r, visited, fn)
+		} else {
+			err = wc.file(p, r, fi, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wc *walkCorpus) file(p, rel string, fi os.FileInfo, fn func(string, io.Reader) error) error {
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	if len(wc.opts.include) != 0 && !wc.opts.include.match(rel) {
+		wc.excluded++
+		return nil
+	}
+	if wc.opts.maxSize != 0 && fi.Size() > int64(wc.opts.maxSize) {
+		wc.tooLarge++
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		wc.errors++
+		return nil
+	}
+	defer f.Close()
+	if err := fn(p, f); err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+// fileType is the breakdown key of a file: its lower-cased extension.
+func fileType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" || ext == "." {
+		return "(none)"
+	}
+	return ext
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// baselineVersion versions the baseline file. A file of another version is
+// refused rather than misread: save a new baseline instead.
+const baselineVersion = 1
+
+// Baseline is the file written by `cdcbench baseline save`: the measured
+// performance of each algorithm, the configuration to measure it again with,
+// and the machine it was measured on.
+type Baseline struct {
+	Version    int                `json:"baseline_version"`
+	Created    time.Time          `json:"created"`
+	Machine    Machine            `json:"machine"`
+	Config     BaselineConfig     `json:"config"`
+	Key        string             `json:"key_fingerprint,omitempty"`
+	Dataset    Dataset            `json:"dataset"`
+	Algorithms []AlgorithmMetrics `json:"algorithms"`
+}
+
+// Machine identifies where a baseline was measured. Numbers from another
+// machine are rarely comparable; check warns when it differs.
+type Machine struct {
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"go_version"`
+}
+
+func thisMachine() Machine {
+	return Machine{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, CPUs: runtime.NumCPU(), GoVersion: runtime.Version()}
+}
+
+type BaselineConfig struct {
+	Sizes       SizeTriple `json:"sizes"`
+	Concurrency int        `json:"concurrency"`
+	Pooled      bool       `json:"pooled"`
+	Repetitions int        `json:"repetitions"`
+	Warmup      int        `json:"warmup"`
+}
+
+// Dataset identifies the data a baseline was measured on.
+type Dataset struct {
+	Root  string `json:"root"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// AlgorithmMetrics holds the metrics of one algorithm over the repetitions,
+// outliers removed. An op is one file chunked, as a Go benchmark op would
+// be one chunker run to the end.
+type AlgorithmMetrics struct {
+	Algorithm   string `json:"algorithm"`
+	Throughput  Metric `json:"throughput_mb_s"`
+	AllocsPerOp Metric `json:"allocs_per_op"`
+	BytesPerOp  Metric `json:"bytes_per_op"`
+	PeakRSS     Metric `json:"peak_rss_mb"`
+}
+
+// baselineMetrics are the gated metrics, with whether higher is better.
+var baselineMetrics = []struct {
+	name   string
+	better int
+	get    func(*AlgorithmMetrics) Metric
+}{
+	{"MB/s", +1, func(am *AlgorithmMetrics) Metric { return am.Throughput }},
+	{"allocs/op", -1, func(am *AlgorithmMetrics) Metric { return am.AllocsPerOp }},
+	{"B/op", -1, func(am *AlgorithmMetrics) Metric { return am.BytesPerOp }},
+	{"peak RSS MB", -1, func(am *AlgorithmMetrics) Metric { return am.PeakRSS }},
+}
+
+// measureBaseline runs every algorithm with cfg, in shuffled order through
+// RunMatrix, and summarizes each.
+func measureBaseline(root string, algos []string, cfg BaselineConfig, key []byte, progress func(int, int, Cell, bool)) (*Baseline, error) {
+	warmup := cfg.Warmup
+	mc := &MatrixConfig{
+		Root:        root,
+		Algorithms:  algos,
+		Sizes:       []SizeTriple{cfg.Sizes},
+		Concurrency: []int{cfg.Concurrency},
+		Pooled:      []bool{cfg.Pooled},
+		Repetitions: cfg.Repetitions,
+		Warmup:      &warmup,
+		Seed:        time.Now().UnixNano(),
+		SampleMS:    100,
+		Alpha:       0.05,
+	}
+	if err := mc.validate(); err != nil {
+		return nil, err
+	}
+	mr, err := RunMatrix(mc, key, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Baseline{Version: baselineVersion, Created: time.Now().UTC(), Machine: thisMachine(), Config: cfg,
+		Key: keyflag.Fingerprint(key), Dataset: Dataset{Root: root}}
+	values := make([][4][]float64, len(algos))
+	for _, run := range mr.Runs {
+		r := run.Result
+		if r.Files == 0 {
+			return nil, fmt.Errorf("%s: no file chunked under %s", algos[run.Cell], root)
+		}
+		b.Dataset.Files, b.Dataset.Bytes = r.Files, r.Bytes
+		v := &values[run.Cell]
+		v[0] = append(v[0], r.ThroughputMBs)
+		v[1] = append(v[1], float64(r.Mallocs)/float64(r.Files))
+		v[2] = append(v[2], float64(r.AllocBytes)/float64(r.Files))
+		if !r.PeakRSSUnavailable {
+			v[3] = append(v[3], r.PeakRSSMB)
+		}
+	}
+	for i, algo := range algos {
+		v := values[i]
+		b.Algorithms = append(b.Algorithms, AlgorithmMetrics{
+			Algorithm:   algo,
+			Throughput:  newMetric(withoutOutliers(v[0])),
+			AllocsPerOp: newMetric(withoutOutliers(v[1])),
+			BytesPerOp:  newMetric(withoutOutliers(v[2])),
+			PeakRSS:     newMetric(withoutOutliers(v[3])),
+		})
+	}
+	return b, nil
+}
+
+func loadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("%s: baseline version %d, this cdcbench reads version %d: save a new baseline",
+			path, b.Version, baselineVersion)
+	}
+	return &b, nil
+}
+
+// Regression is the check of one metric of one algorithm.
+type Regression struct {
+	Algorithm  string  `json:"algorithm"`
+	Metric     string  `json:"metric"`
+	Baseline   Metric  `json:"baseline"`
+	Current    Metric  `json:"current"`
+	Delta      float64 `json:"delta"` // (current - baseline) / baseline
+	P          float64 `json:"p"`
+	Regressed  bool    `json:"regressed"`
+	Improved   bool    `json:"improved"`
+	Comparable bool    `json:"comparable"` // both sides have values
+}
+
+// checkBaseline compares cur against base, metric by metric. A metric has
+// regressed when the Mann-Whitney U test finds the difference significant
+// at alpha and it is worse than threshold (a fraction): noise alone rarely
+// passes the first test, and a significant but negligible change does not
+// pass the second.
+func checkBaseline(base, cur *Baseline, alpha, threshold float64) []Regression {
+	var out []Regression
+	for _, ba := range base.Algorithms {
+		var ca *AlgorithmMetrics
+		for i := range cur.Algorithms {
+			if cur.Algorithms[i].Algorithm == ba.Algorithm {
+				ca = &cur.Algorithms[i]
+			}
+		}
+		if ca == nil {
+			continue
+		}
+		for _, m := range baselineMetrics {
+			bm, cm := m.get(&ba), m.get(ca)
+			r := Regression{Algorithm: ba.Algorithm, Metric: m.name, Baseline: bm, Current: cm,
+				P: mannWhitneyU(bm.Values, cm.Values), Comparable: len(bm.Values) > 0 && len(cm.Values) > 0}
+			// A metric one side did not measure, as the peak RSS where it
+			// cannot be reset, is shown but never gated.
+			switch {
+			case !r.Comparable:
+			case bm.Mean != 0:
+				r.Delta = (cm.Mean - bm.Mean) / bm.Mean
+			case cm.Mean != 0:
+				r.Delta = 1 // from nothing to something: count it as doubling
+			}
+			worse := r.Delta * float64(-m.better)
+			if r.Comparable && r.P < alpha {
+				r.Regressed = worse > threshold
+				r.Improved = -worse > threshold
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func printBaselineCheck(w io.Writer, base, cur *Baseline, regs []Regression, alpha, threshold float64) {
+	fmt.Fprintf(w, "baseline: %s, %s/%s, %d CPU(s), %s\n", base.Created.Format(time.RFC3339),
+		base.Machine.GOOS, base.Machine.GOARCH, base.Machine.CPUs, base.Machine.GoVersion)
+	c := base.Config
+	mode := "default"
+	if c.Pooled {
+		mode = "pooled"
+	}
+	fmt.Fprintf(w, "config:   %s c=%d %s, %d run(s) baseline, %d run(s) now\n", c.Sizes, c.Concurrency, mode,
+		c.Repetitions, cur.Config.Repetitions)
+	if base.Machine != cur.Machine {
+		fmt.Fprintf(w, "warning:  measured on %s/%s, %d CPU(s), %s now: numbers may not compare\n",
+			cur.Machine.GOOS, cur.Machine.GOARCH, cur.Machine.CPUs, cur.Machine.GoVersion)
+	}
+	if base.Dataset.Files != cur.Dataset.Files || base.Dataset.Bytes != cur.Dataset.Bytes {
+		fmt.Fprintf(w, "warning:  dataset was %d file(s), %d bytes; now %d file(s), %d bytes\n",
+			base.Dataset.Files, base.Dataset.Bytes, cur.Dataset.Files, cur.Dataset.Bytes)
+	}
+
+	fmt.Fprintf(w, "\n%-16s %-12s %18s %18s %10s %8s\n", "algorithm", "metric", "baseline", "current", "delta", "p")
+	for _, r := range regs {
+		delta := "~"
+		if r.Comparable && r.P < alpha {
+			delta = fmt.Sprintf("%+.2f%%", 100*r.Delta)
+		}
+		verdict := ""
+		switch {
+		case r.Regressed:
+			verdict = "  REGRESSION"
+		case r.Improved:
+			verdict = "  improved"
+		}
+		fmt.Fprintf(w, "%-16s %-12s %18s %18s %10s %8.3f%s\n", r.Algorithm, r.Metric,
+			metricCell(r.Baseline, "%.1f"), metricCell(r.Current, "%.1f"), delta, r.P, verdict)
+	}
+	fmt.Fprintf(w, "\n~ = no significant difference (Mann-Whitney U, alpha=%g); regressions are\n", alpha)
+	fmt.Fprintf(w, "significant changes for the worse by more than %.1f%%.\n", 100*threshold)
+}
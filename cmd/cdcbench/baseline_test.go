@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func scaled(values []float64, f float64) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = v * f
+	}
+	return out
+}
+
+func TestCheckBaseline(t *testing.T) {
+	throughput := []float64{100, 101, 99, 102, 98}
+	allocs := []float64{1000, 1001, 999, 1002, 998}
+	rss := []float64{50, 51, 49, 52, 48}
+	metrics := func(tp, al, by, peak []float64) *Baseline {
+		return &Baseline{Algorithms: []AlgorithmMetrics{{Algorithm: "fastcdc",
+			Throughput: newMetric(tp), AllocsPerOp: newMetric(al), BytesPerOp: newMetric(by), PeakRSS: newMetric(peak)}}}
+	}
+	base := metrics(throughput, allocs, allocs, rss)
+
+	for _, tc := range []struct {
+		name                string
+		base, cur           *Baseline // base defaults to the one above
+		regressed, improved []string
+		incomparable        []string
+	}{
+		{name: "same", cur: metrics(throughput, allocs, allocs, rss)},
+		// Within the noise of each other: not significant.
+		{name: "noise", cur: metrics([]float64{99, 103, 97, 101, 100}, allocs, allocs, rss)},
+		{name: "slower", cur: metrics(scaled(throughput, 0.8), allocs, allocs, rss), regressed: []string{"MB/s"}},
+		{name: "faster", cur: metrics(scaled(throughput, 1.2), allocs, allocs, rss), improved: []string{"MB/s"}},
+		{name: "more allocations", cur: metrics(throughput, scaled(allocs, 2), scaled(allocs, 0.5), rss),
+			regressed: []string{"allocs/op"}, improved: []string{"B/op"}},
+		// Significant, but below the threshold.
+		{name: "negligible", cur: metrics(scaled(throughput, 0.99), allocs, allocs, rss)},
+		{name: "no peak", cur: metrics(throughput, allocs, allocs, nil), incomparable: []string{"peak RSS MB"}},
+		{name: "peak not in the baseline", base: metrics(throughput, allocs, allocs, nil),
+			cur: metrics(throughput, allocs, allocs, rss), incomparable: []string{"peak RSS MB"}},
+		{name: "unknown algorithm", cur: &Baseline{Algorithms: []AlgorithmMetrics{{Algorithm: "ultracdc"}}}},
+	} {
+		if tc.base == nil {
+			tc.base = base
+		}
+		regs := checkBaseline(tc.base, tc.cur, 0.05, 0.05)
+		if tc.name == "unknown algorithm" {
+			if len(regs) != 0 {
+				t.Errorf("%s: %+v", tc.name, regs)
+			}
+			continue
+		}
+		if len(regs) != len(baselineMetrics) {
+			t.Fatalf("%s: %d metrics checked, want %d", tc.name, len(regs), len(baselineMetrics))
+		}
+		for _, r := range regs {
+			has := func(names []string) bool {
+				for _, n := range names {
+					if n == r.Metric {
+						return true
+					}
+				}
+				return false
+			}
+			if r.Regressed != has(tc.regressed) || r.Improved != has(tc.improved) || r.Comparable == has(tc.incomparable) {
+				t.Errorf("%s: %s %+v", tc.name, r.Metric, r)
+			}
+			if !r.Comparable && r.Delta != 0 {
+				t.Errorf("%s: %s not comparable, with delta %g", tc.name, r.Metric, r.Delta)
+			}
+		}
+	}
+}
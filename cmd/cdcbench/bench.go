@@ -10,6 +10,7 @@ import (
 	"time"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
 )
 
 // Sample is one point in the time series captured while the benchmark runs.
@@ -18,29 +19,53 @@ type Sample struct {
 	Files       int64   `json:"files"`
 	Bytes       int64   `json:"bytes"`
 	Chunks      int64   `json:"chunks"`
-	RSSMB       float64 `json:"rss_mb"`        // current resident set size
+	RSSMB       float64 `json:"rss_mb"`        // current resident set size (see Result.CurrentRSS)
 	HeapInuseMB float64 `json:"heap_inuse_mb"` // live heap
 	HeapSysMB   float64 `json:"heap_sys_mb"`   // heap reserved from the OS
 	CPUSec      float64 `json:"cpu_sec"`       // cumulative user+sys CPU time
 	NumGC       uint32  `json:"num_gc"`
+
+	// Linux only, 0 where unavailable.
+	PSSMB        float64 `json:"pss_mb,omitempty"`         // proportional set size
+	CgroupMB     float64 `json:"cgroup_mb,omitempty"`      // cgroup v2 memory.current
+	CgroupPeakMB float64 `json:"cgroup_peak_mb,omitempty"` // cgroup v2 memory.peak
+
+	Goroutines int `json:"goroutines"`
 }
 
 // Result is the end-of-run summary (the "statistics" output).
 type Result struct {
-	Mode          string   `json:"mode"`
-	Algorithm     string   `json:"algorithm"`
-	Concurrency   int      `json:"concurrency"`
-	Files         int64    `json:"files"`
-	Chunks        int64    `json:"chunks"`
-	Bytes         int64    `json:"bytes"`
-	ElapsedSec    float64  `json:"elapsed_sec"`
-	ThroughputMBs float64  `json:"throughput_mb_s"`
-	PeakRSSMB     float64  `json:"peak_rss_mb"`
-	HeapSysMB     float64  `json:"heap_sys_mb"`
-	TotalAllocGB  float64  `json:"total_alloc_gb"`
-	NumGC         uint32   `json:"num_gc"`
-	CPUSec        float64  `json:"cpu_sec"`
-	Samples       []Sample `json:"samples"`
+	Mode          string  `json:"mode"`
+	Algorithm     string  `json:"algorithm"`
+	Key           string  `json:"key_fingerprint,omitempty"`
+	Concurrency   int     `json:"concurrency"`
+	Files         int64   `json:"files"`
+	Chunks        int64   `json:"chunks"`
+	Bytes         int64   `json:"bytes"`
+	ElapsedSec    float64 `json:"elapsed_sec"`
+	ThroughputMBs float64 `json:"throughput_mb_s"`
+	PeakRSSMB     float64 `json:"peak_rss_mb"` // 0 when PeakRSSUnavailable
+	HeapSysMB     float64 `json:"heap_sys_mb"`
+	TotalAllocGB  float64 `json:"total_alloc_gb"`
+	AllocBytes    uint64  `json:"alloc_bytes"` // TotalAllocGB, exactly
+	Mallocs       uint64  `json:"mallocs"`     // heap objects allocated
+	NumGC         uint32  `json:"num_gc"`
+	CPUSec        float64 `json:"cpu_sec"`
+
+	// CurrentRSS tells the samples' rss_mb is the current RSS, read from
+	// /proc; otherwise it is the getrusage high-water mark and only grows.
+	CurrentRSS bool `json:"current_rss"`
+
+	// PeakRSSUnavailable tells the RSS high-water mark could not be reset
+	// at the start of the run (outside Linux, or where /proc/self/clear_refs
+	// is not writable). The only peak left is the process's, which includes
+	// every earlier run sharing it, so none is reported.
+	PeakRSSUnavailable bool `json:"peak_rss_unavailable,omitempty"`
+
+	CgroupPeakMB   float64 `json:"cgroup_peak_mb,omitempty"`
+	PeakGoroutines int     `json:"peak_goroutines"`
+
+	Samples []Sample `json:"samples"`
 }
 
 // maxRSSBytes reads the process peak resident set size. Maxrss is bytes on
@@ -63,12 +88,6 @@ func cpuSeconds() float64 {
 	return tv(ru.Utime) + tv(ru.Stime)
 }
 
-// currentRSSBytes approximates the current (not peak) RSS. getrusage only
-// exposes the high-water mark portably, so we report HeapSys as a live proxy
-// alongside it; for the time series we record both the running Maxrss and the
-// live heap so the grapher can show either.
-func currentRSSBytes() int64 { return maxRSSBytes() }
-
 // BenchConfig parameterizes a run.
 type BenchConfig struct {
 	Root        string
@@ -135,25 +154,41 @@ func Run(cfg BenchConfig) (Result, error) {
 		}
 	}
 
+	// CPU time, allocation and GC counters are process-wide: report them
+	// relative to the start of the run, so runs sharing a process (matrix
+	// mode) each get their own. So does the peak RSS where it can be reset.
+	var ms0 runtime.MemStats
+	runtime.ReadMemStats(&ms0)
+	cpu0 := cpuSeconds()
+	probe := newMemProbe()
+	peakReset := probe.resetPeak()
+
 	// Background sampler.
 	var samples []Sample
 	stop := make(chan struct{})
 	var samplerDone sync.WaitGroup
 	start := time.Now()
+	var currentRSS bool
 	sample := func() Sample {
 		var ms runtime.MemStats
 		runtime.ReadMemStats(&ms)
+		mem := probe.read()
+		currentRSS = mem.rssFromProc
 		const mb = 1 << 20
 		return Sample{
-			ElapsedSec:  time.Since(start).Seconds(),
-			Files:       atomic.LoadInt64(&filesProcessed),
-			Bytes:       atomic.LoadInt64(&bytesProcessed),
-			Chunks:      atomic.LoadInt64(&chunks),
-			RSSMB:       float64(currentRSSBytes()) / mb,
-			HeapInuseMB: float64(ms.HeapInuse) / mb,
-			HeapSysMB:   float64(ms.HeapSys) / mb,
-			CPUSec:      cpuSeconds(),
-			NumGC:       ms.NumGC,
+			ElapsedSec:   time.Since(start).Seconds(),
+			Files:        atomic.LoadInt64(&filesProcessed),
+			Bytes:        atomic.LoadInt64(&bytesProcessed),
+			Chunks:       atomic.LoadInt64(&chunks),
+			RSSMB:        float64(mem.rss) / mb,
+			HeapInuseMB:  float64(ms.HeapInuse) / mb,
+			HeapSysMB:    float64(ms.HeapSys) / mb,
+			CPUSec:       cpuSeconds() - cpu0,
+			NumGC:        ms.NumGC - ms0.NumGC,
+			PSSMB:        float64(mem.pss) / mb,
+			CgroupMB:     float64(mem.cgroup) / mb,
+			CgroupPeakMB: float64(mem.cgroupPeak) / mb,
+			Goroutines:   runtime.NumGoroutine(),
 		}
 	}
 	samplerDone.Add(1)
@@ -193,6 +228,17 @@ func Run(cfg BenchConfig) (Result, error) {
 	runtime.ReadMemStats(&ms)
 	const mb = 1 << 20
 
+	var peakRSS int64
+	if peakReset {
+		peakRSS = probe.peak()
+	}
+	var cgroupPeak float64
+	var peakGoroutines int
+	for _, s := range samples {
+		cgroupPeak = max(cgroupPeak, s.CgroupPeakMB, s.CgroupMB)
+		peakGoroutines = max(peakGoroutines, s.Goroutines)
+	}
+
 	mode := "default"
 	if cfg.Pooled {
 		mode = "pooled"
@@ -200,18 +246,27 @@ func Run(cfg BenchConfig) (Result, error) {
 	res := Result{
 		Mode:          mode,
 		Algorithm:     cfg.Algorithm,
+		Key:           keyflag.Fingerprint(cfg.Opts.Key),
 		Concurrency:   cfg.Concurrency,
 		Files:         filesProcessed,
 		Chunks:        chunks,
 		Bytes:         bytesProcessed,
 		ElapsedSec:    elapsed.Seconds(),
 		ThroughputMBs: (float64(bytesProcessed) / mb) / elapsed.Seconds(),
-		PeakRSSMB:     float64(maxRSSBytes()) / mb,
+		PeakRSSMB:     float64(peakRSS) / mb,
 		HeapSysMB:     float64(ms.HeapSys) / mb,
-		TotalAllocGB:  float64(ms.TotalAlloc) / (1 << 30),
-		NumGC:         ms.NumGC,
-		CPUSec:        cpuSeconds(),
-		Samples:       samples,
+		TotalAllocGB:  float64(ms.TotalAlloc-ms0.TotalAlloc) / (1 << 30),
+		AllocBytes:    ms.TotalAlloc - ms0.TotalAlloc,
+		Mallocs:       ms.Mallocs - ms0.Mallocs,
+		NumGC:         ms.NumGC - ms0.NumGC,
+		CPUSec:        cpuSeconds() - cpu0,
+
+		CurrentRSS:         currentRSS,
+		PeakRSSUnavailable: !peakReset,
+		CgroupPeakMB:       cgroupPeak,
+		PeakGoroutines:     peakGoroutines,
+
+		Samples: samples,
 	}
 	return res, nil
 }
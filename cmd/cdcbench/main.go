@@ -27,14 +27,26 @@
 // Usage:
 //
 //	cdcbench run  -root DIR [-concurrency N] [-algo fastcdc] [-pooled] \
+//	              [-key-file PATH | -key-env VAR | -key-hex HEX] \
 //	              [-format text|json|csv] [-plot OUTDIR]
 //	cdcbench plot -in run.json -out OUTDIR
+//	cdcbench matrix -config matrix.json [-out results.json] [-report DIR]
+//	cdcbench baseline save  -root DIR -algos a,b -out baseline.json
+//	cdcbench baseline check -root DIR -baseline baseline.json
+//
+// matrix runs every combination of algorithms, size triples, concurrency
+// levels and pooling from a config file, repeatedly and in random order, and
+// compares the cells with a significance test. baseline saves the throughput,
+// allocations and peak memory of algorithms and later fails when a new run
+// regresses significantly from them: a performance gate for CI.
 package main
 
 import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -42,6 +54,7 @@ import (
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
 
 	"flag"
 )
@@ -55,6 +68,10 @@ func main() {
 		cmdRun(os.Args[2:])
 	case "plot":
 		cmdPlot(os.Args[2:])
+	case "matrix":
+		cmdMatrix(os.Args[2:])
+	case "baseline":
+		cmdBaseline(os.Args[2:])
 	default:
 		usage()
 	}
@@ -65,8 +82,15 @@ func usage() {
 
   cdcbench run  -root DIR [-concurrency N] [-algo NAME] [-pooled] \
                 [-min B] [-avg B] [-max B] [-sample MS] \
+                [-key-file PATH | -key-env VAR | -key-hex HEX] \
                 [-format text|json|csv] [-plot OUTDIR]
-  cdcbench plot -in run.json -out OUTDIR`)
+  cdcbench plot -in run.json -out OUTDIR
+  cdcbench matrix -config matrix.json [-root DIR] [-out results.json] [-report DIR] \
+                [-key-file PATH | -key-env VAR | -key-hex HEX]
+  cdcbench baseline save  -root DIR [-algos a,b] [-min B -avg B -max B] \
+                [-concurrency N] [-pooled] [-reps N] [-warmup N] -out baseline.json
+  cdcbench baseline check -root DIR -baseline baseline.json [-reps N] \
+                [-threshold PCT] [-alpha P]`)
 	os.Exit(2)
 }
 
@@ -82,6 +106,8 @@ func cmdRun(args []string) {
 	sampleMS := fs.Int("sample", 100, "time-series sampling interval in milliseconds")
 	format := fs.String("format", "text", "stats output: text | json | csv")
 	plotDir := fs.String("plot", "", "also render memory/CPU graphs into this directory")
+	var key []byte
+	keyflag.Register(fs, &key)
 	fs.Parse(args)
 
 	if *root == "" {
@@ -94,7 +120,7 @@ func cmdRun(args []string) {
 		Algorithm:   *algo,
 		Concurrency: *conc,
 		Pooled:      *pooled,
-		Opts:        &chunkers.ChunkerOpts{MinSize: *minSize, NormalSize: *avgSize, MaxSize: *maxSize},
+		Opts:        &chunkers.ChunkerOpts{MinSize: *minSize, NormalSize: *avgSize, MaxSize: *maxSize, Key: key},
 		SampleEvery: time.Duration(*sampleMS) * time.Millisecond,
 	})
 	if err != nil {
@@ -154,22 +180,232 @@ func cmdPlot(args []string) {
 	fmt.Fprintf(os.Stderr, "graphs written to %s\n", *out)
 }
 
+func cmdMatrix(args []string) {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	config := fs.String("config", "", "matrix config file (required)")
+	root := fs.String("root", "", "dataset root, overriding the config's")
+	out := fs.String("out", "", "write the combined JSON results to this file")
+	reportDir := fs.String("report", "", "render the comparison report and charts into this directory")
+	quiet := fs.Bool("q", false, "do not report progress on stderr")
+	var key []byte
+	keyflag.Register(fs, &key)
+	fs.Parse(args)
+	if *config == "" {
+		fmt.Fprintln(os.Stderr, "matrix: -config is required")
+		os.Exit(2)
+	}
+
+	mc, err := loadMatrixConfig(*config)
+	if err == nil {
+		if *root != "" {
+			mc.Root = *root
+		}
+		err = mc.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "matrix:", err)
+		os.Exit(2)
+	}
+
+	var progress func(int, int, Cell, bool)
+	if !*quiet {
+		progress = func(done, total int, c Cell, warmup bool) {
+			phase := "run"
+			if warmup {
+				phase = "warm-up"
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s\n", done+1, total, phase, c)
+		}
+	}
+	res, err := RunMatrix(mc, key, progress)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "matrix:", err)
+		os.Exit(1)
+	}
+
+	printMatrix(os.Stdout, res)
+	if *out != "" {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*out, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "matrix:", err)
+			os.Exit(1)
+		}
+	}
+	if *reportDir != "" {
+		if err := renderMatrix(*reportDir, res); err != nil {
+			fmt.Fprintln(os.Stderr, "matrix:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "report written to %s\n", filepath.Join(*reportDir, "report.md"))
+	}
+}
+
+func cmdBaseline(args []string) {
+	if len(args) == 0 || (args[0] != "save" && args[0] != "check") {
+		usage()
+	}
+	save := args[0] == "save"
+	fs := flag.NewFlagSet("baseline "+args[0], flag.ExitOnError)
+	root := fs.String("root", "", "dataset root to walk (required)")
+	reps := fs.Int("reps", 10, "measured runs per algorithm")
+	warmup := fs.Int("warmup", 1, "discarded runs per algorithm before measuring")
+	quiet := fs.Bool("q", false, "do not report progress on stderr")
+	var key []byte
+	keyflag.Register(fs, &key)
+	var (
+		algos, out, in         *string
+		conc, minSize, avgSize *int
+		maxSize                *int
+		pooled                 *bool
+		threshold, alpha       *float64
+	)
+	if save {
+		algos = fs.String("algos", "fastcdc-v1.0.0,jc-v1.1.0,ultracdc-v1.0.0", "comma-separated algorithms")
+		conc = fs.Int("concurrency", runtime.NumCPU(), "number of concurrent worker goroutines")
+		pooled = fs.Bool("pooled", false, "use NewChunkerBuffer with a pooled per-worker buffer")
+		minSize = fs.Int("min", 2*1024, "minimum chunk size in bytes")
+		avgSize = fs.Int("avg", 8*1024, "average/normal chunk size in bytes")
+		maxSize = fs.Int("max", 64*1024, "maximum chunk size in bytes")
+		out = fs.String("out", "", "baseline file to write (required)")
+	} else {
+		in = fs.String("baseline", "", "baseline file to check against (required)")
+		threshold = fs.Float64("threshold", 5, "regression threshold in percent")
+		alpha = fs.Float64("alpha", 0.05, "significance level")
+	}
+	fs.Parse(args[1:])
+	if *root == "" || (save && *out == "") || (!save && *in == "") {
+		fmt.Fprintln(os.Stderr, "baseline: -root and -out (save) or -baseline (check) are required")
+		os.Exit(2)
+	}
+
+	var progress func(int, int, Cell, bool)
+	if !*quiet {
+		progress = func(done, total int, c Cell, warmup bool) {
+			phase := "run"
+			if warmup {
+				phase = "warm-up"
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s\n", done+1, total, phase, c.Algorithm)
+		}
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, "baseline:", err)
+		os.Exit(1)
+	}
+
+	if save {
+		cfg := BaselineConfig{Sizes: SizeTriple{*minSize, *avgSize, *maxSize}, Concurrency: *conc, Pooled: *pooled,
+			Repetitions: *reps, Warmup: *warmup}
+		b, err := measureBaseline(*root, splitAlgos(*algos), cfg, key, progress)
+		if err != nil {
+			fail(err)
+		}
+		data, err := json.MarshalIndent(b, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*out, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fail(err)
+		}
+		for _, am := range b.Algorithms {
+			fmt.Printf("%-16s %s MB/s  %s allocs/op  %s B/op  %s MB peak RSS\n", am.Algorithm,
+				metricCell(am.Throughput, "%.1f"), metricCell(am.AllocsPerOp, "%.1f"),
+				metricCell(am.BytesPerOp, "%.0f"), metricCell(am.PeakRSS, "%.1f"))
+		}
+		fmt.Fprintf(os.Stderr, "baseline written to %s\n", *out)
+		return
+	}
+
+	base, err := loadBaseline(*in)
+	if err != nil {
+		fail(err)
+	}
+	if fp := keyflag.Fingerprint(key); fp != base.Key {
+		fail(fmt.Errorf("the baseline was measured with key %q, not %q", base.Key, fp))
+	}
+	cfg := base.Config
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "reps":
+			cfg.Repetitions = *reps
+		case "warmup":
+			cfg.Warmup = *warmup
+		}
+	})
+	var algoNames []string
+	for _, am := range base.Algorithms {
+		algoNames = append(algoNames, am.Algorithm)
+	}
+	cur, err := measureBaseline(*root, algoNames, cfg, key, progress)
+	if err != nil {
+		fail(err)
+	}
+	regs := checkBaseline(base, cur, *alpha, *threshold/100)
+	printBaselineCheck(os.Stdout, base, cur, regs, *alpha, *threshold/100)
+	var n int
+	for _, r := range regs {
+		if r.Regressed {
+			n++
+		}
+	}
+	if n > 0 {
+		fail(fmt.Errorf("%d regression(s) against %s", n, *in))
+	}
+}
+
+func splitAlgos(list string) []string {
+	var out []string
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
 // printText prints the human-readable summary, matching the style used in the
 // project's memory benchmarks.
 func printText(r Result) {
+	algo := r.Algorithm
+	if r.Key != "" {
+		algo += " key=" + r.Key
+	}
 	fmt.Printf("mode=%-7s conc=%-4d algo=%-8s files=%d chunks=%d\n",
-		r.Mode, r.Concurrency, r.Algorithm, r.Files, r.Chunks)
+		r.Mode, r.Concurrency, algo, r.Files, r.Chunks)
 	fmt.Printf("  time=%.2fs  throughput=%.0f MB/s  data=%.1f MB  cpu=%.1fs\n",
 		r.ElapsedSec, r.ThroughputMBs, float64(r.Bytes)/(1<<20), r.CPUSec)
-	fmt.Printf("  peakRSS=%.1f MB  heapSys=%.1f MB  totalAlloc=%.1f GB  numGC=%d  samples=%d\n",
-		r.PeakRSSMB, r.HeapSysMB, r.TotalAllocGB, r.NumGC, len(r.Samples))
+	peak := fmt.Sprintf("%.1f MB", r.PeakRSSMB)
+	if r.PeakRSSUnavailable {
+		peak = "n/a"
+	}
+	fmt.Printf("  peakRSS=%s  heapSys=%.1f MB  totalAlloc=%.1f GB  numGC=%d  samples=%d\n",
+		peak, r.HeapSysMB, r.TotalAllocGB, r.NumGC, len(r.Samples))
+	if len(r.Samples) == 0 {
+		return
+	}
+	last := r.Samples[len(r.Samples)-1]
+	fmt.Printf("  goroutines=%d (peak)", r.PeakGoroutines)
+	if r.CurrentRSS {
+		fmt.Printf("  rss=%.1f MB (end)", last.RSSMB)
+	}
+	if last.PSSMB > 0 {
+		fmt.Printf("  pss=%.1f MB (end)", last.PSSMB)
+	}
+	if r.CgroupPeakMB > 0 {
+		fmt.Printf("  cgroupPeak=%.1f MB", r.CgroupPeakMB)
+	}
+	fmt.Println()
 }
 
 // printCSV writes the time series as CSV to stdout (one row per sample).
 func printCSV(r Result) {
-	fmt.Println("elapsed_sec,files,bytes,chunks,rss_mb,heap_inuse_mb,heap_sys_mb,cpu_sec,num_gc")
+	fmt.Println("elapsed_sec,files,bytes,chunks,rss_mb,heap_inuse_mb,heap_sys_mb,cpu_sec,num_gc,pss_mb,cgroup_mb,cgroup_peak_mb,goroutines")
 	for _, s := range r.Samples {
-		fmt.Printf("%.3f,%d,%d,%d,%.2f,%.2f,%.2f,%.3f,%d\n",
-			s.ElapsedSec, s.Files, s.Bytes, s.Chunks, s.RSSMB, s.HeapInuseMB, s.HeapSysMB, s.CPUSec, s.NumGC)
+		fmt.Printf("%.3f,%d,%d,%d,%.2f,%.2f,%.2f,%.3f,%d,%.2f,%.2f,%.2f,%d\n",
+			s.ElapsedSec, s.Files, s.Bytes, s.Chunks, s.RSSMB, s.HeapInuseMB, s.HeapSysMB, s.CPUSec, s.NumGC,
+			s.PSSMB, s.CgroupMB, s.CgroupPeakMB, s.Goroutines)
 	}
 }
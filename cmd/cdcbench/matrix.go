@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// MatrixConfig is the config file of `cdcbench matrix`: every combination of
+// algorithm, size triple, concurrency and pooling is a cell, run Repetitions
+// times. Omitted lists default to the `run` defaults.
+type MatrixConfig struct {
+	Root        string       `json:"root"`
+	Algorithms  []string     `json:"algorithms"`
+	Sizes       []SizeTriple `json:"sizes,omitempty"`
+	Concurrency []int        `json:"concurrency,omitempty"`
+	Pooled      []bool       `json:"pooled,omitempty"`
+	Repetitions int          `json:"repetitions,omitempty"` // default 5
+	Warmup      *int         `json:"warmup,omitempty"`      // runs per cell discarded before measuring, default 1
+	Seed        int64        `json:"seed,omitempty"`        // of the run order, default 1
+	SampleMS    int          `json:"sample_ms,omitempty"`   // default 100
+	Alpha       float64      `json:"alpha,omitempty"`       // significance level, default 0.05
+}
+
+type SizeTriple struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+func (st SizeTriple) String() string {
+	return fmt.Sprintf("%s/%s/%s", sizeLabel(st.Min), sizeLabel(st.Avg), sizeLabel(st.Max))
+}
+
+func sizeLabel(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dK", n>>10)
+	}
+	return fmt.Sprint(n)
+}
+
+// loadMatrixConfig reads a config file and fills in the defaults. The caller
+// validates it once it has applied its overrides.
+func loadMatrixConfig(path string) (*MatrixConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mc MatrixConfig
+	if err := json.Unmarshal(data, &mc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(mc.Sizes) == 0 {
+		mc.Sizes = []SizeTriple{{2 * 1024, 8 * 1024, 64 * 1024}}
+	}
+	if len(mc.Concurrency) == 0 {
+		mc.Concurrency = []int{100}
+	}
+	if len(mc.Pooled) == 0 {
+		mc.Pooled = []bool{false}
+	}
+	if mc.Repetitions == 0 {
+		mc.Repetitions = 5
+	}
+	if mc.Warmup == nil {
+		one := 1
+		mc.Warmup = &one
+	}
+	if mc.Seed == 0 {
+		mc.Seed = 1
+	}
+	if mc.SampleMS == 0 {
+		mc.SampleMS = 100
+	}
+	if mc.Alpha == 0 {
+		mc.Alpha = 0.05
+	}
+	return &mc, nil
+}
+
+func (mc *MatrixConfig) validate() error {
+	switch {
+	case mc.Root == "":
+		return fmt.Errorf("matrix: root is required")
+	case len(mc.Algorithms) == 0:
+		return fmt.Errorf("matrix: algorithms is required")
+	case mc.Repetitions < 1, *mc.Warmup < 0, mc.SampleMS < 1:
+		return fmt.Errorf("matrix: repetitions and sample_ms must be positive, warmup not negative")
+	case mc.Alpha <= 0 || mc.Alpha >= 1:
+		return fmt.Errorf("matrix: alpha must be between 0 and 1")
+	}
+	for _, c := range mc.Concurrency {
+		if c < 1 {
+			return fmt.Errorf("matrix: concurrency must be at least 1")
+		}
+	}
+	return nil
+}
+
+// Cell is one configuration of the matrix.
+type Cell struct {
+	Algorithm   string     `json:"algorithm"`
+	Sizes       SizeTriple `json:"sizes"`
+	Concurrency int        `json:"concurrency"`
+	Pooled      bool       `json:"pooled"`
+}
+
+func (c Cell) String() string {
+	mode := "default"
+	if c.Pooled {
+		mode = "pooled"
+	}
+	return fmt.Sprintf("%s %s c=%d %s", c.Algorithm, c.Sizes, c.Concurrency, mode)
+}
+
+// cells expands the config into its cells, in config order.
+func (mc *MatrixConfig) cells() []Cell {
+	var out []Cell
+	for _, algo := range mc.Algorithms {
+		for _, st := range mc.Sizes {
+			for _, conc := range mc.Concurrency {
+				for _, pooled := range mc.Pooled {
+					out = append(out, Cell{algo, st, conc, pooled})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// differsByOne returns the one factor c and o differ in, "" if they differ
+// in none or several: only such pairs make a controlled comparison.
+func (c Cell) differsByOne(o Cell) string {
+	var factors []string
+	if c.Algorithm != o.Algorithm {
+		factors = append(factors, "algorithm")
+	}
+	if c.Sizes != o.Sizes {
+		factors = append(factors, "sizes")
+	}
+	if c.Concurrency != o.Concurrency {
+		factors = append(factors, "concurrency")
+	}
+	if c.Pooled != o.Pooled {
+		factors = append(factors, "pooled")
+	}
+	if len(factors) != 1 {
+		return ""
+	}
+	return factors[0]
+}
+
+// CellSummary holds the measurements of a cell over its repetitions.
+type CellSummary struct {
+	Cell
+	Throughput Metric `json:"throughput_mb_s"`
+	Elapsed    Metric `json:"elapsed_sec"`
+	CPU        Metric `json:"cpu_sec"`
+	PeakRSS    Metric `json:"peak_rss_mb"`
+	TotalAlloc Metric `json:"total_alloc_gb"`
+}
+
+// matrixMetrics are the metrics compared between cells, with whether a
+// larger value is better.
+var matrixMetrics = []struct {
+	name   string
+	better int // +1 higher is better, -1 lower is better
+	get    func(*CellSummary) Metric
+}{
+	{"throughput_mb_s", +1, func(cs *CellSummary) Metric { return cs.Throughput }},
+	{"cpu_sec", -1, func(cs *CellSummary) Metric { return cs.CPU }},
+	{"peak_rss_mb", -1, func(cs *CellSummary) Metric { return cs.PeakRSS }},
+}
+
+// Comparison is the significance test of one metric between two cells that
+// differ in one factor.
+type Comparison struct {
+	A           int     `json:"cell_a"` // index in Cells
+	B           int     `json:"cell_b"`
+	CellA       string  `json:"a"`
+	CellB       string  `json:"b"`
+	Factor      string  `json:"factor"`
+	Metric      string  `json:"metric"`
+	Delta       float64 `json:"delta"` // (mean B - mean A) / mean A
+	P           float64 `json:"p"`
+	Significant bool    `json:"significant"` // P < alpha
+	Better      bool    `json:"better"`      // B improves on A, if significant
+}
+
+// MatrixRun is one measured run, in execution order.
+type MatrixRun struct {
+	Cell   int    `json:"cell"`
+	Rep    int    `json:"rep"`
+	Result Result `json:"result"`
+}
+
+// MatrixResult is the combined output of a matrix run.
+type MatrixResult struct {
+	Schema      int           `json:"schema_version"`
+	Config      *MatrixConfig `json:"config"`
+	Key         string        `json:"key_fingerprint,omitempty"`
+	Started     time.Time     `json:"started"`
+	Cells       []CellSummary `json:"cells"`
+	Comparisons []Comparison  `json:"comparisons"`
+	Runs        []MatrixRun   `json:"runs"`
+}
+
+const matrixSchema = 1
+
+// RunMatrix runs every cell *mc.Warmup times, discarding the results, then
+// mc.Repetitions times. Both phases run in an order shuffled with mc.Seed,
+// so drift over the session (thermal throttling, page cache, other load)
+// spreads over all cells instead of biasing the last ones. progress, if
+// set, is told of every run as it starts.
+func RunMatrix(mc *MatrixConfig, key []byte, progress func(done, total int, c Cell, warmup bool)) (*MatrixResult, error) {
+	cells := mc.cells()
+	rng := rand.New(rand.NewSource(mc.Seed))
+	schedule := func(reps int) []MatrixRun {
+		var runs []MatrixRun
+		for rep := 0; rep < reps; rep++ {
+			for i := range cells {
+				runs = append(runs, MatrixRun{Cell: i, Rep: rep})
+			}
+		}
+		rng.Shuffle(len(runs), func(i, j int) { runs[i], runs[j] = runs[j], runs[i] })
+		return runs
+	}
+	warmups, runs := schedule(*mc.Warmup), schedule(mc.Repetitions)
+	total := len(warmups) + len(runs)
+
+	run := func(c Cell) (Result, error) {
+		// Start every run from the same state: no garbage left by the
+		// previous one, memory returned to the OS.
+		runtime.GC()
+		debug.FreeOSMemory()
+		return Run(BenchConfig{
+			Root:        mc.Root,
+			Algorithm:   c.Algorithm,
+			Concurrency: c.Concurrency,
+			Pooled:      c.Pooled,
+			Opts:        &chunkers.ChunkerOpts{MinSize: c.Sizes.Min, NormalSize: c.Sizes.Avg, MaxSize: c.Sizes.Max, Key: key},
+			SampleEvery: time.Duration(mc.SampleMS) * time.Millisecond,
+		})
+	}
+
+	out := &MatrixResult{Schema: matrixSchema, Config: mc, Key: keyflag.Fingerprint(key), Started: time.Now().UTC()}
+	done := 0
+	for _, w := range warmups {
+		if progress != nil {
+			progress(done, total, cells[w.Cell], true)
+		}
+		if _, err := run(cells[w.Cell]); err != nil {
+			return nil, fmt.Errorf("%s: %w", cells[w.Cell], err)
+		}
+		done++
+	}
+	for i := range runs {
+		if progress != nil {
+			progress(done, total, cells[runs[i].Cell], false)
+		}
+		res, err := run(cells[runs[i].Cell])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cells[runs[i].Cell], err)
+		}
+		runs[i].Result = res
+		done++
+	}
+	out.Runs = runs
+	out.summarize(cells)
+	return out, nil
+}
+
+// summarize fills Cells and Comparisons from Runs.
+func (mr *MatrixResult) summarize(cells []Cell) {
+	values := make([][5][]float64, len(cells))
+	for _, r := range mr.Runs {
+		v := &values[r.Cell]
+		v[0] = append(v[0], r.Result.ThroughputMBs)
+		v[1] = append(v[1], r.Result.ElapsedSec)
+		v[2] = append(v[2], r.Result.CPUSec)
+		if !r.Result.PeakRSSUnavailable {
+			v[3] = append(v[3], r.Result.PeakRSSMB)
+		}
+		v[4] = append(v[4], r.Result.TotalAllocGB)
+	}
+	mr.Cells = make([]CellSummary, len(cells))
+	for i, c := range cells {
+		v := values[i]
+		mr.Cells[i] = CellSummary{Cell: c, Throughput: newMetric(v[0]), Elapsed: newMetric(v[1]),
+			CPU: newMetric(v[2]), PeakRSS: newMetric(v[3]), TotalAlloc: newMetric(v[4])}
+	}
+
+	mr.Comparisons = nil
+	for a := range cells {
+		for b := a + 1; b < len(cells); b++ {
+			factor := cells[a].differsByOne(cells[b])
+			if factor == "" {
+				continue
+			}
+			for _, m := range matrixMetrics {
+				ma, mb := m.get(&mr.Cells[a]), m.get(&mr.Cells[b])
+				if len(ma.Values) == 0 || len(mb.Values) == 0 {
+					continue // not measured, as the peak RSS where it cannot be reset
+				}
+				cmp := Comparison{A: a, B: b, CellA: cells[a].String(), CellB: cells[b].String(),
+					Factor: factor, Metric: m.name, P: mannWhitneyU(ma.Values, mb.Values)}
+				if ma.Mean != 0 {
+					cmp.Delta = (mb.Mean - ma.Mean) / ma.Mean
+				}
+				cmp.Significant = cmp.P < mr.Config.Alpha
+				cmp.Better = cmp.Significant && cmp.Delta*float64(m.better) > 0
+				mr.Comparisons = append(mr.Comparisons, cmp)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestNewMetric(t *testing.T) {
+	m := newMetric([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if m.Mean != 5 || math.Abs(m.Stddev-math.Sqrt(32.0/7)) > 1e-12 {
+		t.Fatalf("got %+v", m)
+	}
+	if m := newMetric([]float64{3}); m.Mean != 3 || m.Stddev != 0 {
+		t.Fatalf("one value: %+v", m)
+	}
+	if m := newMetric(nil); m.Mean != 0 || m.Stddev != 0 {
+		t.Fatalf("no values: %+v", m)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		a, b   []float64
+		lo, hi float64
+	}{
+		// Every value of b above every value of a: 2 of the C(10,5)
+		// orderings are as extreme.
+		{"separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252, 2.0 / 252},
+		{"reversed", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252, 2.0 / 252},
+		{"interleaved", []float64{1, 3, 5, 7, 9}, []float64{2, 4, 6, 8, 10}, 0.5, 1},
+		{"identical", []float64{5, 5, 5, 5}, []float64{5, 5, 5, 5}, 1, 1},
+		// Ties go through the normal approximation.
+		{"ties", []float64{1, 1, 2, 2, 3, 3}, []float64{7, 7, 8, 8, 9, 9}, 0, 0.01},
+		{"large", seq(0, 30), seq(15, 30), 0, 1e-4},
+		{"empty", nil, []float64{1, 2, 3}, 1, 1},
+	} {
+		p := mannWhitneyU(tc.a, tc.b)
+		if p < tc.lo-1e-12 || p > tc.hi+1e-12 {
+			t.Errorf("%s: p = %g, want in [%g, %g]", tc.name, p, tc.lo, tc.hi)
+		}
+	}
+}
+
+func seq(from float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = from + float64(i)
+	}
+	return out
+}
+
+func TestWithoutOutliers(t *testing.T) {
+	for _, tc := range []struct {
+		in, want []float64
+	}{
+		{[]float64{10, 11, 12, 10, 11, 50}, []float64{10, 11, 12, 10, 11}},
+		{[]float64{10, 11, 12, 10, 11, 0.5}, []float64{10, 11, 12, 10, 11}},
+		{[]float64{10, 11, 12, 13}, []float64{10, 11, 12, 13}},
+		{[]float64{1, 100, 1000}, []float64{1, 100, 1000}}, // too few to tell
+	} {
+		if got := withoutOutliers(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("withoutOutliers(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+	if q := quantile([]float64{1, 2, 3, 4}, 0.5); q != 2.5 {
+		t.Fatalf("median %g, want 2.5", q)
+	}
+}
+
+func TestDiffersByOne(t *testing.T) {
+	base := Cell{Algorithm: "fastcdc", Sizes: SizeTriple{2 << 10, 8 << 10, 64 << 10}, Concurrency: 1}
+	for _, tc := range []struct {
+		other Cell
+		want  string
+	}{
+		{base, ""},
+		{Cell{"ultracdc", base.Sizes, 1, false}, "algorithm"},
+		{Cell{"fastcdc", SizeTriple{4 << 10, 16 << 10, 128 << 10}, 1, false}, "sizes"},
+		{Cell{"fastcdc", base.Sizes, 4, false}, "concurrency"},
+		{Cell{"fastcdc", base.Sizes, 1, true}, "pooled"},
+		{Cell{"ultracdc", base.Sizes, 4, false}, ""},
+	} {
+		if got := base.differsByOne(tc.other); got != tc.want {
+			t.Errorf("%v against %v: %q, want %q", base, tc.other, got, tc.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	cells := []Cell{
+		{Algorithm: "fastcdc", Concurrency: 1},
+		{Algorithm: "ultracdc", Concurrency: 1},
+		{Algorithm: "ultracdc", Concurrency: 4}, // differs from the first by two factors
+	}
+	mr := &MatrixResult{Config: &MatrixConfig{Alpha: 0.05}}
+	for rep := range 5 {
+		for i := range cells {
+			r := Result{ThroughputMBs: float64((i + 1) * (100 + rep)), CPUSec: 1, PeakRSSMB: 50}
+			r.PeakRSSUnavailable = i == 1
+			if r.PeakRSSUnavailable {
+				r.PeakRSSMB = 0
+			}
+			mr.Runs = append(mr.Runs, MatrixRun{Cell: i, Rep: rep, Result: r})
+		}
+	}
+	mr.summarize(cells)
+
+	if len(mr.Cells) != 3 || mr.Cells[0].Throughput.Mean != 102 || mr.Cells[2].Throughput.Mean != 306 || len(mr.Cells[1].PeakRSS.Values) != 0 {
+		t.Fatalf("cells %+v", mr.Cells)
+	}
+	got := map[string]Comparison{}
+	for _, cmp := range mr.Comparisons {
+		got[cmp.Factor+" "+cmp.Metric] = cmp
+		if cmp.A == 0 && cmp.B == 2 {
+			t.Fatalf("compared cells differing by two factors: %+v", cmp)
+		}
+		if cmp.Metric == "peak_rss_mb" {
+			t.Fatalf("compared a peak RSS one cell did not measure: %+v", cmp)
+		}
+	}
+	if len(got) != 4 {
+		t.Fatalf("comparisons %+v", mr.Comparisons)
+	}
+	if cmp := got["algorithm throughput_mb_s"]; !cmp.Significant || !cmp.Better || cmp.Delta != 1 {
+		t.Fatalf("algorithm throughput: %+v", cmp)
+	}
+	if cmp := got["concurrency throughput_mb_s"]; !cmp.Significant || !cmp.Better || cmp.Delta != 0.5 {
+		t.Fatalf("concurrency throughput: %+v", cmp)
+	}
+	if cmp := got["algorithm cpu_sec"]; cmp.Significant || cmp.Delta != 0 {
+		t.Fatalf("algorithm cpu: %+v", cmp)
+	}
+}
@@ -86,7 +86,8 @@ func addSeries(p *plot.Plot, results []Result, labels []string, x, y accessor) e
 }
 
 // renderGraphs writes the memory-over-time, CPU-over-time, memory-over-files
-// and throughput-over-time PNGs comparing all supplied results. labels, if
+// and throughput-over-time PNGs comparing all supplied results, plus PSS,
+// cgroup memory and goroutines over time where they were sampled. labels, if
 // non-empty, names each series in the legend (one per result).
 func renderGraphs(dir string, results []Result, labels []string) error {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -97,41 +98,62 @@ func renderGraphs(dir string, results []Result, labels []string) error {
 	elapsed := func(s Sample) float64 { return s.ElapsedSec }
 	filesDone := func(s Sample) float64 { return float64(s.Files) }
 
+	// Optional graphs are skipped when no result has a sample of them: the
+	// Linux-only metrics, or series saved before they were recorded.
 	graphs := []struct {
-		file   string
-		title  string
-		xLabel string
-		yLabel string
-		x, y   accessor
+		file     string
+		title    string
+		xLabel   string
+		yLabel   string
+		x, y     accessor
+		optional bool
 	}{
 		{
 			"memory-over-time.png", "Memory usage over time",
 			"elapsed (s)", "RSS (MB)",
-			elapsed, func(s Sample) float64 { return s.RSSMB },
+			elapsed, func(s Sample) float64 { return s.RSSMB }, false,
 		},
 		{
 			"heap-over-time.png", "Live heap over time",
 			"elapsed (s)", "heap in-use (MB)",
-			elapsed, func(s Sample) float64 { return s.HeapInuseMB },
+			elapsed, func(s Sample) float64 { return s.HeapInuseMB }, false,
 		},
 		{
 			"cpu-over-time.png", "Cumulative CPU time over wall-clock time",
 			"elapsed (s)", "CPU (s)",
-			elapsed, func(s Sample) float64 { return s.CPUSec },
+			elapsed, func(s Sample) float64 { return s.CPUSec }, false,
 		},
 		{
 			"memory-over-files.png", "Memory usage as files are processed",
 			"files processed", "RSS (MB)",
-			filesDone, func(s Sample) float64 { return s.RSSMB },
+			filesDone, func(s Sample) float64 { return s.RSSMB }, false,
+		},
+		{
+			"pss-over-time.png", "Proportional set size over time",
+			"elapsed (s)", "PSS (MB)",
+			elapsed, func(s Sample) float64 { return s.PSSMB }, true,
+		},
+		{
+			"cgroup-memory-over-time.png", "cgroup memory (memory.current, page cache included) over time",
+			"elapsed (s)", "memory.current (MB)",
+			elapsed, func(s Sample) float64 { return s.CgroupMB }, true,
+		},
+		{
+			"goroutines-over-time.png", "Goroutines over time",
+			"elapsed (s)", "goroutines",
+			elapsed, func(s Sample) float64 { return float64(s.Goroutines) }, true,
 		},
 		{
 			"throughput-over-time.png", "Data processed over time",
 			"elapsed (s)", "data (MB)",
-			elapsed, func(s Sample) float64 { return float64(s.Bytes) / (1 << 20) },
+			elapsed, func(s Sample) float64 { return float64(s.Bytes) / (1 << 20) }, false,
 		},
 	}
 
 	for _, g := range graphs {
+		if g.optional && !anySample(results, g.y) {
+			continue
+		}
 		p := plot.New()
 		p.Title.Text = g.title
 		p.X.Label.Text = g.xLabel
@@ -145,3 +167,15 @@ func renderGraphs(dir string, results []Result, labels []string) error {
 	}
 	return nil
 }
+
+// anySample reports whether y is non-zero for some sample of some result.
+func anySample(results []Result, y accessor) bool {
+	for _, r := range results {
+		for _, s := range r.Samples {
+			if y(s) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// memReading is the process memory as the kernel accounts it, in bytes. A
+// zero field could not be read: /proc and cgroup v2 only exist on Linux, and
+// memory.peak needs Linux 5.19.
+type memReading struct {
+	rss         int64 // current resident set, VmRSS
+	pss         int64 // proportional set: shared pages split among their users
+	cgroup      int64 // memory.current of our cgroup, page cache included
+	cgroupPeak  int64 // memory.peak of our cgroup
+	rssFromProc bool  // rss is current; otherwise it is the getrusage peak
+}
+
+// memProbe reads memReadings. The cgroup is looked up once: a process does
+// not move between cgroups during a run.
+type memProbe struct {
+	proc      string // the /proc directory of the process
+	cgroupDir string
+}
+
+func newMemProbe() *memProbe {
+	return &memProbe{proc: "/proc/self", cgroupDir: cgroupDir("/proc/self", "/sys/fs/cgroup")}
+}
+
+// read takes one reading. Outside Linux only the getrusage high-water mark is
+// available, so rss can then only grow.
+func (mp *memProbe) read() memReading {
+	var m memReading
+	if kb, ok := procField(filepath.Join(mp.proc, "status"), "VmRSS:"); ok {
+		m.rss, m.rssFromProc = kb<<10, true
+	} else {
+		m.rss = maxRSSBytes()
+	}
+	if kb, ok := procField(filepath.Join(mp.proc, "smaps_rollup"), "Pss:"); ok {
+		m.pss = kb << 10
+	}
+	if mp.cgroupDir != "" {
+		m.cgroup = readInt(filepath.Join(mp.cgroupDir, "memory.current"))
+		m.cgroupPeak = readInt(filepath.Join(mp.cgroupDir, "memory.peak"))
+	}
+	return m
+}
+
+// resetPeak resets the kernel's RSS high-water mark (VmHWM) so that peak
+// reports the peak since now rather than since the process started. It
+// reports whether it could: Linux only.
+func (mp *memProbe) resetPeak() bool {
+	return os.WriteFile(filepath.Join(mp.proc, "clear_refs"), []byte("5"), 0) == nil
+}
+
+// peak returns VmHWM, the RSS high-water mark, in bytes.
+func (mp *memProbe) peak() int64 {
+	kb, _ := procField(filepath.Join(mp.proc, "status"), "VmHWM:")
+	return kb << 10
+}
+
+// procField returns the value, in kB, of the "Name:   1234 kB" line of a
+// /proc file.
+func procField(path, name string) (int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	return parseProcField(data, name)
+}
+
+func parseProcField(data []byte, name string) (int64, bool) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, name) {
+			continue
+		}
+		fields := strings.Fields(line[len(name):])
+		if len(fields) == 0 {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// cgroupDir returns the cgroup v2 directory, under the cgroup filesystem
+// mounted at root, of the process whose /proc directory is proc if it has
+// memory accounting, "" otherwise (cgroup v1, the root cgroup, or not Linux).
+func cgroupDir(proc, root string) string {
+	data, err := os.ReadFile(filepath.Join(proc, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		path, ok := strings.CutPrefix(line, "0::")
+		if !ok {
+			continue
+		}
+		dir := filepath.Join(root, path)
+		if _, err := os.Stat(filepath.Join(dir, "memory.current")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// readInt reads a cgroup file holding a single number, 0 if it cannot.
+func readInt(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return v
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const statusFixture = `Name:	cdcbench
+Umask:	0022
+State:	R (running)
+VmPeak:	 1285560 kB
+VmHWM:	  204800 kB
+VmRSS:	  102400 kB
+VmSwap:	       0 kB
+Threads:	12
+`
+
+func TestParseProcField(t *testing.T) {
+	for _, tc := range []struct {
+		data, name string
+		want       int64
+		ok         bool
+	}{
+		{statusFixture, "VmRSS:", 102400, true},
+		{statusFixture, "VmHWM:", 204800, true},
+		{statusFixture, "VmSwap:", 0, true},
+		{statusFixture, "VmLck:", 0, false},
+		{"Rss:   100 kB\nPss:    42 kB\nPss_Anon:  40 kB\n", "Pss:", 42, true},
+		{"Pss:\n", "Pss:", 0, false},
+		{"Pss:   lots kB\n", "Pss:", 0, false},
+		{"", "VmRSS:", 0, false},
+	} {
+		got, ok := parseProcField([]byte(tc.data), tc.name)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s in %q: got %d, %v, want %d, %v", tc.name, tc.data, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCgroupDir(t *testing.T) {
+	for _, tc := range []struct {
+		name, cgroup string
+		accounted    bool // memory.current exists
+		want         string
+	}{
+		{"v2", "0::/user.slice/bench.scope\n", true, "user.slice/bench.scope"},
+		{"hybrid", "12:memory:/bench\n1:name=systemd:/bench\n0::/bench\n", true, "bench"},
+		{"no accounting", "0::/user.slice/bench.scope\n", false, ""},
+		{"v1 only", "12:memory:/bench\n1:name=systemd:/bench\n", true, ""},
+		{"no file", "", true, ""},
+	} {
+		proc, root := t.TempDir(), t.TempDir()
+		if tc.cgroup != "" {
+			write(t, filepath.Join(proc, "cgroup"), tc.cgroup)
+		}
+		for _, dir := range []string{"user.slice/bench.scope", "bench"} {
+			if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if tc.accounted {
+				write(t, filepath.Join(root, dir, "memory.current"), "1048576\n")
+			}
+		}
+		want := ""
+		if tc.want != "" {
+			want = filepath.Join(root, tc.want)
+		}
+		if got := cgroupDir(proc, root); got != want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, want)
+		}
+	}
+}
+
+func TestMemProbe(t *testing.T) {
+	proc, cgroup := t.TempDir(), t.TempDir()
+	write(t, filepath.Join(proc, "status"), statusFixture)
+	write(t, filepath.Join(proc, "smaps_rollup"), "Rss:   102400 kB\nPss:    51200 kB\n")
+	write(t, filepath.Join(cgroup, "memory.current"), "3145728\n")
+	write(t, filepath.Join(cgroup, "memory.peak"), "4194304\n")
+
+	mp := &memProbe{proc: proc, cgroupDir: cgroup}
+	m := mp.read()
+	want := memReading{rss: 100 << 20, pss: 50 << 20, cgroup: 3 << 20, cgroupPeak: 4 << 20, rssFromProc: true}
+	if m != want {
+		t.Fatalf("read %+v, want %+v", m, want)
+	}
+	if !mp.resetPeak() {
+		t.Fatal("peak not reset")
+	}
+	if data, _ := os.ReadFile(filepath.Join(proc, "clear_refs")); string(data) != "5" {
+		t.Fatalf("wrote %q to clear_refs, want 5", data)
+	}
+	if p := mp.peak(); p != 200<<20 {
+		t.Fatalf("peak %d, want %d", p, 200<<20)
+	}
+
+	// Without /proc, as outside Linux: nothing to reset, and the RSS is
+	// the getrusage high-water mark.
+	none := &memProbe{proc: filepath.Join(proc, "missing")}
+	if none.resetPeak() {
+		t.Fatal("peak reset without /proc")
+	}
+	if m := none.read(); m.rssFromProc || m.pss != 0 || m.cgroup != 0 {
+		t.Fatalf("read %+v without /proc", m)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// printMatrix writes the comparison report of a matrix run: the mean and
+// relative stddev of every cell, then every pair of cells differing in one
+// factor. As in benchstat, a change that is not significant at the
+// configured alpha is shown as "~".
+func printMatrix(w io.Writer, mr *MatrixResult) {
+	mc := mr.Config
+	fmt.Fprintf(w, "matrix: %d cell(s) x %d run(s), %d warm-up run(s) per cell, order seed %d\n",
+		len(mr.Cells), mc.Repetitions, *mc.Warmup, mc.Seed)
+	fmt.Fprintf(w, "root:   %s\n", mc.Root)
+	if mr.Key != "" {
+		fmt.Fprintf(w, "key:    %s\n", mr.Key)
+	}
+
+	width := len("cell")
+	for _, cs := range mr.Cells {
+		width = max(width, len(cs.Cell.String()))
+	}
+	fmt.Fprintf(w, "\n%-*s  %18s  %16s  %16s\n", width, "cell", "throughput MB/s", "cpu s", "peak RSS MB")
+	for _, cs := range mr.Cells {
+		fmt.Fprintf(w, "%-*s  %18s  %16s  %16s\n", width, cs.Cell.String(),
+			metricCell(cs.Throughput, "%.1f"), metricCell(cs.CPU, "%.2f"), metricCell(cs.PeakRSS, "%.1f"))
+	}
+
+	if len(mr.Comparisons) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\ncomparisons (Mann-Whitney U, alpha=%g):\n", mc.Alpha)
+	for i := 0; i < len(mr.Comparisons); {
+		c := mr.Comparisons[i]
+		fmt.Fprintf(w, "\n%s: %s\n%*s-> %s\n", c.Factor, c.CellA, len(c.Factor)-1, "", c.CellB)
+		for ; i < len(mr.Comparisons) && mr.Comparisons[i].A == c.A && mr.Comparisons[i].B == c.B; i++ {
+			cmp := mr.Comparisons[i]
+			delta := "~"
+			verdict := ""
+			if cmp.Significant {
+				delta = fmt.Sprintf("%+.2f%%", 100*cmp.Delta)
+				verdict = "worse"
+				if cmp.Better {
+					verdict = "better"
+				}
+			}
+			line := fmt.Sprintf("  %-16s %9s  (p=%.3f n=%d+%d) %s", cmp.Metric, delta, cmp.P,
+				len(mr.Cells[cmp.A].Throughput.Values), len(mr.Cells[cmp.B].Throughput.Values), verdict)
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+	}
+	if minP := exactUPValue(0, mc.Repetitions, mc.Repetitions); minP >= mc.Alpha {
+		fmt.Fprintf(w, "\nwarning: with %d run(s) per cell no difference can reach p < %g; raise repetitions\n",
+			mc.Repetitions, mc.Alpha)
+	}
+}
+
+// metricCell formats m as its mean and relative stddev, or "n/a" when it
+// was not measured.
+func metricCell(m Metric, format string) string {
+	if len(m.Values) == 0 {
+		return "n/a"
+	}
+	s := fmt.Sprintf(format, m.Mean)
+	if m.Mean != 0 && len(m.Values) > 1 {
+		s += fmt.Sprintf(" ±%3.0f%%", 100*m.Stddev/m.Mean)
+	}
+	return s
+}
+
+// renderMatrix writes the report into dir: report.md, with the text report
+// and one bar chart per metric (mean per cell, stddev as error bars).
+func renderMatrix(dir string, mr *MatrixResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	labels := make([]string, len(mr.Cells))
+	for i, cs := range mr.Cells {
+		labels[i] = cs.Cell.String()
+	}
+
+	var md bytes.Buffer
+	fmt.Fprintf(&md, "# cdcbench matrix\n\n")
+	for _, m := range []struct {
+		file, title string
+		get         func(*CellSummary) Metric
+	}{
+		{"throughput.png", "Throughput (MB/s, higher is better)", func(cs *CellSummary) Metric { return cs.Throughput }},
+		{"cpu.png", "CPU time (s, lower is better)", func(cs *CellSummary) Metric { return cs.CPU }},
+		{"peak-rss.png", "Peak RSS (MB, lower is better)", func(cs *CellSummary) Metric { return cs.PeakRSS }},
+	} {
+		if !slices.ContainsFunc(mr.Cells, func(cs CellSummary) bool { return len(m.get(&cs).Values) > 0 }) {
+			continue // not measured in any cell
+		}
+		if err := barChart(filepath.Join(dir, m.file), m.title, labels, mr, m.get); err != nil {
+			return fmt.Errorf("%s: %w", m.file, err)
+		}
+		fmt.Fprintf(&md, "![%s](%s)\n\n", m.title, m.file)
+	}
+	fmt.Fprintf(&md, "```\n")
+	printMatrix(&md, mr)
+	fmt.Fprintf(&md, "```\n")
+	return os.WriteFile(filepath.Join(dir, "report.md"), md.Bytes(), 0o644)
+}
+
+// barChart draws one horizontal bar per cell, in config order from the top.
+func barChart(path, title string, labels []string, mr *MatrixResult, get func(*CellSummary) Metric) error {
+	n := len(mr.Cells)
+	values := make(plotter.Values, n)
+	errs := struct {
+		plotter.XYs
+		plotter.XErrors
+	}{make(plotter.XYs, n), make(plotter.XErrors, n)}
+	names := make([]string, n)
+	for i := range mr.Cells {
+		m := get(&mr.Cells[i])
+		y := n - 1 - i // first cell on top
+		values[y] = m.Mean
+		names[y] = labels[i]
+		errs.XYs[y] = plotter.XY{X: m.Mean, Y: float64(y)}
+		errs.XErrors[y] = struct{ Low, High float64 }{m.Stddev, m.Stddev}
+	}
+
+	p := plot.New()
+	p.Title.Text = title
+	bars, err := plotter.NewBarChart(values, vg.Points(14))
+	if err != nil {
+		return err
+	}
+	bars.Horizontal = true
+	bars.Color = palette[0]
+	bars.LineStyle.Width = 0
+	eb, err := plotter.NewXErrorBars(errs)
+	if err != nil {
+		return err
+	}
+	p.Add(bars, eb)
+	p.NominalY(names...)
+	p.X.Min = 0
+	return p.Save(8*vg.Inch, vg.Length(1+0.3*float64(n))*vg.Inch, path)
+}
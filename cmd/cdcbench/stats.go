@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Metric summarizes the values of one measurement over repeated runs.
+type Metric struct {
+	Mean   float64   `json:"mean"`
+	Stddev float64   `json:"stddev"` // sample standard deviation, 0 for one run
+	Values []float64 `json:"values"`
+}
+
+func newMetric(values []float64) Metric {
+	m := Metric{Values: values}
+	if len(values) == 0 {
+		return m
+	}
+	for _, v := range values {
+		m.Mean += v
+	}
+	m.Mean /= float64(len(values))
+	if len(values) > 1 {
+		var ss float64
+		for _, v := range values {
+			ss += (v - m.Mean) * (v - m.Mean)
+		}
+		m.Stddev = math.Sqrt(ss / float64(len(values)-1))
+	}
+	return m
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test that
+// a and b come from the same distribution. Like benchstat, it assumes
+// nothing about the shape of the distributions: benchmark timings are rarely
+// normal. The p-value is exact for small samples without ties, and from the
+// normal approximation, corrected for ties, otherwise.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// Rank the pooled samples, ties getting their average rank.
+	type obs struct {
+		v     float64
+		first bool
+	}
+	pooled := make([]obs, 0, n1+n2)
+	for _, v := range a {
+		pooled = append(pooled, obs{v, true})
+	}
+	for _, v := range b {
+		pooled = append(pooled, obs{v, false})
+	}
+	sort.Slice(pooled, func(i, j int) bool { return pooled[i].v < pooled[j].v })
+	var r1, tieTerm float64
+	ties := false
+	for i := 0; i < len(pooled); {
+		j := i
+		for j < len(pooled) && pooled[j].v == pooled[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks i+1..j
+		for k := i; k < j; k++ {
+			if pooled[k].first {
+				r1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := r1 - float64(n1*(n1+1))/2
+
+	if !ties && n1 <= 20 && n2 <= 20 {
+		return exactUPValue(int(u), n1, n2)
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	return math.Min(1, math.Erfc(math.Max(z, 0)/math.Sqrt2))
+}
+
+// exactUPValue is the two-sided p-value of U = u for samples of n1 and n2
+// values, from the exact distribution of U under the null hypothesis: the
+// number of orderings giving each U, by the recurrence
+// f(u; m, n) = f(u-n; m-1, n) + f(u; m, n-1).
+func exactUPValue(u, n1, n2 int) float64 {
+	// f[j] holds the counts for (i, j) while row i is built.
+	f := make([][]float64, n2+1)
+	for j := range f {
+		f[j] = []float64{1} // i = 0: a single ordering, U = 0
+	}
+	for i := 1; i <= n1; i++ {
+		prev := f
+		f = make([][]float64, n2+1)
+		f[0] = []float64{1}
+		for j := 1; j <= n2; j++ {
+			row := make([]float64, i*j+1)
+			for v := range row {
+				if v-j >= 0 && v-j < len(prev[j]) {
+					row[v] += prev[j][v-j]
+				}
+				if v < len(f[j-1]) {
+					row[v] += f[j-1][v]
+				}
+			}
+			f[j] = row
+		}
+	}
+	dist := f[n2]
+	var total, below, above float64
+	for v, c := range dist {
+		total += c
+		if v <= u {
+			below += c
+		}
+		if v >= u {
+			above += c
+		}
+	}
+	return math.Min(1, 2*math.Min(below, above)/total)
+}
+
+// withoutOutliers drops the values outside Tukey's fences, more than 1.5
+// interquartile ranges beyond the quartiles, as benchstat does before
+// summarizing. Fewer than four values are returned as is.
+func withoutOutliers(values []float64) []float64 {
+	if len(values) < 4 {
+		return values
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	lo, hi := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	var out []float64
+	for _, v := range values {
+		if v >= lo && v <= hi {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// quantile interpolates the q-quantile of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
@@ -34,7 +34,6 @@ import (
 	"fmt"
 	"image/color"
 	"io"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
@@ -45,6 +44,8 @@ import (
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
@@ -57,16 +58,32 @@ func main() {
 	minSize := flag.Int("min", 2*1024, "minimum chunk size in bytes")
 	avgSize := flag.Int("avg", 8*1024, "average/normal chunk size in bytes")
 	maxSize := flag.Int("max", 64*1024, "maximum chunk size in bytes")
-	editSize := flag.Int("edit-size", 1, "resync: bytes per insertion")
+	editSize := flag.Int("edit-size", 1, "resync: bytes per edit")
+	model := flag.String("edit-model", "insert", "resync: edit mixture, e.g. insert:3,delete,overwrite,move,append,prepend")
+	cluster := flag.Int64("cluster", 0, "resync: keep edits within this many bytes of the first, 0 to spread them")
+	trials := flag.Int("trials", 5, "resync: trials per point, for the 95% confidence interval")
+	var key []byte
+	keyflag.Register(flag.CommandLine, &key)
 	flag.Parse()
 
+	m, err := edits.ParseModel(*model)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cdcplot: %v\n", err)
+		os.Exit(1)
+	}
+	m.Size, m.Cluster = *editSize, *cluster
+	if *trials < 1 {
+		fmt.Fprintf(os.Stderr, "cdcplot: -trials must be at least 1\n")
+		os.Exit(1)
+	}
+
 	files, err := readFiles(flag.Args())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "cdcplot: %v\n", err)
 		os.Exit(1)
 	}
 	algos := splitList(*list)
-	o := &chunkers.ChunkerOpts{MinSize: *minSize, NormalSize: *avgSize, MaxSize: *maxSize}
+	o := &chunkers.ChunkerOpts{MinSize: *minSize, NormalSize: *avgSize, MaxSize: *maxSize, Key: key}
 
 	kinds := []string{*kind}
 	if *kind == "all" {
@@ -83,7 +100,7 @@ func main() {
 			os.Exit(1)
 		}
 		for _, k := range kinds {
-			if err := plotOne(k, algo, files, o, *editSize, dir); err != nil {
+			if err := plotOne(k, algo, files, o, m, *trials, dir); err != nil {
 				fmt.Fprintf(os.Stderr, "cdcplot: %s: %v\n", algo, err)
 				os.Exit(1)
 			}
@@ -91,14 +108,14 @@ func main() {
 	}
 }
 
-func plotOne(kind, algo string, files [][]byte, o *chunkers.ChunkerOpts, editSize int, dir string) error {
+func plotOne(kind, algo string, files [][]byte, o *chunkers.ChunkerOpts, m *edits.Model, trials int, dir string) error {
 	switch kind {
 	case "distribution":
 		return plotDistribution(algo, files, o, dir)
 	case "resync":
-		return plotResync(algo, files[0], o, editSize, dir)
+		return plotResync(algo, files[0], o, m, trials, dir)
 	case "dedup-sweep":
-		return plotDedupSweep(algo, files, dir)
+		return plotDedupSweep(algo, files, o.Key, dir)
 	case "count":
 		return plotCount(algo, files, o, dir)
 	default:
@@ -106,6 +123,15 @@ func plotOne(kind, algo string, files [][]byte, o *chunkers.ChunkerOpts, editSiz
 	}
 }
 
+// label names algo in chart titles, with the fingerprint of its key if any:
+// the key itself never appears.
+func label(algo string, key []byte) string {
+	if key == nil {
+		return algo
+	}
+	return algo + " (key " + keyflag.Fingerprint(key) + ")"
+}
+
 // sanitize makes an algorithm name safe as a directory component.
 func sanitize(s string) string {
 	return strings.NewReplacer("/", "_", " ", "_").Replace(s)
@@ -221,21 +247,6 @@ func digests(algo string, data []byte, o *chunkers.ChunkerOpts) (map[[32]byte]in
 	return set, total, nil
 }
 
-func applyInsertions(data []byte, n, editSize int) []byte {
-	r := rand.New(rand.NewSource(1))
-	out := append([]byte(nil), data...)
-	for i := 0; i < n; i++ {
-		pos := 0
-		if len(out) > 0 {
-			pos = r.Intn(len(out))
-		}
-		ins := make([]byte, editSize)
-		r.Read(ins)
-		out = append(out[:pos], append(ins, out[pos:]...)...)
-	}
-	return out
-}
-
 /************ plotting ************/
 
 func palette(i int) color.Color {
@@ -266,7 +277,7 @@ func plotDistribution(algo string, files [][]byte, o *chunkers.ChunkerOpts, dir
 	}
 	p := plot.New()
 	p.Title.Text = fmt.Sprintf("%s — chunk-size distribution (min=%d avg=%d max=%d)",
-		algo, o.MinSize, o.NormalSize, o.MaxSize)
+		label(algo, o.Key), o.MinSize, o.NormalSize, o.MaxSize)
 	p.X.Label.Text = "chunk size (bytes)"
 	p.Y.Label.Text = "count"
 
@@ -284,42 +295,62 @@ func plotDistribution(algo string, files [][]byte, o *chunkers.ChunkerOpts, dir
 	return save(p, dir, "chunk-distribution.png")
 }
 
-func plotResync(algo string, orig []byte, o *chunkers.ChunkerOpts, editSize int, dir string) error {
+// plotResync plots the shared fraction after an increasing number of edits
+// drawn from m, averaged over trials with a 95% confidence interval.
+func plotResync(algo string, orig []byte, o *chunkers.ChunkerOpts, m *edits.Model, trials int, dir string) error {
 	p := plot.New()
-	p.Title.Text = fmt.Sprintf("%s — resync quality vs edits (%d-byte insertions)", algo, editSize)
-	p.X.Label.Text = "number of insertions"
+	p.Title.Text = fmt.Sprintf("%s — resync quality vs edits (%d-byte %s, %d trials)", label(algo, o.Key), m.Size, m, trials)
+	p.X.Label.Text = "number of edits"
 	p.Y.Label.Text = "shared chunks (% of edited file)"
 
 	steps := []int{0, 1, 2, 4, 8, 16, 32, 64}
-	pts := plotter.XYs{}
+	var pts errPoints
 	for _, e := range steps {
-		edited := applyInsertions(orig, e, editSize)
-		shared, err := resyncShared(algo, orig, edited, o)
-		if err != nil {
-			return err
+		shared := make([]float64, trials)
+		for i := range shared {
+			plan, err := m.Plan(int64(len(orig)), e, int64(1+i))
+			if err != nil {
+				return err
+			}
+			if shared[i], err = resyncShared(algo, orig, plan.Apply(orig), o); err != nil {
+				return err
+			}
+			shared[i] *= 100
 		}
-		pts = append(pts, plotter.XY{X: float64(e), Y: 100 * shared})
+		mean, half := edits.MeanCI95(shared)
+		pts.XYs = append(pts.XYs, plotter.XY{X: float64(e), Y: mean})
+		pts.YErrors = append(pts.YErrors, struct{ Low, High float64 }{half, half})
 	}
-	line, points, err := plotter.NewLinePoints(pts)
+	line, points, err := plotter.NewLinePoints(pts.XYs)
 	if err != nil {
 		return err
 	}
 	line.Color = palette(0)
 	points.Color = palette(0)
-	p.Add(line, points)
+	bars, err := plotter.NewYErrorBars(pts)
+	if err != nil {
+		return err
+	}
+	bars.Color = palette(0)
+	p.Add(line, points, bars)
 	return save(p, dir, "resync-impact.png")
 }
 
-func plotDedupSweep(algo string, files [][]byte, dir string) error {
+type errPoints struct {
+	plotter.XYs
+	plotter.YErrors
+}
+
+func plotDedupSweep(algo string, files [][]byte, key []byte, dir string) error {
 	p := plot.New()
-	p.Title.Text = fmt.Sprintf("%s — dedup ratio vs avg chunk size", algo)
+	p.Title.Text = fmt.Sprintf("%s — dedup ratio vs avg chunk size", label(algo, key))
 	p.X.Label.Text = "avg size (bytes)"
 	p.Y.Label.Text = "dedup ratio (lower = better)"
 
 	avgs := []int{4096, 8192, 16384, 32768, 65536}
 	pts := plotter.XYs{}
 	for _, avg := range avgs {
-		o := &chunkers.ChunkerOpts{MinSize: avg / 4, NormalSize: avg, MaxSize: avg * 8}
+		o := &chunkers.ChunkerOpts{MinSize: avg / 4, NormalSize: avg, MaxSize: avg * 8, Key: key}
 		_, ratio, err := chunkLengths(algo, files, o)
 		if err != nil {
 			return err
@@ -352,7 +383,7 @@ func plotCount(algo string, files [][]byte, o *chunkers.ChunkerOpts, dir string)
 		pts[i] = plotter.XY{X: float64(l), Y: 100 * float64(i+1) / float64(len(sorted))}
 	}
 	p := plot.New()
-	p.Title.Text = fmt.Sprintf("%s — chunk-size CDF (%d chunks)", algo, len(sorted))
+	p.Title.Text = fmt.Sprintf("%s — chunk-size CDF (%d chunks)", label(algo, o.Key), len(sorted))
 	p.X.Label.Text = "chunk size (bytes)"
 	p.Y.Label.Text = "cumulative %"
 	line, err := plotter.NewLine(pts)
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -12,61 +11,78 @@ import (
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
-	"github.com/PlakarKorp/go-cdc-chunkers/internal/testutil"
-	_ "github.com/PlakarKorp/go-cdc-chunkers/internal/testutil" // Import for side effects, to register test data
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
 )
 
 func main() {
 	var minSize, maxSize, avgSize int
 	var chunker string
-	var profile string
+	var profilePath string
+	var binary bool
 
 	flag.IntVar(&minSize, "min", 4*1024, "Minimum chunk size in bytes")
 	flag.IntVar(&avgSize, "avg", 16*1024, "Average chunk size in bytes")
 	flag.IntVar(&maxSize, "max", 64*1024, "Maximum chunk size in bytes")
 	flag.StringVar(&chunker, "chunker", "fastcdc", "Chunking algorithm to use (e.g., fastcdc, fastcdc4stadia, jc, ultracdc)")
-	flag.StringVar(&profile, "profile", "", "Path to an existing profile file (optional)")
+	flag.StringVar(&profilePath, "profile", "", "Path to an existing profile file (optional)")
+	flag.BoolVar(&binary, "binary", false, "Write the profile in the compact binary encoding")
+	var key []byte
+	keyflag.Register(flag.CommandLine, &key)
 	flag.Parse()
 
 	chunkerOpts := &chunkers.ChunkerOpts{
 		MinSize:    minSize,
 		MaxSize:    maxSize,
 		NormalSize: avgSize,
+		Key:        key,
 	}
 
-	if profile == "" {
-		if profile, err := testutil.GenerateProfile(os.Stdin, chunker, chunkerOpts); err != nil {
-			log.Fatalf("error generating chunks for %s: %v", chunker, err)
-		} else {
-			json.NewEncoder(os.Stdout).Encode(profile)
+	gen, err := profile.NewGenerator(os.Stdin, chunker, chunkerOpts)
+	if err != nil {
+		log.Fatalf("error generating chunks for %s: %v", chunker, err)
+	}
+
+	if profilePath == "" {
+		format := profile.JSON
+		if binary {
+			format = profile.Binary
 		}
-	} else {
-		file, err := os.Open(profile)
-		if err != nil {
-			log.Fatalf("error opening profile file %s: %v", profile, err)
+		if _, err := profile.Encode(os.Stdout, format, gen); err != nil {
+			log.Fatalf("error generating chunks for %s: %v", chunker, err)
 		}
-		defer file.Close()
+		return
+	}
 
-		var cdcProfile testutil.CDCProfile
-		if err := json.NewDecoder(file).Decode(&cdcProfile); err != nil {
-			log.Fatalf("error decoding profile file %s: %v", profile, err)
-		}
+	file, err := os.Open(profilePath)
+	if err != nil {
+		log.Fatalf("error opening profile file %s: %v", profilePath, err)
+	}
+	defer file.Close()
 
-		newProfile, err := testutil.MatchProfile(os.Stdin, chunker, chunkerOpts, &cdcProfile)
-		if err != nil {
-			log.Fatalf("error comparing profile: %v", err)
-		} else {
-			delta := newProfile.Duration - cdcProfile.Duration
+	want, err := profile.NewReader(file)
+	if err != nil {
+		log.Fatalf("error decoding profile file %s: %v", profilePath, err)
+	}
 
-			var comparison string
-			if delta > 0 {
-				comparison = "slower"
-			} else {
-				delta = -delta
-				comparison = "faster"
-			}
-			fmt.Printf("generated chunks matched profile %s %s\n", delta, comparison)
-		}
+	n, err := profile.Diff(want, gen, func(m profile.Mismatch) error {
+		fmt.Println(m)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("error comparing profile: %v", err)
+	}
+	if n != 0 {
+		log.Fatalf("generated chunks do not match profile %s: %d mismatch(es)", profilePath, n)
 	}
 
+	delta := gen.Trailer().Duration - want.Trailer().Duration
+	var comparison string
+	if delta > 0 {
+		comparison = "slower"
+	} else {
+		delta = -delta
+		comparison = "faster"
+	}
+	fmt.Printf("generated chunks matched profile %s %s\n", delta, comparison)
 }
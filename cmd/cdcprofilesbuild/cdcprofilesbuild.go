@@ -1,172 +1,449 @@
+// Command cdcprofilesbuild builds a corpus of boundary profiles: one profile
+// per input file, registered algorithm and size triple, written in parallel
+// under -dir with an index.json listing them. A profile whose input has not
+// changed since it was written is kept as is, so regenerating the corpus
+// after adding an input or an algorithm only profiles what is new.
+//
+//	cdcprofilesbuild -dir profiles/ [-config sizes.json] [-chunker NAME,...] FILE...
 package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fixed"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
-	"github.com/PlakarKorp/go-cdc-chunkers/internal/testutil"
-	_ "github.com/PlakarKorp/go-cdc-chunkers/internal/testutil" // Import for side effects, to register test data
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
 )
 
-func main() {
-	var outputDir string
-	var chunker string
-	flag.StringVar(&outputDir, "dir", ".", "Directory to save the generated profiles")
-	flag.StringVar(&chunker, "chunker", "fastcdc", "Chunking algorithm to use (e.g., fastcdc, fastcdc4stadia, jc, ultracdc)")
-	flag.Parse()
+type SizeTriple struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
 
-	chunkersOpts := []chunkers.ChunkerOpts{
-		{
-			MinSize:    2 * 1024,
-			NormalSize: 8 * 1024,
-			MaxSize:    32 * 1024,
-		},
-		{
-			MinSize:    4 * 1024,
-			NormalSize: 16 * 1024,
-			MaxSize:    64 * 1024,
-		},
-		{
-			MinSize:    8 * 1024,
-			NormalSize: 32 * 1024,
-			MaxSize:    128 * 1024,
-		},
-		{
-			MinSize:    12 * 1024,
-			NormalSize: 48 * 1024,
-			MaxSize:    192 * 1024,
-		},
-		{
-			MinSize:    16 * 1024,
-			NormalSize: 64 * 1024,
-			MaxSize:    256 * 1024,
-		},
-	}
-	_ = chunkersOpts // Prevent unused variable warning
-
-	chunkers := []string{
-		"fastcdc",
-		"fastcdc4stadia",
-		"fastcdc-v1.0.0",
-		"jc",
-		"jc-v1.0.0",
-		"ultracdc",
-	}
-
-	if chunker != "" {
-		chunkers = []string{chunker}
+func (st SizeTriple) String() string {
+	return fmt.Sprintf("%s-%s-%s", sizeLabel(st.Min), sizeLabel(st.Avg), sizeLabel(st.Max))
+}
+
+func sizeLabel(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dK", n>>10)
 	}
+	return fmt.Sprint(n)
+}
+
+// Config selects what is profiled. Every field is optional.
+type Config struct {
+	// Algorithms defaults to every registered algorithm.
+	Algorithms []string `json:"algorithms,omitempty"`
+	// Sizes defaults to five triples from 2K/8K/32K to 16K/64K/256K.
+	Sizes []SizeTriple `json:"sizes,omitempty"`
+	// Override gives an algorithm its own triples in place of Sizes, for
+	// algorithms that only accept some shapes: fixed-v1.0.0 needs
+	// min = avg = max, a power of two.
+	Override map[string][]SizeTriple `json:"override,omitempty"`
+}
+
+var defaultConfig = Config{
+	Sizes: []SizeTriple{
+		{2 << 10, 8 << 10, 32 << 10},
+		{4 << 10, 16 << 10, 64 << 10},
+		{8 << 10, 32 << 10, 128 << 10},
+		{12 << 10, 48 << 10, 192 << 10},
+		{16 << 10, 64 << 10, 256 << 10},
+	},
+	Override: map[string][]SizeTriple{
+		"fixed-v1.0.0": {{8 << 10, 8 << 10, 8 << 10}, {16 << 10, 16 << 10, 16 << 10},
+			{32 << 10, 32 << 10, 32 << 10}, {64 << 10, 64 << 10, 64 << 10}},
+	},
+}
+
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg = Config{}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(cfg.Sizes) == 0 {
+			cfg.Sizes = defaultConfig.Sizes
+		}
+		if cfg.Override == nil {
+			cfg.Override = defaultConfig.Override
+		}
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = chunkers.Algorithms()
+	}
+	return &cfg, nil
+}
+
+// indexVersion versions index.json.
+const indexVersion = 1
+
+// Index lists the profiles of the corpus, sorted by path, and the
+// combinations that could not be profiled.
+type Index struct {
+	Version  int          `json:"cdc_profile_index"`
+	Profiles []IndexEntry `json:"profiles"`
+	Skipped  []Skipped    `json:"skipped,omitempty"`
+}
+
+type IndexEntry struct {
+	Path        string     `json:"path"` // relative to the index
+	Input       string     `json:"input"`
+	InputSHA256 string     `json:"input_sha256"`
+	InputSize   int64      `json:"input_size"`
+	Algorithm   string     `json:"algorithm"`
+	Sizes       SizeTriple `json:"sizes"`
+	Key         string     `json:"key_fingerprint,omitempty"`
+	Chunks      int64      `json:"chunks"`
+}
+
+type Skipped struct {
+	Algorithm string     `json:"algorithm"`
+	Sizes     SizeTriple `json:"sizes"`
+	Reason    string     `json:"reason"`
+}
+
+// input is a file to profile, hashed once for every job on it.
+type input struct {
+	path   string
+	name   string
+	digest [sha256.Size]byte
+	size   int64
+}
+
+// job is one profile to build or keep.
+type job struct {
+	in    *input
+	algo  string
+	sizes SizeTriple
+	opts  *chunkers.ChunkerOpts
+	path  string // relative to -dir
+}
+
+func main() {
+	var outputDir, configPath, only, format string
+	var jobs int
+	var force bool
+	flag.StringVar(&outputDir, "dir", ".", "Directory to save the generated profiles and index.json")
+	flag.StringVar(&configPath, "config", "", "JSON config of algorithms, size triples and overrides (optional)")
+	flag.StringVar(&only, "chunker", "", "Comma-separated algorithms to profile instead of the config's")
+	flag.StringVar(&format, "format", "json", "Profile encoding: json or binary")
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), "Profiles built in parallel")
+	flag.BoolVar(&force, "force", false, "Rebuild profiles even when up to date")
+	var key []byte
+	keyflag.Register(flag.CommandLine, &key)
+	flag.Parse()
 
 	if flag.NArg() == 0 {
 		log.Fatal("need file(s) to compute profile from")
 	}
+	if jobs < 1 {
+		log.Fatal("-j must be at least 1")
+	}
+	enc, ext := profile.JSON, ".json"
+	switch format {
+	case "json":
+	case "binary":
+		enc, ext = profile.Binary, ".cdcp"
+	default:
+		log.Fatalf("unknown -format %q", format)
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if only != "" {
+		cfg.Algorithms = strings.Split(only, ",")
+	}
 
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Fatalf("error creating output directory %s: %v", outputDir, err)
+	inputs, err := hashInputs(flag.Args(), jobs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	todo, skipped, err := plan(cfg, inputs, key, ext)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s %s: %s\n", s.Algorithm, s.Sizes, s.Reason)
 	}
 
-	for _, file := range flag.Args() {
-		data, err := os.ReadFile(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading file %s: %v, skipping...\n", file, err)
+	entries := make([]IndexEntry, len(todo))
+	errs := make([]error, len(todo))
+	built := make([]bool, len(todo))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(jobs, len(todo)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				j := todo[i]
+				entries[i], built[i], errs[i] = build(outputDir, j, enc, force)
+				switch {
+				case errs[i] != nil:
+					fmt.Fprintf(os.Stderr, "error %s: %v\n", j.path, errs[i])
+				case built[i]:
+					fmt.Fprintf(os.Stderr, "built %s: %d chunks\n", j.path, entries[i].Chunks)
+				}
+			}
+		}()
+	}
+	for i := range todo {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	index := Index{Version: indexVersion, Skipped: skipped}
+	nbuilt, failed := 0, 0
+	for i, e := range entries {
+		if errs[i] != nil {
+			failed++
 			continue
 		}
-		_ = data
+		if built[i] {
+			nbuilt++
+		}
+		index.Profiles = append(index.Profiles, e)
+	}
+	sort.Slice(index.Profiles, func(a, b int) bool { return index.Profiles[a].Path < index.Profiles[b].Path })
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(outputDir, "index.json"), func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	}); err != nil {
+		log.Fatal(err)
+	}
 
-		for _, chunker := range chunkers {
-			for _, chunkerOpts := range chunkersOpts {
-				minStr := fmt.Sprintf("%dK", chunkerOpts.MinSize/1024)
-				avgStr := fmt.Sprintf("%dK", chunkerOpts.NormalSize/1024)
-				maxStr := fmt.Sprintf("%dK", chunkerOpts.MaxSize/1024)
+	fmt.Printf("%d profile(s): %d built, %d up to date, %d failed; %d combination(s) skipped\n",
+		len(index.Profiles)+failed, nbuilt, len(index.Profiles)-nbuilt, failed, len(skipped))
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
 
-				profileName := fmt.Sprintf("%s_%s-%s-%s:%s.json",
-					chunker, minStr, avgStr, maxStr, filepath.Base(file))
+// hashInputs hashes the inputs, jobs at a time. Profiles are stored under
+// the base name of their input, so two inputs may not share one.
+func hashInputs(paths []string, jobs int) ([]*input, error) {
+	inputs := make([]*input, len(paths))
+	names := make(map[string]string)
+	for i, p := range paths {
+		name := filepath.Base(p)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s and %s have the same base name", other, p)
+		}
+		names[name] = p
+		inputs[i] = &input{path: p, name: name}
+	}
 
-				fp, err := os.Create(filepath.Join(outputDir, profileName))
+	errs := make([]error, len(inputs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(jobs, len(inputs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				in := inputs[i]
+				f, err := os.Open(in.path)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "error creating profile file %s: %v, skipping...\n", profileName, err)
+					errs[i] = err
 					continue
 				}
-				if profile, err := testutil.GenerateProfile(bytes.NewReader(data), chunker, &chunkerOpts); err != nil {
-					fmt.Fprintf(os.Stderr, "error generating chunks for %s: %v, skipping...", chunker, err)
-				} else {
-					json.NewEncoder(fp).Encode(profile)
-				}
-				fp.Close()
+				h := sha256.New()
+				in.size, errs[i] = io.Copy(h, f)
+				f.Close()
+				copy(in.digest[:], h.Sum(nil))
 			}
-		}
+		}()
 	}
+	for i := range inputs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return inputs, errors.Join(errs...)
+}
 
-	//	for _, chunker := range chunkers {
-	//		for _, chunkerOpts := range chunkersOpts {
-	//			fmt.Printf("Generating profile for %s with options: %+v\n", chunker, chunkerOpts)
-	//		}
-	//	}
-	/*
-
-		if profile, err := testutil.GenerateProfile(os.Stdin, chunker, chunkerOpts); err != nil {
-			log.Fatalf("error generating chunks for %s: %v", chunker, err)
-		} else {
-			json.NewEncoder(os.Stdout).Encode(profile)
+// plan lists a job for every input, algorithm and triple the algorithm
+// accepts. A keyed algorithm, one that only validates with a key, gets the
+// key given on the command line, and is skipped without one.
+func plan(cfg *Config, inputs []*input, key []byte, ext string) ([]job, []Skipped, error) {
+	registered := make(map[string]bool)
+	for _, name := range chunkers.Algorithms() {
+		registered[name] = true
+	}
+	var todo []job
+	var skipped []Skipped
+	for _, algo := range cfg.Algorithms {
+		if !registered[algo] {
+			return nil, nil, fmt.Errorf("unknown algorithm %q", algo)
 		}
-	*/
-
+		sizes := cfg.Sizes
+		if override, ok := cfg.Override[algo]; ok {
+			sizes = override
+		}
+		for _, st := range sizes {
+			opts, err := setup(algo, st, key)
+			if err != nil {
+				skipped = append(skipped, Skipped{Algorithm: algo, Sizes: st, Reason: err.Error()})
+				continue
+			}
+			for _, in := range inputs {
+				todo = append(todo, job{in: in, algo: algo, sizes: st, opts: opts,
+					path: filepath.Join(in.name, fmt.Sprintf("%s_%s%s", algo, st, ext))})
+			}
+		}
+	}
+	return todo, skipped, nil
 }
 
-/*
-func main() {
-	var minSize, maxSize, avgSize int
-	var chunker string
-	var profile string
-
-	flag.IntVar(&minSize, "min", 4*1024, "Minimum chunk size in bytes")
-	flag.IntVar(&avgSize, "avg", 16*1024, "Average chunk size in bytes")
-	flag.IntVar(&maxSize, "max", 64*1024, "Maximum chunk size in bytes")
-	flag.StringVar(&chunker, "chunker", "fastcdc", "Chunking algorithm to use (e.g., fastcdc, fastcdc4stadia, jc, ultracdc)")
-	flag.StringVar(&profile, "profile", "", "Path to an existing profile file (optional)")
-	flag.Parse()
-
-	chunkerOpts := &chunkers.ChunkerOpts{
-		MinSize:    minSize,
-		MaxSize:    maxSize,
-		NormalSize: avgSize,
+func setup(algo string, st SizeTriple, key []byte) (*chunkers.ChunkerOpts, error) {
+	// A keyed algorithm is told apart by the key it validates with, which
+	// need not be the one to build with.
+	probe := key
+	if probe == nil {
+		probe = make([]byte, keyflag.Size)
+	}
+	opts, err := keyflag.Resolve(algo, &chunkers.ChunkerOpts{MinSize: st.Min, NormalSize: st.Avg, MaxSize: st.Max}, probe)
+	if err != nil {
+		return nil, err
 	}
+	if opts.Key != nil && key == nil {
+		return nil, fmt.Errorf("keyed: needs -key-file, -key-env or -key-hex")
+	}
+	// The algorithm's setup runs too, as its validation alone may let
+	// through options it fails to set up with.
+	if _, err := chunkers.NewChunker(algo, bytes.NewReader(nil), opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
 
-	if profile == "" {
-		if profile, err := testutil.GenerateProfile(os.Stdin, chunker, chunkerOpts); err != nil {
-			log.Fatalf("error generating chunks for %s: %v", chunker, err)
-		} else {
-			json.NewEncoder(os.Stdout).Encode(profile)
-		}
-	} else {
-		file, err := os.Open(profile)
-		if err != nil {
-			log.Fatalf("error opening profile file %s: %v", profile, err)
+// build writes the profile of j unless the one on disk is up to date: same
+// header, and a trailer recording the size and SHA-256 the input has now.
+// It reports whether it wrote the profile.
+func build(dir string, j job, enc profile.Format, force bool) (IndexEntry, bool, error) {
+	e := IndexEntry{
+		Path:        filepath.ToSlash(j.path),
+		Input:       j.in.name,
+		InputSHA256: hex.EncodeToString(j.in.digest[:]),
+		InputSize:   j.in.size,
+		Algorithm:   j.algo,
+		Sizes:       j.sizes,
+		Key:         keyflag.Fingerprint(j.opts.Key),
+	}
+	path := filepath.Join(dir, j.path)
+	if !force {
+		if tr, ok := upToDate(path, j, enc); ok {
+			e.Chunks = tr.Chunks
+			return e, false, nil
 		}
-		defer file.Close()
+	}
 
-		var cdcProfile testutil.CDCProfile
-		if err := json.NewDecoder(file).Decode(&cdcProfile); err != nil {
-			log.Fatalf("error decoding profile file %s: %v", profile, err)
-		}
+	f, err := os.Open(j.in.path)
+	if err != nil {
+		return e, false, err
+	}
+	defer f.Close()
+	opts := *j.opts
+	gen, err := profile.NewGenerator(f, j.algo, &opts)
+	if err != nil {
+		return e, false, err
+	}
+	var tr profile.Trailer
+	err = writeFile(path, func(w io.Writer) error {
+		var err error
+		tr, err = profile.Encode(w, enc, gen)
+		return err
+	})
+	if err != nil {
+		return e, false, err
+	}
+	if tr.Digest != j.in.digest {
+		return e, false, fmt.Errorf("%s changed while it was profiled", j.in.path)
+	}
+	e.Chunks = tr.Chunks
+	return e, true, nil
+}
 
-		err = testutil.CompareProfile(os.Stdin, chunker, chunkerOpts, &cdcProfile)
-		if err != nil {
-			log.Fatalf("error comparing profile: %v", err)
-		} else {
-			fmt.Printf("Profile %s matches the generated chunks\n", profile)
+func upToDate(path string, j job, enc profile.Format) (profile.Trailer, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return profile.Trailer{}, false
+	}
+	defer f.Close()
+	pr, err := profile.NewReader(f)
+	if err != nil || pr.Format() != enc {
+		return profile.Trailer{}, false
+	}
+	h := pr.Header()
+	if h.Algorithm != j.algo || h.MinSize != j.sizes.Min || h.NormalSize != j.sizes.Avg || h.MaxSize != j.sizes.Max ||
+		h.Key != keyflag.Fingerprint(j.opts.Key) {
+		return profile.Trailer{}, false
+	}
+	for {
+		if _, err := pr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return profile.Trailer{}, false
 		}
 	}
+	tr := pr.Trailer()
+	return tr, tr.Size == j.in.size && tr.Digest == j.in.digest
+}
 
+// writeFile writes path through fn into a temporary file renamed into
+// place, so that an interrupted run never leaves a truncated profile.
+func writeFile(path string, fn func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".profile-*")
+	if err != nil {
+		return err
+	}
+	if err := fn(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
-*/
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package conformance checks that a registered ChunkerImplementation keeps
+// the contract the Chunker relies on. Plugin authors run it from a test of
+// their own:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, "my-chunker")
+//	}
+//
+// The built-in algorithms pass it.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/chunkerstest"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// Key is the key keyed algorithms are checked with.
+var Key = bytes.Repeat([]byte{0xa5}, 32)
+
+// Run checks the named algorithm with its default options, then with each
+// of opts, zero sizes taking their defaults. An algorithm that refuses
+// options without a key is given Key. For every option set it checks that
+// Algorithm:
+//
+//   - returns a cut point in (0, n] for n > 0, and n itself when n is at
+//     most MinSize, so that no chunk but the last is shorter than MinSize;
+//   - never cuts past MaxSize;
+//   - never panics for n <= len(data);
+//   - is deterministic, across calls and across instances;
+//   - does not depend on the data past n;
+//
+// that Setup is idempotent, a second call leaving the cut points as they
+// were; and then it holds Chunkers of the algorithm to the contract
+// chunkerstest.Check describes.
+func Run(t *testing.T, name string, opts ...*chunkers.ChunkerOpts) {
+	t.Helper()
+	if _, err := chunkers.NewImplementation(name); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	alloc := func() chunkers.ChunkerImplementation {
+		impl, _ := chunkers.NewImplementation(name)
+		return impl
+	}
+	sets := append([]*chunkers.ChunkerOpts{nil}, opts...)
+	for i, o := range sets {
+		o, err := options(name, o)
+		if err != nil {
+			t.Errorf("%s: option set %d: %v", name, i, err)
+			continue
+		}
+		t.Run(fmt.Sprintf("%d-%d-%d", o.MinSize, o.NormalSize, o.MaxSize), func(t *testing.T) {
+			t.Run("Algorithm", func(t *testing.T) { checkAlgorithm(t, alloc, o) })
+			t.Run("Setup", func(t *testing.T) { checkSetup(t, alloc, o) })
+			t.Run("Chunker", func(t *testing.T) { checkChunker(t, name, o) })
+		})
+	}
+}
+
+// options resolves o with Key, as keyflag.Resolve does, and checks
+// the sizes the algorithm validated.
+func options(name string, o *chunkers.ChunkerOpts) (*chunkers.ChunkerOpts, error) {
+	filled, err := keyflag.Resolve(name, o, Key)
+	if err != nil {
+		return nil, err
+	}
+	if filled.MinSize <= 0 || filled.MinSize > filled.MaxSize {
+		return nil, fmt.Errorf("MinSize %d and MaxSize %d validated", filled.MinSize, filled.MaxSize)
+	}
+	return filled, nil
+}
+
+// implementation returns an instance from alloc set up with a copy of o,
+// and the copy. The checks of Algorithm and Setup take the allocator rather
+// than a registered name, so they can be tested on broken implementations
+// kept out of the registry.
+func implementation(t testing.TB, alloc func() chunkers.ChunkerImplementation, o *chunkers.ChunkerOpts) (chunkers.ChunkerImplementation, *chunkers.ChunkerOpts) {
+	t.Helper()
+	impl := alloc()
+	c := *o
+	if err := impl.Setup(&c); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	return impl, &c
+}
+
+// inputs are the windows Algorithm is given: random bytes, text, and runs
+// of a single byte, each MaxSize plus a tail.
+func inputs(o *chunkers.ChunkerOpts) map[string][]byte {
+	size := int64(o.MaxSize + o.MaxSize/2 + 1)
+	random, _ := corpus.Bytes(corpus.Random, size, 1)
+	text, _ := corpus.Bytes(corpus.Text, size, 1)
+	return map[string][]byte{
+		"random": random,
+		"text":   text,
+		"zeros":  make([]byte, size),
+		"ones":   bytes.Repeat([]byte{0xff}, int(size)),
+	}
+}
+
+// lengths are the values of n Algorithm is called with: the edges of the
+// size triple and a spread of others, up to MaxSize.
+func lengths(o *chunkers.ChunkerOpts) []int {
+	ns := []int{1, 2, o.MinSize - 1, o.MinSize, o.MinSize + 1, o.NormalSize - 1, o.NormalSize,
+		o.NormalSize + 1, o.MaxSize - 1, o.MaxSize}
+	rng := rand.New(rand.NewSource(1))
+	for range 16 {
+		ns = append(ns, 1+rng.Intn(o.MaxSize))
+	}
+	slices.Sort(ns)
+	return slices.Compact(slices.DeleteFunc(ns, func(n int) bool { return n < 1 || n > o.MaxSize }))
+}
+
+// cut calls Algorithm, turning a panic into an error.
+func cut(impl chunkers.ChunkerImplementation, o *chunkers.ChunkerOpts, data []byte, n int) (c int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return impl.Algorithm(o, data, n), nil
+}
+
+func checkAlgorithm(t testing.TB, alloc func() chunkers.ChunkerImplementation, o *chunkers.ChunkerOpts) {
+	impl, o1 := implementation(t, alloc, o)
+	other, o2 := implementation(t, alloc, o)
+	for what, data := range inputs(o) {
+		// The same bytes with another tail past each n.
+		scrambled := bytes.Clone(data)
+		for i := range scrambled {
+			scrambled[i] ^= 0x5a
+		}
+		for _, n := range lengths(o) {
+			c, err := cut(impl, o1, data[:n+len(data)-o.MaxSize], n)
+			if err != nil {
+				t.Errorf("%s, n=%d: %v", what, n, err)
+				continue
+			}
+			switch {
+			case c <= 0 || c > n:
+				t.Errorf("%s, n=%d: cut point %d out of (0, n]", what, n, c)
+			case c > o.MaxSize:
+				t.Errorf("%s, n=%d: cut point %d past MaxSize %d", what, n, c, o.MaxSize)
+			case n <= o.MinSize:
+				if c != n {
+					t.Errorf("%s, n=%d: cut point %d with n at most MinSize %d, want n", what, n, c, o.MinSize)
+				}
+			case c < o.MinSize:
+				t.Errorf("%s, n=%d: cut point %d below MinSize %d", what, n, c, o.MinSize)
+			}
+
+			if again, _ := cut(impl, o1, data[:n+len(data)-o.MaxSize], n); again != c {
+				t.Errorf("%s, n=%d: cut point %d, then %d", what, n, c, again)
+			}
+			if fresh, _ := cut(other, o2, data[:n+len(data)-o.MaxSize], n); fresh != c {
+				t.Errorf("%s, n=%d: cut point %d, %d from another instance", what, n, c, fresh)
+			}
+			if exact, err := cut(impl, o1, data[:n:n], n); exact != c || err != nil {
+				t.Errorf("%s, n=%d: cut point %d, %d (%v) with len(data) == n", what, n, c, exact, err)
+			}
+			tail := append(data[:n:n], scrambled[n:]...)
+			if moved, err := cut(impl, o1, tail, n); moved != c || err != nil {
+				t.Errorf("%s, n=%d: cut point %d, %d (%v) with other data past n", what, n, c, moved, err)
+			}
+		}
+	}
+}
+
+func checkSetup(t testing.TB, alloc func() chunkers.ChunkerImplementation, o *chunkers.ChunkerOpts) {
+	once, oo := implementation(t, alloc, o)
+	twice, ot := implementation(t, alloc, o)
+	if err := twice.Setup(ot); err != nil {
+		t.Fatalf("second Setup: %v", err)
+	}
+	if oo.MinSize != ot.MinSize || oo.NormalSize != ot.NormalSize || oo.MaxSize != ot.MaxSize {
+		t.Errorf("second Setup changed the sizes: %+v, then %+v", oo, ot)
+	}
+	for what, data := range inputs(o) {
+		for _, n := range lengths(o) {
+			a, _ := cut(once, oo, data, n)
+			b, err := cut(twice, ot, data, n)
+			if a != b || err != nil {
+				t.Errorf("%s, n=%d: cut point %d, %d (%v) after a second Setup", what, n, a, b, err)
+			}
+		}
+	}
+}
+
+func checkChunker(t testing.TB, name string, o *chunkers.ChunkerOpts) {
+	size := int64(8*o.MaxSize + o.MaxSize/3)
+	for _, kind := range []corpus.Kind{corpus.Random, corpus.LowEntropy} {
+		data, err := corpus.Bytes(kind, size, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunkerstest.Check(t, name, o, data)
+	}
+}
@@ -0,0 +1,97 @@
+package conformance
+
+import (
+	"strings"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fixed"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/chunkerstest"
+)
+
+func TestBuiltins(t *testing.T) {
+	small := &chunkers.ChunkerOpts{MinSize: 2 << 10, NormalSize: 8 << 10, MaxSize: 64 << 10}
+	for _, name := range chunkers.Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			if name == "fixed-v1.0.0" {
+				Run(t, name, &chunkers.ChunkerOpts{MinSize: 4 << 10, NormalSize: 4 << 10, MaxSize: 4 << 10})
+				return
+			}
+			Run(t, name, small)
+		})
+	}
+}
+
+type base struct{}
+
+func (base) DefaultOptions() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: 256, NormalSize: 1 << 10, MaxSize: 4 << 10}
+}
+func (base) Setup(*chunkers.ChunkerOpts) error    { return nil }
+func (base) Validate(*chunkers.ChunkerOpts) error { return nil }
+
+// byLen cuts at len(data) rather than n.
+type byLen struct{ base }
+
+func (byLen) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int {
+	return min(len(data), o.MaxSize)
+}
+
+// pastN cuts by the byte at n, and panics when there is none.
+type pastN struct{ base }
+
+func (pastN) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int {
+	if n <= o.MinSize || data[n]&1 == 0 {
+		return n
+	}
+	return o.MinSize
+}
+
+// stateful cuts further along on every call.
+type stateful struct {
+	base
+	calls *int
+}
+
+func (s stateful) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int {
+	*s.calls++
+	if n <= o.MinSize {
+		return n
+	}
+	return o.MinSize + *s.calls%(n-o.MinSize+1)
+}
+
+// growing doubles MaxSize on every Setup.
+type growing struct{ base }
+
+func (growing) Setup(o *chunkers.ChunkerOpts) error {
+	o.MaxSize *= 2
+	return nil
+}
+
+func (growing) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int { return n }
+
+func TestCatches(t *testing.T) {
+	for name, tc := range map[string]struct {
+		impl  chunkers.ChunkerImplementation
+		check func(testing.TB, func() chunkers.ChunkerImplementation, *chunkers.ChunkerOpts)
+		want  string
+	}{
+		"by-len":   {byLen{}, checkAlgorithm, "out of (0, n]"},
+		"past-n":   {pastN{}, checkAlgorithm, "panic"},
+		"stateful": {stateful{calls: new(int)}, checkAlgorithm, "then"},
+		"growing":  {growing{}, checkSetup, "second Setup changed the sizes"},
+	} {
+		// Registering them would put them in the way of TestBuiltins.
+		alloc := func() chunkers.ChunkerImplementation { return tc.impl }
+		o := tc.impl.DefaultOptions()
+		failures := chunkerstest.Record(func(t testing.TB) { tc.check(t, alloc, o) })
+		if !strings.Contains(strings.Join(failures, "\n"), tc.want) {
+			t.Errorf("%s: want a failure about %q, got %q", name, tc.want, failures)
+		}
+	}
+}
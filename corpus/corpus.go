@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package corpus generates synthetic workloads for benchmarks and dedup
+// measurements: random data, low-entropy runs, sparse images of zero pages,
+// text, VM-image-like block devices, tar archives of many small files, and
+// series of versions of a file edited at a controlled rate. Every workload is
+// a pure function of its kind, size and seed, drawn from math/rand sources
+// whose sequences Go keeps stable, so a figure measured on one machine can be
+// reproduced on another from the same three parameters.
+package corpus
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
+)
+
+// Kind is a type of workload.
+type Kind string
+
+const (
+	// Random is incompressible data: the math/rand stream of the seed, so
+	// Random of seed 0 is the rand.New(rand.NewSource(0)) data the tests
+	// and benchmarks have always used.
+	Random Kind = "random"
+	// LowEntropy alternates long runs of one byte, short patterns repeated
+	// over kilobytes and short random stretches.
+	LowEntropy Kind = "low-entropy"
+	// ZeroPages is a sparse image: runs of zeroed 4 KiB pages between runs
+	// of random pages.
+	ZeroPages Kind = "zero-pages"
+	// Text is English-like prose over a small vocabulary, with Zipfian word
+	// frequencies, wrapped lines and paragraphs.
+	Text Kind = "text"
+	// VMImage is a block device of 4 KiB blocks: zero blocks, text and
+	// random blocks, and runs of blocks copied from earlier in the image,
+	// as duplicated files and packages leave in a VM disk.
+	VMImage Kind = "vm-image"
+	// Tar is a ustar archive of many small text and binary files.
+	Tar Kind = "tar"
+)
+
+var kinds = []Kind{Random, LowEntropy, ZeroPages, Text, VMImage, Tar}
+
+var ErrKind = errors.New("unknown corpus kind")
+var ErrSeries = errors.New("invalid series")
+
+// Kinds returns every kind, in a stable order.
+func Kinds() []Kind {
+	return append([]Kind(nil), kinds...)
+}
+
+func ParseKind(name string) (Kind, error) {
+	for _, k := range kinds {
+		if string(k) == name {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrKind, name)
+}
+
+// pageSize is the page and block size of ZeroPages and VMImage.
+const pageSize = 4096
+
+// New returns a reader of exactly size bytes of the given kind, generated
+// from seed as it is read: size is not bounded by memory. The same kind,
+// size and seed always give the same bytes, and a workload is a prefix of
+// any larger one of the same kind and seed, except for Tar which closes
+// the archive to fit in size.
+func New(kind Kind, size, seed int64) (io.Reader, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("corpus: negative size %d", size)
+	}
+	r := rand.New(rand.NewSource(seed))
+	var next func() []byte
+	switch kind {
+	case Random:
+		next = randomGen(r)
+	case LowEntropy:
+		next = lowEntropyGen(r)
+	case ZeroPages:
+		next = zeroPagesGen(r)
+	case Text:
+		next = newTextGen(r).paragraph
+	case VMImage:
+		next = vmImageGen(r)
+	case Tar:
+		next = tarGen(r, size)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrKind, kind)
+	}
+	return &reader{next: next, left: size}, nil
+}
+
+// Bytes returns the workload New would stream.
+func Bytes(kind Kind, size, seed int64) ([]byte, error) {
+	rd, err := New(kind, size, seed)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	_, err = io.ReadFull(rd, b)
+	return b, err
+}
+
+// Series generates n versions of a file and passes each to fn, in order:
+// version 0 is Bytes(kind, size, seed), and each next version is the
+// previous one with edits drawn from m, enough of them that about rate of
+// its bytes change. The edits of version i are drawn from seed+i. m defaults
+// to an even mixture of insertions, deletions and overwrites of 64 bytes.
+// Only the current and previous versions are held in memory; fn must not
+// keep data after it returns.
+func Series(kind Kind, size, seed int64, n int, rate float64, m *edits.Model, fn func(version int, data []byte) error) error {
+	if n < 1 {
+		return fmt.Errorf("%w: %d versions", ErrSeries, n)
+	}
+	if rate < 0 || rate > 1 || math.IsNaN(rate) {
+		return fmt.Errorf("%w: edit rate %g out of [0, 1]", ErrSeries, rate)
+	}
+	if m == nil {
+		m = &edits.Model{Kinds: []edits.Kind{edits.Insert, edits.Delete, edits.Overwrite}, Size: 64}
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	data, err := Bytes(kind, size, seed)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			count := int(math.Round(rate * float64(len(data)) / float64(max(m.Size, 1))))
+			if count == 0 && rate > 0 {
+				count = 1
+			}
+			plan, err := m.Plan(int64(len(data)), count, seed+int64(i))
+			if err != nil {
+				return err
+			}
+			data = plan.Apply(data)
+		}
+		if err := fn(i, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reader serves the segments a generator produces, up to left bytes.
+type reader struct {
+	next func() []byte
+	buf  []byte
+	left int64
+}
+
+func (rd *reader) Read(p []byte) (int, error) {
+	if rd.left <= 0 {
+		return 0, io.EOF
+	}
+	for len(rd.buf) == 0 {
+		rd.buf = rd.next()
+	}
+	if int64(len(p)) > rd.left {
+		p = p[:rd.left]
+	}
+	n := copy(p, rd.buf)
+	rd.buf = rd.buf[n:]
+	rd.left -= int64(n)
+	return n, nil
+}
+
+func randomGen(r *rand.Rand) func() []byte {
+	// rand.Rand.Read carries its state across calls, so the segments
+	// concatenate to the very stream a single Read would return.
+	buf := make([]byte, 64<<10)
+	return func() []byte {
+		r.Read(buf)
+		return buf
+	}
+}
+
+// between returns a number in [lo, hi].
+func between(r *rand.Rand, lo, hi int) int {
+	return lo + r.Intn(hi-lo+1)
+}
+
+func lowEntropyGen(r *rand.Rand) func() []byte {
+	return func() []byte {
+		switch x := r.Intn(10); {
+		case x < 4: // a run of one byte
+			return bytes.Repeat([]byte{byte(r.Intn(256))}, between(r, 512, 64<<10))
+		case x < 8: // a short pattern repeated
+			pat := make([]byte, between(r, 2, 16))
+			r.Read(pat)
+			return bytes.Repeat(pat, between(r, 1<<10, 64<<10)/len(pat))
+		default: // a short random stretch
+			b := make([]byte, between(r, 16, 1<<10))
+			r.Read(b)
+			return b
+		}
+	}
+}
+
+func zeroPagesGen(r *rand.Rand) func() []byte {
+	zeros := true // start with data
+	return func() []byte {
+		zeros = !zeros
+		if zeros {
+			return make([]byte, between(r, 1, 64)*pageSize)
+		}
+		b := make([]byte, between(r, 1, 16)*pageSize)
+		r.Read(b)
+		return b
+	}
+}
+
+var vocabulary = strings.Fields(`
+	the of and to a in is it you that he was for on are with as his they be
+	at one have this from or had by hot but some what there we can out other
+	were all your when up use word how said an each she which do their time if
+	will way about many then them would write like so these her long make thing
+	see him two has look more day could go come did my sound no most number who
+	over know water than call first people may down side been now find any new
+	work part take get place made live where after back little only round man
+	year came show every good me give our under name very through just form
+	much great think say help low line before turn cause same mean differ move
+	right boy old too does tell sentence set three want air well also play small
+	end put home read hand port large spell add even land here must big high
+	such follow act why ask men change went light kind off need house picture
+	try us again animal point mother world near build self earth father chunk
+	boundary snapshot backup store content defined hash window`)
+
+// textGen writes prose, word frequencies following Zipf's law as in natural
+// language.
+type textGen struct {
+	r    *rand.Rand
+	zipf *rand.Zipf
+}
+
+func newTextGen(r *rand.Rand) *textGen {
+	return &textGen{r: r, zipf: rand.NewZipf(r, 1.1, 2, uint64(len(vocabulary)-1))}
+}
+
+// paragraph returns a paragraph of 2 to 12 sentences wrapped at 72 columns,
+// followed by a blank line.
+func (tg *textGen) paragraph() []byte {
+	var b bytes.Buffer
+	col := 0
+	for s := between(tg.r, 2, 12); s > 0; s-- {
+		words := between(tg.r, 4, 20)
+		for w := 0; w < words; w++ {
+			word := vocabulary[tg.zipf.Uint64()]
+			if w == 0 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			switch {
+			case w == words-1:
+				word += "."
+			case tg.r.Intn(12) == 0:
+				word += ","
+			}
+			if col > 0 && col+1+len(word) > 72 {
+				b.WriteByte('\n')
+				col = 0
+			} else if col > 0 {
+				b.WriteByte(' ')
+				col++
+			}
+			b.WriteString(word)
+			col += len(word)
+		}
+	}
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+// fill fills b with text, cutting the last paragraph.
+func (tg *textGen) fill(b []byte) {
+	for n := 0; n < len(b); {
+		n += copy(b[n:], tg.paragraph())
+	}
+}
+
+// vmHistory bounds the blocks a VM image remembers to copy from, 16 MiB.
+const vmHistory = 4096
+
+func vmImageGen(r *rand.Rand) func() []byte {
+	tg := newTextGen(r)
+	var history [][]byte
+	return func() []byte {
+		switch x := r.Intn(20); {
+		case x < 5: // zero blocks
+			return make([]byte, between(r, 1, 32)*pageSize)
+		case x < 12 && len(history) > 0: // a run copied from earlier
+			start := r.Intn(len(history))
+			end := min(len(history), start+between(r, 1, 32))
+			var b []byte
+			for _, blk := range history[start:end] {
+				b = append(b, blk...)
+			}
+			return b
+		default: // a new text or random block
+			blk := make([]byte, pageSize)
+			if r.Intn(2) == 0 {
+				tg.fill(blk)
+			} else {
+				r.Read(blk)
+			}
+			if len(history) == vmHistory {
+				history[r.Intn(vmHistory)] = blk
+			} else {
+				history = append(history, blk)
+			}
+			return blk
+		}
+	}
+}
+
+// tarEpoch is the modification time of the first archive member.
+var tarEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tarGen writes a ustar archive of up to size bytes. Members are added while
+// they fit with the end-of-archive marker; the last one is shrunk to fit,
+// and whatever space is left after the marker is zero padding, which tar
+// readers ignore. Under 1 KiB the marker itself does not fit.
+func tarGen(r *rand.Rand, size int64) func() []byte {
+	tg := newTextGen(r)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	left, closed, i := size, false, 0
+	return func() []byte {
+		buf.Reset()
+		// Room for a payload, rounded up to blocks, after its header and
+		// with the 1 KiB end-of-archive marker still to come.
+		room := left - 3*512
+		switch {
+		case closed:
+			return make([]byte, max(left, 512))
+		case room < 0:
+			tw.Close()
+			closed = true
+		default:
+			// File sizes are log-uniform up to 64 KiB: many small files,
+			// a few larger ones.
+			n := int64(math.Exp(r.Float64()*math.Log(64<<10))) - 1
+			n = min(n, room)
+			if n%512 != 0 && n/512*512+512 > room {
+				n = room / 512 * 512
+			}
+			name, data := fmt.Sprintf("dir%02d/file%05d", i%37, i), make([]byte, n)
+			if r.Intn(3) == 0 {
+				r.Read(data)
+				name += ".bin"
+			} else {
+				tg.fill(data)
+				name += ".txt"
+			}
+			tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     0o644,
+				Uid:      1000,
+				Gid:      1000,
+				Uname:    "plakar",
+				Gname:    "plakar",
+				Size:     n,
+				ModTime:  tarEpoch.Add(time.Duration(i) * time.Minute),
+				Format:   tar.FormatUSTAR,
+			})
+			tw.Write(data)
+			tw.Flush()
+			i++
+		}
+		left -= int64(buf.Len())
+		return buf.Bytes()
+	}
+}
@@ -0,0 +1,183 @@
+package corpus
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/PlakarKorp/go-cdc-chunkers/edits"
+)
+
+func generate(t *testing.T, kind Kind, size, seed int64) []byte {
+	t.Helper()
+	b, err := Bytes(kind, size, seed)
+	if err != nil {
+		t.Fatalf("%s: %v", kind, err)
+	}
+	if int64(len(b)) != size {
+		t.Fatalf("%s: %d bytes, want %d", kind, len(b), size)
+	}
+	return b
+}
+
+// TestDigests pins the workloads: figures measured from a kind, size and
+// seed must be reproducible on any machine and by any later version.
+func TestDigests(t *testing.T) {
+	want := map[Kind]string{
+		Random:     "a718f4a112454b50c8ecd2b0a5b00eb32ee90699593625139cd3fabc97dcce8d",
+		LowEntropy: "19581733ead621e2ccfd4336192a19196fff97c487652149634c83d5c0fdef20",
+		ZeroPages:  "5da18e44a2c753522af5d948ab13437008a010fa58d3ad827c81e2bf4cd24883",
+		Text:       "61912cef05a38e5416e49a359b18d4a2cbf0f2253facf0e10638dfbc2323e6ba",
+		VMImage:    "c4bc462e5376e3f09f8cf25a2e935ba581407d0630b90ad57857a6481363599e",
+		Tar:        "3a58a5c9b72b6eb9d9095055cdc5a4ef6525e300fa8a4d3452190684b03ebd19",
+	}
+	for _, k := range Kinds() {
+		sum := sha256.Sum256(generate(t, k, 1<<20, 1))
+		if got := hex.EncodeToString(sum[:]); got != want[k] {
+			t.Errorf("%s: digest %s, want %s", k, got, want[k])
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	for _, k := range Kinds() {
+		for _, size := range []int64{0, 1, 5000, 3 << 16} {
+			a, b := generate(t, k, size, 7), generate(t, k, size, 7)
+			if !bytes.Equal(a, b) {
+				t.Fatalf("%s/%d: same seed, different bytes", k, size)
+			}
+			if size >= 5000 && bytes.Equal(a, generate(t, k, size, 8)) {
+				t.Fatalf("%s/%d: different seeds, same bytes", k, size)
+			}
+		}
+	}
+}
+
+func TestRandomStream(t *testing.T) {
+	want := make([]byte, 100000)
+	rand.New(rand.NewSource(0)).Read(want)
+	if !bytes.Equal(generate(t, Random, int64(len(want)), 0), want) {
+		t.Fatal("Random of seed 0 is not the rand.NewSource(0) stream")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, k := range Kinds() {
+		if k == Tar {
+			continue // the archive is closed to fit
+		}
+		if !bytes.HasPrefix(generate(t, k, 300000, 3), generate(t, k, 12345, 3)) {
+			t.Fatalf("%s: a smaller workload is not a prefix of a larger one", k)
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	for _, k := range Kinds() {
+		rd, err := New(k, 50000, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(iotest.OneByteReader(rd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, generate(t, k, 50000, 5)) {
+			t.Fatalf("%s: byte-at-a-time reads differ from Bytes", k)
+		}
+	}
+}
+
+func TestTar(t *testing.T) {
+	for _, size := range []int64{0, 1024, 1536, 5000, 1 << 20} {
+		tr := tar.NewReader(bytes.NewReader(generate(t, Tar, size, 1)))
+		var members, payload int64
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%d: member %d: %v", size, members, err)
+			}
+			n, err := io.Copy(io.Discard, tr)
+			if err != nil || n != hdr.Size {
+				t.Fatalf("%d: %s: %d of %d bytes: %v", size, hdr.Name, n, hdr.Size, err)
+			}
+			members++
+			payload += n
+		}
+		if size == 1<<20 && (members < 50 || payload < size/2) {
+			t.Fatalf("%d: %d members, %d payload bytes", size, members, payload)
+		}
+	}
+}
+
+// TestDuplicates checks the kinds meant to dedup do.
+func TestDuplicates(t *testing.T) {
+	for _, k := range []Kind{ZeroPages, VMImage} {
+		b := generate(t, k, 8<<20, 1)
+		seen := make(map[[32]byte]bool)
+		for off := 0; off < len(b); off += pageSize {
+			seen[sha256.Sum256(b[off:off+pageSize])] = true
+		}
+		if blocks := len(b) / pageSize; len(seen) > blocks*3/4 {
+			t.Fatalf("%s: %d distinct blocks of %d", k, len(seen), blocks)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	base := generate(t, Text, 1<<20, 1)
+	var versions [][]byte
+	err := Series(Text, 1<<20, 1, 4, 0.01, nil, func(i int, data []byte) error {
+		if i != len(versions) {
+			t.Fatalf("version %d after %d", i, len(versions))
+		}
+		versions = append(versions, bytes.Clone(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 4 || !bytes.Equal(versions[0], base) {
+		t.Fatal("version 0 is not the base workload")
+	}
+	for i := 1; i < len(versions); i++ {
+		if bytes.Equal(versions[i], versions[i-1]) {
+			t.Fatalf("version %d is unchanged", i)
+		}
+		if d := len(versions[i]) - len(versions[i-1]); d > 1<<14 || d < -1<<14 {
+			t.Fatalf("version %d: size changed by %d at a 1%% edit rate", i, d)
+		}
+	}
+
+	orig := generate(t, Random, 1000, 1)
+	m := &edits.Model{Kinds: []edits.Kind{edits.Overwrite}, Size: 16}
+	err = Series(Random, 1000, 1, 3, 0, m, func(i int, data []byte) error {
+		if !bytes.Equal(data, orig) {
+			t.Fatalf("version %d changed at a zero edit rate", i)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noop := func(int, []byte) error { return nil }
+	if err := Series(Text, 10, 1, 0, 0, nil, noop); !errors.Is(err, ErrSeries) {
+		t.Fatalf("0 versions: %v", err)
+	}
+	if err := Series(Text, 10, 1, 2, 1.5, nil, noop); !errors.Is(err, ErrSeries) {
+		t.Fatalf("rate 1.5: %v", err)
+	}
+	if _, err := ParseKind("nope"); !errors.Is(err, ErrKind) {
+		t.Fatalf("ParseKind: %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package edits simulates edits to a file, to measure how well a chunker
+// resynchronises after them. An edit model draws random insertions,
+// deletions, overwrites, block moves, appends and prepends, possibly
+// clustered in one region of the file, and lays out the edited file as a
+// Plan: pieces of the original and inserted bytes. A Plan streams the edited
+// file from the original, so neither has to fit in memory.
+package edits
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Kind is a type of edit.
+type Kind int
+
+const (
+	// Insert adds Size random bytes anywhere, shifting the tail: the hard
+	// case for chunk re-synchronisation.
+	Insert Kind = iota
+	// Delete removes Size bytes anywhere, shifting the tail back.
+	Delete
+	// Overwrite replaces Size bytes in place; nothing shifts.
+	Overwrite
+	// Move cuts Size bytes and pastes them elsewhere in the file.
+	Move
+	// Append adds Size random bytes at the end of the file.
+	Append
+	// Prepend adds Size random bytes at the start of the file.
+	Prepend
+)
+
+var kindNames = []string{"insert", "delete", "overwrite", "move", "append", "prepend"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// ParseKind returns the Kind with the given name.
+func ParseKind(name string) (Kind, error) {
+	for i, n := range kindNames {
+		if n == name {
+			return Kind(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", ErrKind, name)
+}
+
+var ErrKind = errors.New("unknown edit kind")
+var ErrModel = errors.New("invalid edit model")
+
+// Model describes the edits to draw.
+type Model struct {
+	// Kinds is the mixture edits are drawn from, uniformly: repeating a
+	// kind weights it.
+	Kinds []Kind
+	// Size is the number of bytes inserted, deleted, overwritten or moved
+	// by each edit.
+	Size int
+	// Cluster, when positive, keeps every edit within a window of Cluster
+	// bytes around the first one, as when a single record or section of a
+	// file is rewritten. Otherwise edits land anywhere.
+	Cluster int64
+}
+
+// ParseModel parses a comma-separated mixture of kinds, each optionally
+// weighted as in "insert:3,delete:1". Size and Cluster are left to the
+// caller.
+func ParseModel(spec string) (*Model, error) {
+	m := &Model{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, weight := item, 1
+		if i := strings.IndexByte(item, ':'); i >= 0 {
+			w, err := strconv.Atoi(item[i+1:])
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("%w: bad weight in %q", ErrModel, item)
+			}
+			name, weight = item[:i], w
+		}
+		k, err := ParseKind(name)
+		if err != nil {
+			return nil, err
+		}
+		for ; weight > 0; weight-- {
+			m.Kinds = append(m.Kinds, k)
+		}
+	}
+	if len(m.Kinds) == 0 {
+		return nil, fmt.Errorf("%w: no edit kind in %q", ErrModel, spec)
+	}
+	return m, nil
+}
+
+// String returns the model in the form ParseModel accepts.
+func (m *Model) String() string {
+	var names []string
+	weights := make(map[Kind]int)
+	for _, k := range m.Kinds {
+		if weights[k] == 0 {
+			names = append(names, k.String())
+		}
+		weights[k]++
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	for i, n := range names {
+		k, _ := ParseKind(n)
+		names[i] = n + ":" + strconv.Itoa(weights[k])
+	}
+	return strings.Join(names, ",")
+}
+
+func (m *Model) Validate() error {
+	if len(m.Kinds) == 0 {
+		return fmt.Errorf("%w: no edit kind", ErrModel)
+	}
+	for _, k := range m.Kinds {
+		if k < 0 || int(k) >= len(kindNames) {
+			return ErrKind
+		}
+	}
+	if m.Size < 0 || m.Cluster < 0 {
+		return fmt.Errorf("%w: negative size", ErrModel)
+	}
+	return nil
+}
+
+// Piece is a stretch of the edited file: either Length bytes of the
+// original starting at Offset, or inserted bytes (Data).
+type Piece struct {
+	Offset int64
+	Length int64
+	Data   []byte
+}
+
+// Plan lays out an edited file as pieces.
+type Plan []Piece
+
+// Plan draws n edits into a file of size bytes. Each edit applies to the file
+// as edited so far, so edits can overlap. The same seed always gives the same
+// plan; a pure insertion model draws exactly as successive calls to
+// rand.Intn for the position and rand.Read for the bytes would.
+func (m *Model) Plan(size int64, n int, seed int64) (Plan, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(seed))
+	var plan Plan
+	if size > 0 {
+		plan = Plan{{Length: size}}
+	}
+	center := int64(-1)
+	for i := 0; i < n; i++ {
+		kind := m.Kinds[0]
+		if len(m.Kinds) > 1 {
+			kind = m.Kinds[r.Intn(len(m.Kinds))]
+		}
+		total := plan.Size()
+		pos := m.position(r, total, &center)
+
+		switch kind {
+		case Insert:
+			plan = plan.insert(pos, randomBytes(r, m.Size))
+		case Delete:
+			plan, _ = plan.remove(pos, min(int64(m.Size), total-pos))
+		case Overwrite:
+			var cut Plan
+			plan, cut = plan.remove(pos, min(int64(m.Size), total-pos))
+			plan = plan.insert(pos, randomBytes(r, int(cut.Size())))
+		case Move:
+			var cut Plan
+			plan, cut = plan.remove(pos, min(int64(m.Size), total-pos))
+			to := m.position(r, plan.Size()+1, &center)
+			plan = plan.insertPieces(to, cut)
+		case Append:
+			plan = plan.insert(total, randomBytes(r, m.Size))
+		case Prepend:
+			plan = plan.insert(0, randomBytes(r, m.Size))
+		}
+	}
+	return plan, nil
+}
+
+// position draws an offset in [0, total), within the cluster window when
+// there is one. The first draw places the window.
+func (m *Model) position(r *rand.Rand, total int64, center *int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	if m.Cluster <= 0 || *center < 0 {
+		pos := int64(r.Intn(int(total)))
+		if m.Cluster > 0 {
+			*center = pos
+		}
+		return pos
+	}
+	lo := max(0, min(*center, total-1)-m.Cluster/2)
+	hi := min(total, lo+max(m.Cluster, 1))
+	return lo + r.Int63n(hi-lo)
+}
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+// Size is the size of the edited file.
+func (p Plan) Size() int64 {
+	var n int64
+	for _, piece := range p {
+		n += piece.Length
+	}
+	return n
+}
+
+// cut splits the piece containing pos, if any, and returns the index of the
+// first piece at or after pos.
+func (p Plan) cut(pos int64) (Plan, int) {
+	for i, piece := range p {
+		if pos == 0 {
+			return p, i
+		}
+		if pos >= piece.Length {
+			pos -= piece.Length
+			continue
+		}
+		head, tail := piece, piece
+		head.Length, tail.Length = pos, piece.Length-pos
+		if piece.Data != nil {
+			head.Data, tail.Data = piece.Data[:pos], piece.Data[pos:]
+		} else {
+			tail.Offset += pos
+		}
+		out := make(Plan, 0, len(p)+1)
+		out = append(out, p[:i]...)
+		out = append(out, head, tail)
+		return append(out, p[i+1:]...), i + 1
+	}
+	return p, len(p)
+}
+
+func (p Plan) insert(pos int64, data []byte) Plan {
+	if len(data) == 0 {
+		return p
+	}
+	return p.insertPieces(pos, Plan{{Length: int64(len(data)), Data: data}})
+}
+
+func (p Plan) insertPieces(pos int64, pieces Plan) Plan {
+	p, i := p.cut(pos)
+	out := make(Plan, 0, len(p)+len(pieces))
+	out = append(out, p[:i]...)
+	out = append(out, pieces...)
+	return append(out, p[i:]...)
+}
+
+// remove takes n bytes out at pos and returns them as pieces.
+func (p Plan) remove(pos, n int64) (Plan, Plan) {
+	if n <= 0 {
+		return p, nil
+	}
+	p, i := p.cut(pos)
+	p, j := p.cut(pos + n)
+	cut := append(Plan(nil), p[i:j]...)
+	out := make(Plan, 0, len(p)-(j-i))
+	out = append(out, p[:i]...)
+	return append(out, p[j:]...), cut
+}
+
+// Reader streams the edited file, reading the original pieces from orig.
+func (p Plan) Reader(orig io.ReaderAt) io.Reader {
+	readers := make([]io.Reader, 0, len(p))
+	for _, piece := range p {
+		if piece.Data != nil {
+			readers = append(readers, bytes.NewReader(piece.Data))
+		} else {
+			readers = append(readers, io.NewSectionReader(orig, piece.Offset, piece.Length))
+		}
+	}
+	return io.MultiReader(readers...)
+}
+
+// Apply returns the edited version of orig.
+func (p Plan) Apply(orig []byte) []byte {
+	out := make([]byte, 0, p.Size())
+	for _, piece := range p {
+		if piece.Data != nil {
+			out = append(out, piece.Data...)
+		} else {
+			out = append(out, orig[piece.Offset:piece.Offset+piece.Length]...)
+		}
+	}
+	return out
+}
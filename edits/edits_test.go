@@ -0,0 +1,158 @@
+package edits
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomData(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func apply(t *testing.T, m *Model, data []byte, n int, seed int64) []byte {
+	t.Helper()
+	plan, err := m.Plan(int64(len(data)), n, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := io.ReadAll(plan.Reader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := plan.Apply(data)
+	if !bytes.Equal(streamed, out) || plan.Size() != int64(len(out)) {
+		t.Fatalf("%s: Reader and Apply disagree", m)
+	}
+	return out
+}
+
+// TestInsertDraws pins the random sequence of the insertion model: resync
+// figures measured before mixtures existed must stay reproducible.
+func TestInsertDraws(t *testing.T) {
+	m := &Model{Kinds: []Kind{Insert}, Size: 3}
+	for _, size := range []int{0, 1, 1000} {
+		data := randomData(1, size)
+
+		r := rand.New(rand.NewSource(7))
+		want := append([]byte(nil), data...)
+		for i := 0; i < 20; i++ {
+			pos := 0
+			if len(want) > 0 {
+				pos = r.Intn(len(want))
+			}
+			ins := make([]byte, m.Size)
+			r.Read(ins)
+			want = append(want[:pos], append(ins, want[pos:]...)...)
+		}
+
+		if got := apply(t, m, data, 20, 7); !bytes.Equal(got, want) {
+			t.Fatalf("size=%d: insertions differ from the reference", size)
+		}
+	}
+}
+
+func TestKinds(t *testing.T) {
+	data := randomData(2, 10000)
+	sorted := func(b []byte) []byte {
+		b = append([]byte(nil), b...)
+		sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+		return b
+	}
+
+	if out := apply(t, &Model{Kinds: []Kind{Delete}, Size: 10}, data, 8, 1); len(out) != len(data)-80 {
+		t.Fatalf("delete: got %d bytes, want %d", len(out), len(data)-80)
+	}
+	if out := apply(t, &Model{Kinds: []Kind{Overwrite}, Size: 10}, data, 8, 1); len(out) != len(data) || bytes.Equal(out, data) {
+		t.Fatalf("overwrite: size changed or nothing overwritten")
+	}
+	out := apply(t, &Model{Kinds: []Kind{Move}, Size: 100}, data, 4, 1)
+	if bytes.Equal(out, data) || !bytes.Equal(sorted(out), sorted(data)) {
+		t.Fatalf("move: the edited file is not a permutation of the original")
+	}
+	if out := apply(t, &Model{Kinds: []Kind{Append}, Size: 5}, data, 3, 1); len(out) != len(data)+15 || !bytes.HasPrefix(out, data) {
+		t.Fatalf("append: original is not a prefix")
+	}
+	if out := apply(t, &Model{Kinds: []Kind{Prepend}, Size: 5}, data, 3, 1); len(out) != len(data)+15 || !bytes.HasSuffix(out, data) {
+		t.Fatalf("prepend: original is not a suffix")
+	}
+
+	// Every kind must cope with edits larger than the file.
+	for k := range kindNames {
+		apply(t, &Model{Kinds: []Kind{Kind(k)}, Size: 50}, data[:30], 10, 3)
+		apply(t, &Model{Kinds: []Kind{Kind(k)}, Size: 50}, nil, 10, 3)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	data := randomData(3, 1<<20)
+	m := &Model{Kinds: []Kind{Overwrite}, Size: 8, Cluster: 4096}
+	for seed := int64(0); seed < 20; seed++ {
+		out := apply(t, m, data, 32, seed)
+		first, last := -1, -1
+		for i := range data {
+			if out[i] != data[i] {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 || last-first >= int(m.Cluster)+m.Size {
+			t.Fatalf("seed %d: edits spread over [%d, %d], cluster is %d", seed, first, last, m.Cluster)
+		}
+	}
+}
+
+func TestMixture(t *testing.T) {
+	data := randomData(4, 50000)
+	m, err := ParseModel("insert:2,delete,overwrite,move,append:0,prepend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "insert:2,delete:1,overwrite:1,move:1,prepend:1" {
+		t.Fatalf("unexpected model %q", m)
+	}
+	m.Size = 64
+	a := apply(t, m, data, 100, 9)
+	if b := apply(t, m, data, 100, 9); !bytes.Equal(a, b) {
+		t.Fatal("same seed, different plans")
+	}
+	if b := apply(t, m, data, 100, 10); bytes.Equal(a, b) {
+		t.Fatal("different seeds, same plan")
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	for _, spec := range []string{"", "insert:x", "insert:-1", "resize", "append:0"} {
+		if _, err := ParseModel(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+	if _, err := ParseModel("splice"); !errors.Is(err, ErrKind) {
+		t.Fatalf("expected ErrKind, got %v", err)
+	}
+	if m, _ := ParseModel("delete"); m.String() != "delete" {
+		t.Fatalf("got %q", m)
+	}
+}
+
+func TestMeanCI95(t *testing.T) {
+	if m, h := MeanCI95(nil); m != 0 || h != 0 {
+		t.Fatalf("no samples: %v ± %v", m, h)
+	}
+	if m, h := MeanCI95([]float64{3}); m != 3 || h != 0 {
+		t.Fatalf("single sample: %v ± %v", m, h)
+	}
+	// mean 2, sd 1, n 3: 4.303 / sqrt(3)
+	m, h := MeanCI95([]float64{1, 2, 3})
+	if m != 2 || math.Abs(h-2.4843) > 1e-3 {
+		t.Fatalf("got %v ± %v", m, h)
+	}
+}
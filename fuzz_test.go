@@ -0,0 +1,340 @@
+package chunkers_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"io"
+	"slices"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc4stadia"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fixed"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// The fuzz targets run their seed corpora, in testdata/fuzz, as part of go
+// test. To fuzz for real:
+//
+//	go test -run '^$' -fuzz 'FuzzChunker$' -fuzztime 10m
+//	go test -run '^$' -fuzz FuzzChunkerReader -fuzztime 10m
+//
+// They live here rather than in tests/, whose package builds a 1 GiB input
+// at init, which every fuzzing worker would pay for.
+
+// fuzzKey is the key keyed algorithms are fuzzed with.
+var fuzzKey = bytes.Repeat([]byte{0x5a}, 32)
+
+// fuzzFallback are the algorithms a fuzzer-made name that is not registered
+// stands for. The list is fixed, unlike the registry, so that an input keeps
+// exercising the same algorithm whatever gets registered later.
+var fuzzFallback = []string{"fastcdc-v1.0.0", "kfastcdc", "fastcdc4stadia", "jc-v1.1.0", "ultracdc-v1.0.0", "fixed-v1.0.0"}
+
+// fuzzSetup maps fuzzer-chosen values onto a registered algorithm and a size
+// triple it validates. The algorithm is chosen by name, so that the committed
+// corpus keeps its meaning: a registered name is used as is, and any other
+// picks one of fuzzFallback by its hash. The implementations the tests of
+// this package register are fuzzed along with the built-in ones when named.
+// NormalSize runs from 64 bytes to 8 KiB so that short fuzz inputs still
+// span several chunks; MinSize and MaxSize are NormalSize shifted by up to 3
+// bits, both shifts zero giving the equal triple of fixed-size chunking. It
+// reports false when the algorithm refuses the triple with and without a
+// key, or fails to set up.
+func fuzzSetup(algo string, normal, minShift, maxShift uint8) (string, *chunkers.ChunkerOpts, bool) {
+	name := algo
+	if !slices.Contains(chunkers.Algorithms(), name) {
+		h := fnv.New32a()
+		h.Write([]byte(algo))
+		name = fuzzFallback[h.Sum32()%uint32(len(fuzzFallback))]
+	}
+	n := 64 << (normal % 8)
+	opts, err := keyflag.Resolve(name,
+		&chunkers.ChunkerOpts{MinSize: n >> (minShift % 4), NormalSize: n, MaxSize: n << (maxShift % 4)}, fuzzKey)
+	if err != nil {
+		return name, nil, false
+	}
+	_, err = chunkers.NewChunker(name, bytes.NewReader(nil), opts)
+	return name, opts, err == nil
+}
+
+// fuzzCollect returns the lengths of the chunks of ch and their
+// concatenation, up to the error that stopped it, if any.
+func fuzzCollect(ch *chunkers.Chunker) ([]int, []byte, error) {
+	var lengths []int
+	var all []byte
+	for {
+		chunk, err := ch.Next()
+		if err != nil && err != io.EOF {
+			return lengths, all, err
+		}
+		if len(chunk) != 0 {
+			lengths = append(lengths, len(chunk))
+			all = append(all, chunk...)
+		}
+		if err == io.EOF {
+			return lengths, all, nil
+		}
+	}
+}
+
+// fuzzChunk chunks data through NewChunker over a plain reader, the reference
+// every other path is held to, and checks the chunks reconstruct data and
+// respect the size bounds.
+func fuzzChunk(t *testing.T, algo string, opts *chunkers.ChunkerOpts, data []byte) []int {
+	t.Helper()
+	ch, err := chunkers.NewChunker(algo, bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf(`%s %+v: %s`, algo, opts, err)
+	}
+	lengths, all, err := fuzzCollect(ch)
+	if err != nil {
+		t.Fatalf(`%s: %s`, algo, err)
+	}
+	if !bytes.Equal(all, data) {
+		t.Fatalf(`%s: reconstruction != input (got %d want %d)`, algo, len(all), len(data))
+	}
+	for i, l := range lengths {
+		if l > opts.MaxSize || (l < opts.MinSize && i != len(lengths)-1) {
+			t.Fatalf(`%s %+v: chunk %d of %d has %d bytes`, algo, opts, i, len(lengths), l)
+		}
+	}
+	return lengths
+}
+
+func fuzzSeeds(f *testing.F, add func(data []byte, algo string)) {
+	for _, kind := range []corpus.Kind{corpus.Random, corpus.Text, corpus.ZeroPages} {
+		data, err := corpus.Bytes(kind, 4096, 1)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, algo := range chunkers.Algorithms() {
+			add(data, algo)
+		}
+	}
+	add(nil, "fastcdc-v1.0.0")
+	add([]byte{0x42}, "jc-v1.1.0")
+}
+
+// FuzzChunker holds NewChunkerBuffer, Reset, Copy and Split to the cut
+// points of NewChunker, whatever the buffer size.
+func FuzzChunker(f *testing.F) {
+	fuzzSeeds(f, func(data []byte, algo string) {
+		f.Add(data, algo, uint8(3), uint8(2), uint8(3), uint16(0))
+		f.Add(data, algo, uint8(0), uint8(0), uint8(0), uint16(1))
+	})
+	f.Fuzz(func(t *testing.T, data []byte, algo string, normal, minShift, maxShift uint8, extra uint16) {
+		name, opts, ok := fuzzSetup(algo, normal, minShift, maxShift)
+		if !ok {
+			t.Skip()
+		}
+		want := fuzzChunk(t, name, opts, data)
+
+		for _, size := range []int{opts.MaxSize, opts.MaxSize + int(extra), 3 * opts.MaxSize} {
+			ch, err := chunkers.NewChunkerBuffer(name, bytes.NewReader(data), opts, make([]byte, size))
+			if err != nil {
+				t.Fatalf(`%s: buffer of %d bytes: %s`, name, size, err)
+			}
+			if got, _, err := fuzzCollect(ch); err != nil || !slices.Equal(got, want) {
+				t.Fatalf(`%s: buffer of %d bytes: %v, %v, want %v`, name, size, got, err, want)
+			}
+		}
+
+		ch, err := chunkers.NewChunker(name, bytes.NewReader(data[len(data)/2:]), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := fuzzCollect(ch); err != nil {
+			t.Fatal(err)
+		}
+		ch.Reset(bytes.NewReader(data))
+		if got, _, err := fuzzCollect(ch); err != nil || !slices.Equal(got, want) {
+			t.Fatalf(`%s: after Reset: %v, %v, want %v`, name, got, err, want)
+		}
+
+		var buf bytes.Buffer
+		ch.Reset(bytes.NewReader(data))
+		if n, err := ch.Copy(&buf); n != int64(len(data)) || err != io.EOF || !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf(`%s: Copy: %d bytes, %v`, name, n, err)
+		}
+
+		var got []int
+		ch.Reset(bytes.NewReader(data))
+		err = ch.Split(func(offset, length uint, chunk []byte) error {
+			if sum := sumInts(got); offset != uint(sum) || length != uint(len(chunk)) ||
+				!bytes.Equal(chunk, data[sum:sum+len(chunk)]) {
+				t.Fatalf(`%s: Split: chunk at %d of %d bytes, expected offset %d`, name, offset, length, sum)
+			}
+			if length != 0 {
+				got = append(got, int(length))
+			}
+			return nil
+		})
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf(`%s: Split: %v, %v, want %v`, name, got, err, want)
+		}
+	})
+}
+
+var errFault = errors.New("injected fault")
+
+// faultReader plays data back in reads sized by pattern, cycled: a zero is
+// a (0, nil) read, so long as fewer than 50 come in a row, and any other
+// value reads up to that many bytes. The last bytes come with io.EOF, and
+// with failAt in range it returns errFault, alongside the data, once it has
+// delivered failAt bytes.
+type faultReader struct {
+	data    []byte
+	pattern []byte
+	failAt  int
+	off     int
+	i       int
+	zeros   int
+}
+
+func (fr *faultReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	size := 1
+	if len(fr.pattern) != 0 {
+		size = int(fr.pattern[fr.i%len(fr.pattern)])
+		fr.i++
+	}
+	if size == 0 && fr.zeros < 50 {
+		fr.zeros++
+		return 0, nil
+	}
+	fr.zeros = 0
+	end := min(fr.off+max(size, 1), len(fr.data))
+	if fr.failAt >= 0 {
+		end = min(end, fr.failAt)
+	}
+	n := copy(p, fr.data[fr.off:end])
+	fr.off += n
+	switch {
+	case fr.off == fr.failAt:
+		return n, errFault
+	case fr.off == len(fr.data):
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// FuzzChunkerReader holds NewChunker, NewChunkerBuffer, Reset, Copy and Split
+// to the cut points of NewChunker over a plain reader when the source reads
+// short, reads nothing, returns data together with io.EOF, or fails midway:
+// a failure must surface as the error of Next after a prefix of the chunks,
+// never as a short or corrupt chunk.
+func FuzzChunkerReader(f *testing.F) {
+	fuzzSeeds(f, func(data []byte, algo string) {
+		f.Add(data, algo, uint8(3), uint8(2), uint8(3), []byte{1}, -1)
+		f.Add(data, algo, uint8(1), uint8(1), uint8(1), []byte{0, 200, 0, 0, 7}, -1)
+		f.Add(data, algo, uint8(2), uint8(0), uint8(0), []byte{255}, len(data)/2)
+		f.Add(data, algo, uint8(4), uint8(1), uint8(2), []byte{3, 0}, len(data)/3)
+	})
+	f.Fuzz(func(t *testing.T, data []byte, algo string, normal, minShift, maxShift uint8, pattern []byte, failAt int) {
+		name, opts, ok := fuzzSetup(algo, normal, minShift, maxShift)
+		if !ok {
+			t.Skip()
+		}
+		want := fuzzChunk(t, name, opts, data)
+		if failAt >= len(data) {
+			failAt = -1
+		}
+		source := func() io.Reader {
+			return &faultReader{data: data, pattern: pattern, failAt: failAt}
+		}
+
+		// check holds the chunks a path got before it stopped, and why it
+		// stopped, to the chunks of the plain reader.
+		check := func(what string, got []int, all []byte, err error) {
+			t.Helper()
+			if failAt < 0 {
+				if err != nil || !slices.Equal(got, want) {
+					t.Fatalf(`%s: %s: %v, %v, want %v`, name, what, got, err, want)
+				}
+				return
+			}
+			if err != errFault {
+				t.Fatalf(`%s: %s: failure at %d surfaced as %v`, name, what, failAt, err)
+			}
+			if len(got) > len(want) || !slices.Equal(got, want[:len(got)]) || !bytes.Equal(all, data[:len(all)]) {
+				t.Fatalf(`%s: %s: before the failure at %d: %v, want a prefix of %v`, name, what, failAt, got, want)
+			}
+		}
+
+		ch, err := chunkers.NewChunker(name, source(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, all, err := fuzzCollect(ch)
+		check("NewChunker", got, all, err)
+
+		ch, err = chunkers.NewChunkerBuffer(name, source(), opts, make([]byte, opts.MaxSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, all, err = fuzzCollect(ch)
+		check("NewChunkerBuffer", got, all, err)
+
+		ch, err = chunkers.NewChunker(name, bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := fuzzCollect(ch); err != nil {
+			t.Fatal(err)
+		}
+		ch.Reset(source())
+		got, all, err = fuzzCollect(ch)
+		check("Reset", got, all, err)
+
+		// Copy only tells the bytes: hold them to the chunks by their
+		// number of bytes.
+		var buf bytes.Buffer
+		ch.Reset(source())
+		n, err := ch.Copy(&buf)
+		if err == io.EOF {
+			err = nil
+		}
+		if n != int64(buf.Len()) {
+			t.Fatalf(`%s: Copy: %d bytes, %d written`, name, n, buf.Len())
+		}
+		var whole []int
+		for sum := 0; sum < buf.Len() && len(whole) < len(want); {
+			l := want[len(whole)]
+			whole = append(whole, l)
+			sum += l
+		}
+		if sumInts(whole) != buf.Len() {
+			t.Fatalf(`%s: Copy: %d bytes, not a whole number of chunks of %v`, name, buf.Len(), want)
+		}
+		check("Copy", whole, buf.Bytes(), err)
+
+		got, all = nil, nil
+		ch.Reset(source())
+		err = ch.Split(func(offset, length uint, chunk []byte) error {
+			if offset != uint(len(all)) || length != uint(len(chunk)) {
+				t.Fatalf(`%s: Split: chunk at %d of %d bytes, expected offset %d`, name, offset, length, len(all))
+			}
+			if length != 0 {
+				got = append(got, int(length))
+				all = append(all, chunk...)
+			}
+			return nil
+		})
+		check("Split", got, all, err)
+	})
+}
+
+func sumInts(s []int) int {
+	n := 0
+	for _, v := range s {
+		n += v
+	}
+	return n
+}
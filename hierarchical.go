@@ -0,0 +1,197 @@
+package chunkers
+
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// DigestSize is the size of the chunk digests a HierarchicalChunker computes
+// and feeds to its super-chunk level (SHA-256).
+const DigestSize = sha256.Size
+
+// ErrSuperMaxSize is returned by NewHierarchicalChunker when the super-chunk
+// MaxSize cannot hold a single digest.
+var ErrSuperMaxSize = errors.New("super-chunk MaxSize must be at least DigestSize")
+
+// SuperChunk describes one content-defined group of consecutive chunks. The
+// super-chunk covers [Offset, Offset+Length) of the input and is made of the
+// chunks whose digests are listed in Chunks, in stream order. Digest is the
+// SHA-256 of the concatenated member digests, so two super-chunks with the
+// same Digest cover the same bytes cut the same way.
+type SuperChunk struct {
+	Offset uint
+	Length uint
+	Chunks [][DigestSize]byte
+	Digest [DigestSize]byte
+}
+
+// HierarchicalChunker runs two levels of content-defined chunking. The first
+// level is a regular Chunker over the input bytes. The second level runs
+// another registered algorithm over the stream of first-level digests: every
+// chunk contributes DigestSize bytes to that stream, and a second-level cut
+// ends the super-chunk at the chunk owning the cut byte. Because super-chunk
+// boundaries only depend on chunk digests, they resynchronise after an edit
+// exactly the way chunk boundaries do.
+//
+// The super-chunk options are expressed in bytes of the digest stream, not of
+// the input: with the FastCDC defaults (2K/8K/64K) a super-chunk groups on
+// average 8192/DigestSize = 256 chunks, i.e. ~2 MiB at an 8 KiB average chunk.
+type HierarchicalChunker struct {
+	chunker *Chunker
+
+	superOptions        *ChunkerOpts
+	superImplementation ChunkerImplementation
+
+	// window holds the digest stream not yet assigned to a super-chunk,
+	// pending the matching chunk extents. Both are bounded by the super-chunk
+	// MaxSize.
+	window  []byte
+	pending []uint
+	offset  uint
+}
+
+// NewHierarchicalChunker returns a HierarchicalChunker reading from reader.
+// Chunks are cut with chunkAlgorithm and chunkOpts; super-chunks are cut with
+// superAlgorithm and superOpts over the digest stream. Either options pointer
+// may be nil to use that algorithm's defaults.
+func NewHierarchicalChunker(chunkAlgorithm string, reader io.Reader, chunkOpts *ChunkerOpts, superAlgorithm string, superOpts *ChunkerOpts) (*HierarchicalChunker, error) {
+	chunker, err := NewChunker(chunkAlgorithm, reader, chunkOpts)
+	if err != nil {
+		return nil, err
+	}
+	// newChunker resolves, defaults and sets up the second-level
+	// implementation exactly as it would for a byte stream; we only borrow
+	// its implementation and options and drive Algorithm ourselves.
+	super, err := newChunker(superAlgorithm, superOpts)
+	if err != nil {
+		return nil, err
+	}
+	if super.options.MaxSize < DigestSize {
+		return nil, ErrSuperMaxSize
+	}
+
+	return &HierarchicalChunker{
+		chunker:             chunker,
+		superOptions:        super.options,
+		superImplementation: super.implementation,
+		window:              make([]byte, 0, super.options.MaxSize+DigestSize),
+	}, nil
+}
+
+// Chunker returns the first-level chunker, e.g. to query its sizes.
+func (h *HierarchicalChunker) Chunker() *Chunker {
+	return h.chunker
+}
+
+// Reset rewinds both levels onto a new stream, reusing their buffers.
+func (h *HierarchicalChunker) Reset(reader io.Reader) {
+	h.chunker.Reset(reader)
+	h.window = h.window[:0]
+	h.pending = h.pending[:0]
+	h.offset = 0
+}
+
+// Split reads the whole stream and reports both levels. onChunk is called for
+// every non-empty chunk as soon as it is cut, with its digest; the chunk slice
+// is only valid for the duration of the call, as with Chunker.Split. onSuper
+// is called once all the members of a super-chunk have been reported. Either
+// callback may be nil. An empty input produces no callbacks at all.
+func (h *HierarchicalChunker) Split(onChunk func(offset, length uint, chunk []byte, digest [DigestSize]byte) error, onSuper func(*SuperChunk) error) error {
+	offset := uint(0)
+	eof := false
+	for {
+		// Fill the digest window up to the super-chunk MaxSize so the
+		// second-level algorithm sees the same look-ahead a byte chunker
+		// would.
+		for !eof && len(h.window) < h.superOptions.MaxSize {
+			chunk, err := h.chunker.Next()
+			if err != nil && err != io.EOF {
+				return err
+			}
+			eof = err == io.EOF
+
+			if len(chunk) == 0 {
+				continue
+			}
+			digest := sha256.Sum256(chunk)
+			if onChunk != nil {
+				if err := onChunk(offset, uint(len(chunk)), chunk, digest); err != nil {
+					return err
+				}
+			}
+			h.window = append(h.window, digest[:]...)
+			h.pending = append(h.pending, uint(len(chunk)))
+			offset += uint(len(chunk))
+		}
+
+		if len(h.pending) == 0 {
+			return nil
+		}
+
+		if err := h.cut(onSuper); err != nil {
+			return err
+		}
+	}
+}
+
+// cut picks the next super-chunk boundary in the digest window, reports the
+// super-chunk and drops its members from the window.
+func (h *HierarchicalChunker) cut(onSuper func(*SuperChunk) error) error {
+	n := len(h.window)
+	if n > h.superOptions.MaxSize {
+		n = h.superOptions.MaxSize
+	}
+	cutpoint := h.superImplementation.Algorithm(h.superOptions, h.window, n)
+
+	// A cut inside a digest closes the super-chunk after the chunk owning
+	// that byte, so boundaries always fall on whole chunks. The window only
+	// ever holds whole digests, so rounding up never exceeds it, but it may
+	// exceed a MaxSize that is not a multiple of DigestSize: the super-chunk
+	// then ends on the last whole digest within MaxSize.
+	members := (cutpoint + DigestSize - 1) / DigestSize
+	if members == 0 {
+		members = 1
+	}
+	if limit := h.superOptions.MaxSize / DigestSize; members > limit {
+		members = limit
+	}
+	if members > len(h.pending) {
+		members = len(h.pending)
+	}
+
+	sc := &SuperChunk{
+		Offset: h.offset,
+		Chunks: make([][DigestSize]byte, members),
+	}
+	for i := 0; i < members; i++ {
+		copy(sc.Chunks[i][:], h.window[i*DigestSize:])
+		sc.Length += h.pending[i]
+	}
+	sc.Digest = sha256.Sum256(h.window[:members*DigestSize])
+
+	h.offset += sc.Length
+	h.window = append(h.window[:0], h.window[members*DigestSize:]...)
+	h.pending = append(h.pending[:0], h.pending[members:]...)
+
+	if onSuper != nil {
+		return onSuper(sc)
+	}
+	return nil
+}
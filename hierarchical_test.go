@@ -0,0 +1,183 @@
+package chunkers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// superOpts groups ~32 chunks per super-chunk on average (1024/32), small
+// enough that a few MiB of input yields a meaningful number of super-chunks.
+func superOpts() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: 256, NormalSize: 1024, MaxSize: 4096}
+}
+
+func chunkOpts() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: 2048, NormalSize: 8192, MaxSize: 65536}
+}
+
+func splitHierarchical(t *testing.T, algo, superAlgo string, data []byte) ([][32]byte, []*chunkers.SuperChunk, []byte) {
+	t.Helper()
+	h, err := chunkers.NewHierarchicalChunker(algo, bytes.NewReader(data), chunkOpts(), superAlgo, superOpts())
+	if err != nil {
+		t.Fatalf("NewHierarchicalChunker: %v", err)
+	}
+	var digests [][32]byte
+	var supers []*chunkers.SuperChunk
+	var all []byte
+	err = h.Split(func(offset, length uint, chunk []byte, digest [chunkers.DigestSize]byte) error {
+		if offset != uint(len(all)) || length != uint(len(chunk)) {
+			t.Fatalf("chunk at %d/%d does not follow the previous one (%d)", offset, length, len(all))
+		}
+		if sha256.Sum256(chunk) != digest {
+			t.Fatalf("chunk at %d: digest does not match content", offset)
+		}
+		digests = append(digests, digest)
+		all = append(all, chunk...)
+		return nil
+	}, func(sc *chunkers.SuperChunk) error {
+		supers = append(supers, sc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	return digests, supers, all
+}
+
+// TestHierarchical_Tiling checks that chunks reconstruct the input and that
+// super-chunks tile the stream, each listing exactly the chunks it covers.
+func TestHierarchical_Tiling(t *testing.T) {
+	data := make([]byte, 8<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	digests, supers, all := splitHierarchical(t, "fastcdc-v1.0.0", "fastcdc-v1.0.0", data)
+	if !bytes.Equal(all, data) {
+		t.Fatalf("reconstruction != input")
+	}
+	if len(supers) < 2 {
+		t.Fatalf("expected several super-chunks, got %d", len(supers))
+	}
+
+	next, offset := 0, uint(0)
+	for i, sc := range supers {
+		if sc.Offset != offset {
+			t.Fatalf("super-chunk %d at %d, expected %d", i, sc.Offset, offset)
+		}
+		if len(sc.Chunks)*chunkers.DigestSize > superOpts().MaxSize {
+			t.Fatalf("super-chunk %d has %d members, above MaxSize", i, len(sc.Chunks))
+		}
+		h := sha256.New()
+		for _, d := range sc.Chunks {
+			if d != digests[next] {
+				t.Fatalf("super-chunk %d: member %d out of order", i, next)
+			}
+			h.Write(d[:])
+			next++
+		}
+		if !bytes.Equal(h.Sum(nil), sc.Digest[:]) {
+			t.Fatalf("super-chunk %d: digest does not cover its members", i)
+		}
+		offset += sc.Length
+	}
+	if next != len(digests) || offset != uint(len(data)) {
+		t.Fatalf("super-chunks cover %d chunks/%d bytes, want %d/%d", next, offset, len(digests), len(data))
+	}
+}
+
+// TestHierarchical_Resync checks that super-chunk boundaries are content
+// defined: a one-byte insertion only disturbs the super-chunk around it.
+func TestHierarchical_Resync(t *testing.T) {
+	orig := make([]byte, 8<<20)
+	rand.New(rand.NewSource(2)).Read(orig)
+	pos := len(orig) / 2
+	edited := append(append(append([]byte(nil), orig[:pos]...), 0x42), orig[pos:]...)
+
+	_, a, _ := splitHierarchical(t, "fastcdc-v1.0.0", "fastcdc-v1.0.0", orig)
+	_, b, _ := splitHierarchical(t, "fastcdc-v1.0.0", "fastcdc-v1.0.0", edited)
+
+	seen := make(map[[32]byte]struct{})
+	for _, sc := range a {
+		seen[sc.Digest] = struct{}{}
+	}
+	changed := 0
+	for _, sc := range b {
+		if _, ok := seen[sc.Digest]; !ok {
+			changed++
+		}
+	}
+	// The edited chunk changes its super-chunk, and a shifted second-level
+	// cut may spill into the next one; nothing further should move.
+	if changed > 2 {
+		t.Fatalf("%d of %d super-chunks changed after a 1-byte insertion", changed, len(b))
+	}
+}
+
+// TestHierarchical_MixedAlgorithms checks each level can use its own
+// algorithm, and that the chunk level matches a plain chunker exactly.
+func TestHierarchical_MixedAlgorithms(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	digests, supers, _ := splitHierarchical(t, "jc-v1.1.0", "ultracdc-v1.0.0", data)
+	if len(supers) == 0 {
+		t.Fatal("expected super-chunks")
+	}
+
+	c, err := chunkers.NewChunker("jc-v1.1.0", bytes.NewReader(data), chunkOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := collectHashes(t, c)
+	if !hashesEqual(plain, digests) {
+		t.Fatalf("chunk level differs from a plain jc-v1.1.0 chunker (%d vs %d chunks)", len(digests), len(plain))
+	}
+}
+
+func TestHierarchical_Empty(t *testing.T) {
+	digests, supers, _ := splitHierarchical(t, "fastcdc-v1.0.0", "fastcdc-v1.0.0", nil)
+	if len(digests) != 0 || len(supers) != 0 {
+		t.Fatalf("empty input produced %d chunks and %d super-chunks", len(digests), len(supers))
+	}
+}
+
+func TestHierarchical_UnknownAlgorithm(t *testing.T) {
+	if _, err := chunkers.NewHierarchicalChunker("fastcdc-v1.0.0", bytes.NewReader(nil), nil, "nope", nil); err == nil {
+		t.Fatal("expected unknown super-chunk algorithm error")
+	}
+}
+
+// TestHierarchical_UnalignedMaxSize checks that a super-chunk MaxSize that
+// is not a multiple of DigestSize still bounds the super-chunks: testimpl
+// cuts at 1000 bytes of digests, inside the 32nd digest.
+func TestHierarchical_UnalignedMaxSize(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(4)).Read(data)
+	opts := &chunkers.ChunkerOpts{MinSize: 8, NormalSize: 1000, MaxSize: 1000}
+	h, err := chunkers.NewHierarchicalChunker("fastcdc-v1.0.0", bytes.NewReader(data), chunkOpts(), "testimpl", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supers := 0
+	err = h.Split(nil, func(sc *chunkers.SuperChunk) error {
+		if len(sc.Chunks)*chunkers.DigestSize > opts.MaxSize {
+			t.Fatalf("super-chunk %d has %d members, above MaxSize", supers, len(sc.Chunks))
+		}
+		supers++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if supers < 2 {
+		t.Fatalf("expected several super-chunks, got %d", supers)
+	}
+
+	opts = &chunkers.ChunkerOpts{MinSize: 8, NormalSize: 16, MaxSize: chunkers.DigestSize - 1}
+	if _, err := chunkers.NewHierarchicalChunker("fastcdc-v1.0.0", bytes.NewReader(nil), nil, "testimpl", opts); err != chunkers.ErrSuperMaxSize {
+		t.Fatalf("MaxSize below DigestSize: got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package chunkers
+
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+import "sort"
+
+// BoundaryHints is a source of forced cut offsets for SetBoundaryHints. Next
+// returns the offsets in increasing order and false once there are no more;
+// offsets that do not increase are skipped by the chunker. Next is only
+// called as the chunker reaches the previous hint, so a hint source can be a
+// lazy stream produced alongside the data.
+type BoundaryHints interface {
+	Next() (offset uint64, ok bool)
+}
+
+type offsetHints struct {
+	offsets []uint64
+}
+
+// HintOffsets returns BoundaryHints over a fixed set of offsets, in any order.
+func HintOffsets(offsets ...uint64) BoundaryHints {
+	sorted := append([]uint64(nil), offsets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &offsetHints{offsets: sorted}
+}
+
+func (h *offsetHints) Next() (uint64, bool) {
+	if len(h.offsets) == 0 {
+		return 0, false
+	}
+	offset := h.offsets[0]
+	h.offsets = h.offsets[1:]
+	return offset, true
+}
+
+type channelHints <-chan uint64
+
+// HintChannel returns BoundaryHints reading offsets from ch until it is
+// closed, for hints discovered while the stream is being produced.
+func HintChannel(ch <-chan uint64) BoundaryHints {
+	return channelHints(ch)
+}
+
+func (h channelHints) Next() (uint64, bool) {
+	offset, ok := <-h
+	return offset, ok
+}
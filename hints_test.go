@@ -0,0 +1,207 @@
+package chunkers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+func hintOpts() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: 2048, NormalSize: 8192, MaxSize: 65536}
+}
+
+// collectChunks returns a copy of every chunk of c.
+func collectChunks(t *testing.T, c *chunkers.Chunker) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if len(chunk) != 0 {
+			chunks = append(chunks, append([]byte(nil), chunk...))
+		}
+		if err == io.EOF {
+			return chunks
+		}
+	}
+}
+
+// TestHints_FileEdges concatenates several files into a pack and hints at the
+// file edges: the pack must then chunk exactly like each file on its own.
+func TestHints_FileEdges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var pack []byte
+	var edges []uint64
+	var want [][]byte
+	for _, size := range []int{100, 70000, 3000, 1 << 20, 1, 200000} {
+		file := make([]byte, size)
+		r.Read(file)
+		pack = append(pack, file...)
+		edges = append(edges, uint64(len(pack)))
+
+		c, _ := chunkers.NewChunker("jc-v1.1.0", bytes.NewReader(file), hintOpts())
+		want = append(want, collectChunks(t, c)...)
+	}
+
+	c, err := chunkers.NewChunker("jc-v1.1.0", &oneByteReader{bytes.NewReader(pack)}, hintOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetBoundaryHints(chunkers.HintOffsets(edges...), false)
+	got := collectChunks(t, c)
+	if len(got) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("chunk %d differs from chunking the file alone", i)
+		}
+	}
+}
+
+// TestHints_NeverCrossed checks random hints all end up as cut points, for
+// every algorithm, and the stream still reassembles.
+func TestHints_NeverCrossed(t *testing.T) {
+	data := make([]byte, 2<<20)
+	r := rand.New(rand.NewSource(2))
+	r.Read(data)
+	hints := make([]uint64, 64)
+	for i := range hints {
+		hints[i] = uint64(r.Intn(len(data)))
+	}
+
+	for _, algo := range []string{"fastcdc-v1.0.0", "jc-v1.1.0", "ultracdc-v1.0.0", "kfastcdc"} {
+		opts := hintOpts()
+		opts.Key = make([]byte, 32)
+		c, _ := chunkers.NewChunker(algo, bytes.NewReader(data), opts)
+		c.SetBoundaryHints(chunkers.HintOffsets(hints...), false)
+
+		cuts := make(map[uint64]bool)
+		var all []byte
+		for _, chunk := range collectChunks(t, c) {
+			if len(chunk) > opts.MaxSize {
+				t.Fatalf("%s: chunk of %d bytes above MaxSize", algo, len(chunk))
+			}
+			all = append(all, chunk...)
+			cuts[uint64(len(all))] = true
+		}
+		if !bytes.Equal(all, data) {
+			t.Fatalf("%s: reconstruction != input", algo)
+		}
+		for _, h := range hints {
+			if h != 0 && !cuts[h] {
+				t.Fatalf("%s: no cut at hint %d", algo, h)
+			}
+		}
+	}
+}
+
+// TestHints_MergeSmall checks that with merging, hints placed right after a
+// cut no longer produce chunks below MinSize.
+func TestHints_MergeSmall(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+	opts := hintOpts()
+
+	var hints []uint64
+	for off := uint64(10000); off < uint64(len(data)); off += 10000 {
+		hints = append(hints, off, off+100, off+200)
+	}
+
+	c, _ := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), opts)
+	c.SetBoundaryHints(chunkers.HintOffsets(hints...), true)
+	chunks := collectChunks(t, c)
+
+	var all []byte
+	for i, chunk := range chunks {
+		if i != len(chunks)-1 && len(chunk) < opts.MinSize {
+			t.Fatalf("chunk %d has %d bytes, below MinSize", i, len(chunk))
+		}
+		if len(chunk) > opts.MaxSize {
+			t.Fatalf("chunk %d has %d bytes, above MaxSize", i, len(chunk))
+		}
+		all = append(all, chunk...)
+	}
+	if !bytes.Equal(all, data) {
+		t.Fatal("reconstruction != input")
+	}
+
+	// Without merging, the same hints do produce tiny chunks.
+	c.Reset(bytes.NewReader(data))
+	c.SetBoundaryHints(chunkers.HintOffsets(hints...), false)
+	tiny := 0
+	for _, chunk := range collectChunks(t, c) {
+		if len(chunk) < opts.MinSize {
+			tiny++
+		}
+	}
+	if tiny == 0 {
+		t.Fatal("expected tiny chunks without merging")
+	}
+}
+
+// TestHints_Channel feeds hints from a channel and checks Reset drops them.
+func TestHints_Channel(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	ch := make(chan uint64, 2)
+	ch <- 5000
+	ch <- 6000
+	close(ch)
+
+	c, _ := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), hintOpts())
+	c.SetBoundaryHints(chunkers.HintChannel(ch), false)
+	chunks := collectChunks(t, c)
+	if len(chunks) < 2 || len(chunks[0]) != 5000 || len(chunks[1]) != 1000 {
+		t.Fatalf("hints from channel not honoured: first chunks %d, %d", len(chunks[0]), len(chunks[1]))
+	}
+
+	c.Reset(bytes.NewReader(data))
+	plain, _ := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), hintOpts())
+	a, b := collectChunks(t, c), collectChunks(t, plain)
+	if len(a) != len(b) || sha256.Sum256(a[0]) != sha256.Sum256(b[0]) {
+		t.Fatal("Reset did not drop the boundary hints")
+	}
+}
+
+// TestHints_Trace checks that cuts forced by a hint are traced as such, and
+// only the last chunk as the end of the stream.
+func TestHints_Trace(t *testing.T) {
+	data := make([]byte, 300000)
+	rand.New(rand.NewSource(4)).Read(data)
+	edges := []uint64{5000, 100000, 100100}
+
+	c, err := chunkers.NewChunker("jc-v1.1.0", bytes.NewReader(data), hintOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetBoundaryHints(chunkers.HintOffsets(edges...), false)
+	var cuts []chunkers.Cut
+	c.SetTrace(func(cut chunkers.Cut) { cuts = append(cuts, cut) })
+	collectChunks(t, c)
+
+	hinted := 0
+	for i, cut := range cuts {
+		end := cut.Offset + uint64(cut.Length)
+		atEdge := end == edges[0] || end == edges[1] || end == edges[2]
+		if atEdge != (cut.Reason == chunkers.CutHint) {
+			t.Fatalf("cut %d ending at %d traced as %s", i, end, cut.Reason)
+		}
+		if (cut.Reason == chunkers.CutEndOfStream) != (i == len(cuts)-1) {
+			t.Fatalf("cut %d of %d traced as %s", i, len(cuts), cut.Reason)
+		}
+		if atEdge {
+			hinted++
+		}
+	}
+	if hinted != len(edges) {
+		t.Fatalf("%d hinted cuts, want %d", hinted, len(edges))
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package keyflag gives the command line tools one way to take the key of
+// keyed chunkers, one way to tell which algorithms need it and one way to
+// name it in their reports.
+package keyflag
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/zeebo/blake3"
+)
+
+// Size is the key length BLAKE3 keyed mode needs, and so keyed chunkers.
+const Size = 32
+
+// Register adds -key-file, -key-env and -key-hex to fs. The key is loaded and
+// checked while fs is parsed, so a missing variable, an unreadable file or a
+// key of the wrong length is a usage error; on success it is stored in *key.
+//
+// -key-file holds the raw key bytes and -key-env names a variable holding it
+// hex-encoded. -key-hex takes it on the command line, where it shows in the
+// process list and shell history: it is meant for throwaway test keys.
+func Register(fs *flag.FlagSet, key *[]byte) {
+	set := func(from string, k []byte) error {
+		if *key != nil {
+			return fmt.Errorf("key given more than once")
+		}
+		if err := Check(k); err != nil {
+			return fmt.Errorf("%s: %w", from, err)
+		}
+		*key = k
+		return nil
+	}
+	fs.Func("key-file", "read the raw key of keyed algorithms from this file", func(path string) error {
+		k, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return set(path, k)
+	})
+	fs.Func("key-env", "read the hex-encoded key of keyed algorithms from this environment variable", func(name string) error {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return fmt.Errorf("$%s is not set", name)
+		}
+		k, err := hex.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("$%s: key is not hex: %w", name, err)
+		}
+		return set("$"+name, k)
+	})
+	fs.Func("key-hex", "hex-encoded key of keyed algorithms (visible to other users: prefer -key-file or -key-env)", func(v string) error {
+		k, err := hex.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("key is not hex: %w", err)
+		}
+		return set("-key-hex", k)
+	})
+}
+
+// Check reports whether key has the length keyed chunkers need.
+func Check(key []byte) error {
+	if len(key) != Size {
+		return fmt.Errorf("key is %d bytes, keyed chunkers need %d", len(key), Size)
+	}
+	return nil
+}
+
+// Fingerprint names key in reports without revealing it: the first 8 bytes,
+// hex-encoded, of a BLAKE3 key derivation from it. Two runs with the same
+// fingerprint used the same key. It returns "" for no key.
+func Fingerprint(key []byte) string {
+	if key == nil {
+		return ""
+	}
+	var out [8]byte
+	blake3.DeriveKey("go-cdc-chunkers 2026-10-18 key fingerprint", key, out[:])
+	return hex.EncodeToString(out[:])
+}
+
+// Resolve returns a copy of opts with its zero sizes taken from the defaults
+// of the named algorithm, once its Validate method accepts them. When it
+// refuses them without a key, key is tried in their place, so that tools
+// covering every algorithm give the keyed ones a key without knowing which
+// they are: the Key of the options returned tells. A nil key disables that
+// second try, and the error is always that of opts as given.
+func Resolve(algorithm string, opts *chunkers.ChunkerOpts, key []byte) (*chunkers.ChunkerOpts, error) {
+	impl, err := chunkers.NewImplementation(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	o := *impl.DefaultOptions()
+	if opts != nil {
+		if opts.MinSize != 0 {
+			o.MinSize = opts.MinSize
+		}
+		if opts.NormalSize != 0 {
+			o.NormalSize = opts.NormalSize
+		}
+		if opts.MaxSize != 0 {
+			o.MaxSize = opts.MaxSize
+		}
+		o.Key = opts.Key
+	}
+	err = impl.Validate(&o)
+	if err != nil && o.Key == nil && key != nil {
+		keyed := o
+		keyed.Key = key
+		if impl.Validate(&keyed) == nil {
+			return &keyed, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
@@ -0,0 +1,40 @@
+package keyflag
+
+import (
+	"bytes"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+)
+
+func TestResolve(t *testing.T) {
+	key := make([]byte, Size)
+	o, err := Resolve("kfastcdc", &chunkers.ChunkerOpts{NormalSize: 16 << 10}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o.Key, key) || o.NormalSize != 16<<10 || o.MinSize == 0 || o.MaxSize == 0 {
+		t.Fatalf("kfastcdc resolved to %+v", o)
+	}
+	if _, err := Resolve("kfastcdc", nil, nil); err == nil {
+		t.Fatal("kfastcdc resolved without a key")
+	}
+	o, err = Resolve("fastcdc", nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Key != nil {
+		t.Fatal("fastcdc took the key it does not need")
+	}
+	opts := &chunkers.ChunkerOpts{MinSize: 12 << 10, NormalSize: 48 << 10, MaxSize: 192 << 10}
+	if _, err := Resolve("fastcdc", opts, key); err == nil {
+		t.Fatal("fastcdc resolved a NormalSize that is not a power of two")
+	}
+	if opts.Key != nil {
+		t.Fatal("Resolve changed the options it was given")
+	}
+	if _, err := Resolve("nope-algo", nil, nil); err == nil {
+		t.Fatal("unknown algorithm resolved")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package profile
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MismatchKind is a type of difference between two profiles.
+type MismatchKind string
+
+const (
+	HeaderMismatch  MismatchKind = "header"  // a header field differs
+	MissingChunk    MismatchKind = "missing" // a chunk of want that got does not cut
+	ExtraChunk      MismatchKind = "extra"   // a chunk of got that want does not cut
+	DigestMismatch  MismatchKind = "digest"  // same boundaries, different bytes
+	TrailerMismatch MismatchKind = "trailer" // the size or digest of the input differs
+)
+
+// Mismatch is one difference found by Diff. Chunk is set for the chunk
+// kinds, from want except for ExtraChunk; Field, Want and Got describe
+// header and trailer mismatches, and the two digests of a DigestMismatch.
+type Mismatch struct {
+	Kind  MismatchKind
+	Chunk Chunk
+	Field string
+	Want  string
+	Got   string
+}
+
+func (m Mismatch) String() string {
+	switch m.Kind {
+	case MissingChunk, ExtraChunk:
+		return fmt.Sprintf("%s chunk at offset %d, %d bytes", m.Kind, m.Chunk.Offset, m.Chunk.Length)
+	case DigestMismatch:
+		return fmt.Sprintf("digest of chunk at offset %d, %d bytes: want %s, got %s",
+			m.Chunk.Offset, m.Chunk.Length, m.Want, m.Got)
+	default:
+		return fmt.Sprintf("%s %s: want %s, got %s", m.Kind, m.Field, m.Want, m.Got)
+	}
+}
+
+// Diff compares the profile got against want, passing every difference to
+// fn in offset order, and returns how many it found. Chunks are matched by
+// offset and length: where the boundaries of the two profiles diverge, the
+// chunks of want they no longer share are reported missing and those of got
+// extra, and the comparison picks up again where boundaries agree, so one
+// moved cut point shows as a few chunks rather than the rest of the input.
+// A key fingerprint is only compared when both headers record one. Diff
+// stops at the first error of either source or of fn.
+func Diff(want, got Source, fn func(Mismatch) error) (int, error) {
+	n := 0
+	report := func(m Mismatch) error {
+		n++
+		return fn(m)
+	}
+
+	wh, gh := want.Header(), got.Header()
+	fields := []struct {
+		name      string
+		want, got string
+	}{
+		{"algorithm", wh.Algorithm, gh.Algorithm},
+		{"min_size", strconv.Itoa(wh.MinSize), strconv.Itoa(gh.MinSize)},
+		{"normal_size", strconv.Itoa(wh.NormalSize), strconv.Itoa(gh.NormalSize)},
+		{"max_size", strconv.Itoa(wh.MaxSize), strconv.Itoa(gh.MaxSize)},
+		{"keyed", strconv.FormatBool(wh.Keyed), strconv.FormatBool(gh.Keyed)},
+	}
+	if wh.Key != "" && gh.Key != "" {
+		fields = append(fields, struct{ name, want, got string }{"key_fingerprint", wh.Key, gh.Key})
+	}
+	for _, f := range fields {
+		if f.want != f.got {
+			if err := report(Mismatch{Kind: HeaderMismatch, Field: f.name, Want: f.want, Got: f.got}); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	a, aerr := want.Next()
+	b, berr := got.Next()
+	for aerr == nil || berr == nil {
+		if aerr != nil && aerr != io.EOF {
+			return n, aerr
+		}
+		if berr != nil && berr != io.EOF {
+			return n, berr
+		}
+		var m *Mismatch
+		advanceA, advanceB := false, false
+		switch {
+		case berr == io.EOF || (aerr == nil && a.Offset < b.Offset):
+			m, advanceA = &Mismatch{Kind: MissingChunk, Chunk: a}, true
+		case aerr == io.EOF || b.Offset < a.Offset:
+			m, advanceB = &Mismatch{Kind: ExtraChunk, Chunk: b}, true
+		case a.Length != b.Length:
+			// Same start, different ends: neither chunk is in the other
+			// profile. Report both and move on from each.
+			if err := report(Mismatch{Kind: MissingChunk, Chunk: a}); err != nil {
+				return n, err
+			}
+			m, advanceA, advanceB = &Mismatch{Kind: ExtraChunk, Chunk: b}, true, true
+		default:
+			if a.Digest != b.Digest {
+				m = &Mismatch{Kind: DigestMismatch, Chunk: a,
+					Want: hex.EncodeToString(a.Digest[:]), Got: hex.EncodeToString(b.Digest[:])}
+			}
+			advanceA, advanceB = true, true
+		}
+		if m != nil {
+			if err := report(*m); err != nil {
+				return n, err
+			}
+		}
+		if advanceA {
+			a, aerr = want.Next()
+		}
+		if advanceB {
+			b, berr = got.Next()
+		}
+	}
+	if aerr != io.EOF {
+		return n, aerr
+	}
+	if berr != io.EOF {
+		return n, berr
+	}
+
+	wt, gt := want.Trailer(), got.Trailer()
+	if wt.Size != gt.Size {
+		if err := report(Mismatch{Kind: TrailerMismatch, Field: "size",
+			Want: strconv.FormatInt(wt.Size, 10), Got: strconv.FormatInt(gt.Size, 10)}); err != nil {
+			return n, err
+		}
+	}
+	if wt.Digest != gt.Digest {
+		if err := report(Mismatch{Kind: TrailerMismatch, Field: "digest",
+			Want: hex.EncodeToString(wt.Digest[:]), Got: hex.EncodeToString(gt.Digest[:])}); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
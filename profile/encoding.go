@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format is a profile encoding.
+//
+// JSON is one object per line, as cdc manifests are, so that it diffs and
+// greps well:
+//
+//	{"cdc_profile":1,"algorithm":"fastcdc-v1.0.0","min_size":2048,...}
+//	{"offset":0,"length":8311,"digest":"5e0b..."}
+//	...
+//	{"end":true,"chunks":127,"size":1048576,"digest":"9a41...","duration_ns":5120000}
+//
+// Binary is the same records, about a third of the size: the magic "CDCP",
+// the version and header fields as uvarints and length-prefixed strings,
+// then per chunk its length as a uvarint and its digest, offsets following
+// from the lengths. A zero length starts the trailer: the chunk count, the
+// size, the digest and the duration.
+type Format int
+
+const (
+	JSON Format = iota
+	Binary
+)
+
+const magic = "CDCP"
+
+// Encode writes the profile src in format f and returns its trailer. A
+// Generator source is profiled as it is written.
+func Encode(w io.Writer, f Format, src Source) (Trailer, error) {
+	bw := bufio.NewWriter(w)
+	var enc encoder = &jsonEncoder{enc: json.NewEncoder(bw)}
+	if f == Binary {
+		enc = &binaryEncoder{w: bw}
+	}
+	if err := enc.header(src.Header()); err != nil {
+		return Trailer{}, err
+	}
+	for {
+		c, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Trailer{}, err
+		}
+		if err := enc.chunk(c); err != nil {
+			return Trailer{}, err
+		}
+	}
+	tr := src.Trailer()
+	if err := enc.trailer(tr); err != nil {
+		return Trailer{}, err
+	}
+	return tr, bw.Flush()
+}
+
+type encoder interface {
+	header(Header) error
+	chunk(Chunk) error
+	trailer(Trailer) error
+}
+
+type jsonTrailer struct {
+	End      bool   `json:"end"`
+	Chunks   int64  `json:"chunks"`
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"`
+	Duration int64  `json:"duration_ns"`
+}
+
+// legacyProfile is the single JSON object profiles were before Version 1:
+// the header fields, then every chunk and the file digest in base64.
+type legacyProfile struct {
+	Header
+	Chunks *[]struct {
+		Offset int64
+		Length int
+		Digest []byte
+	} `json:"chunks"`
+	Digest   []byte `json:"digest"`
+	Duration int64  `json:"duration"`
+}
+
+// jsonLine is the union of chunk and trailer lines, for reading.
+type jsonLine struct {
+	Offset   int64  `json:"offset"`
+	Length   int    `json:"length"`
+	Digest   string `json:"digest"`
+	End      bool   `json:"end,omitempty"`
+	Chunks   int64  `json:"chunks,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Duration int64  `json:"duration_ns,omitempty"`
+}
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (je *jsonEncoder) header(h Header) error {
+	h.Version = Version
+	return je.enc.Encode(h)
+}
+
+func (je *jsonEncoder) chunk(c Chunk) error {
+	return je.enc.Encode(jsonLine{Offset: c.Offset, Length: c.Length, Digest: hex.EncodeToString(c.Digest[:])})
+}
+
+func (je *jsonEncoder) trailer(t Trailer) error {
+	return je.enc.Encode(jsonTrailer{End: true, Chunks: t.Chunks, Size: t.Size,
+		Digest: hex.EncodeToString(t.Digest[:]), Duration: int64(t.Duration)})
+}
+
+type binaryEncoder struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func (be *binaryEncoder) flush() error {
+	_, err := be.w.Write(be.buf)
+	be.buf = be.buf[:0]
+	return err
+}
+
+func (be *binaryEncoder) header(h Header) error {
+	be.buf = append(be.buf, magic...)
+	be.buf = binary.AppendUvarint(be.buf, Version)
+	be.buf = appendString(be.buf, h.Algorithm)
+	be.buf = binary.AppendUvarint(be.buf, uint64(h.MinSize))
+	be.buf = binary.AppendUvarint(be.buf, uint64(h.NormalSize))
+	be.buf = binary.AppendUvarint(be.buf, uint64(h.MaxSize))
+	keyed := byte(0)
+	if h.Keyed {
+		keyed = 1
+	}
+	be.buf = append(be.buf, keyed)
+	be.buf = appendString(be.buf, h.Key)
+	return be.flush()
+}
+
+func (be *binaryEncoder) chunk(c Chunk) error {
+	be.buf = binary.AppendUvarint(be.buf, uint64(c.Length))
+	be.buf = append(be.buf, c.Digest[:]...)
+	return be.flush()
+}
+
+func (be *binaryEncoder) trailer(t Trailer) error {
+	be.buf = binary.AppendUvarint(be.buf, 0)
+	be.buf = binary.AppendUvarint(be.buf, uint64(t.Chunks))
+	be.buf = binary.AppendUvarint(be.buf, uint64(t.Size))
+	be.buf = append(be.buf, t.Digest[:]...)
+	be.buf = binary.AppendVarint(be.buf, int64(t.Duration))
+	return be.flush()
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(s))), s...)
+}
+
+// Reader decodes a stored profile in either format. It checks the chunks
+// follow each other and that the trailer totals match them, failing with
+// ErrCorrupt otherwise, and fails with io.ErrUnexpectedEOF on a profile
+// that ends without its trailer.
+//
+// It also reads the profiles written before the schema was versioned, one
+// JSON object holding every chunk, as version 0. Those are held in memory
+// whole, as they always were.
+type Reader struct {
+	format Format
+	hdr    Header
+	tr     Trailer
+	br     *bufio.Reader
+	dec    *json.Decoder
+	legacy []Chunk
+	chunks int64
+	size   int64
+	done   bool
+}
+
+// NewReader reads the header of the profile r and detects its format.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{br: bufio.NewReader(r)}
+	if m, _ := pr.br.Peek(len(magic)); bytes.Equal(m, []byte(magic)) {
+		pr.format = Binary
+		pr.br.Discard(len(magic))
+		if err := pr.readBinaryHeader(); err != nil {
+			return nil, err
+		}
+	} else {
+		pr.dec = json.NewDecoder(pr.br)
+		var lp legacyProfile
+		if err := pr.dec.Decode(&lp); err != nil {
+			return nil, ErrFormat
+		}
+		pr.hdr = lp.Header
+		if pr.hdr.Version == 0 {
+			return pr, pr.readLegacy(&lp)
+		}
+	}
+	if pr.hdr.Version != Version {
+		return nil, fmt.Errorf("%w %d", ErrVersion, pr.hdr.Version)
+	}
+	return pr, nil
+}
+
+// readLegacy takes the chunks and totals of a version 0 profile, for Next
+// to check as it would those of a stream.
+func (pr *Reader) readLegacy(lp *legacyProfile) error {
+	if lp.Chunks == nil {
+		return ErrFormat
+	}
+	pr.legacy = make([]Chunk, 0, len(*lp.Chunks))
+	for i, lc := range *lp.Chunks {
+		if len(lc.Digest) != len(Chunk{}.Digest) {
+			return fmt.Errorf("%w: chunk %d has a digest of %d bytes", ErrCorrupt, i, len(lc.Digest))
+		}
+		c := Chunk{Offset: lc.Offset, Length: lc.Length}
+		copy(c.Digest[:], lc.Digest)
+		pr.legacy = append(pr.legacy, c)
+		pr.tr.Chunks++
+		pr.tr.Size += int64(lc.Length)
+	}
+	if len(lp.Digest) != len(pr.tr.Digest) {
+		return fmt.Errorf("%w: file digest of %d bytes", ErrCorrupt, len(lp.Digest))
+	}
+	copy(pr.tr.Digest[:], lp.Digest)
+	pr.tr.Duration = time.Duration(lp.Duration)
+	return nil
+}
+
+func (pr *Reader) Format() Format { return pr.format }
+
+func (pr *Reader) Header() Header { return pr.hdr }
+
+func (pr *Reader) Trailer() Trailer { return pr.tr }
+
+func (pr *Reader) Next() (Chunk, error) {
+	if pr.done {
+		return Chunk{}, io.EOF
+	}
+	var c Chunk
+	var end bool
+	var err error
+	switch {
+	case pr.legacy != nil:
+		c, end = pr.nextLegacy()
+	case pr.format == Binary:
+		c, end, err = pr.nextBinary()
+	default:
+		c, end, err = pr.nextJSON()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return Chunk{}, fmt.Errorf("chunk %d: %w", pr.chunks, err)
+	}
+	if end {
+		pr.done = true
+		if pr.tr.Chunks != pr.chunks || pr.tr.Size != pr.size {
+			return Chunk{}, fmt.Errorf("%w: trailer counts %d chunks of %d bytes, profile has %d of %d",
+				ErrCorrupt, pr.tr.Chunks, pr.tr.Size, pr.chunks, pr.size)
+		}
+		return Chunk{}, io.EOF
+	}
+	if c.Offset != pr.size || c.Length <= 0 {
+		return Chunk{}, fmt.Errorf("%w: chunk %d at offset %d of %d bytes, expected offset %d",
+			ErrCorrupt, pr.chunks, c.Offset, c.Length, pr.size)
+	}
+	pr.chunks++
+	pr.size += int64(c.Length)
+	return c, nil
+}
+
+func (pr *Reader) nextLegacy() (Chunk, bool) {
+	if pr.chunks == int64(len(pr.legacy)) {
+		return Chunk{}, true
+	}
+	return pr.legacy[pr.chunks], false
+}
+
+func (pr *Reader) nextJSON() (Chunk, bool, error) {
+	var line jsonLine
+	if err := pr.dec.Decode(&line); err != nil {
+		return Chunk{}, false, err
+	}
+	digest, err := hex.DecodeString(line.Digest)
+	if err != nil || len(digest) != len(Chunk{}.Digest) {
+		return Chunk{}, false, fmt.Errorf("%w: bad digest %q", ErrCorrupt, line.Digest)
+	}
+	if line.End {
+		pr.tr = Trailer{Chunks: line.Chunks, Size: line.Size, Duration: time.Duration(line.Duration)}
+		copy(pr.tr.Digest[:], digest)
+		return Chunk{}, true, nil
+	}
+	c := Chunk{Offset: line.Offset, Length: line.Length}
+	copy(c.Digest[:], digest)
+	return c, false, nil
+}
+
+func (pr *Reader) nextBinary() (Chunk, bool, error) {
+	length, err := binary.ReadUvarint(pr.br)
+	if err != nil {
+		return Chunk{}, false, err
+	}
+	if length == 0 {
+		if pr.tr.Chunks, err = pr.readInt(); err != nil {
+			return Chunk{}, false, err
+		}
+		if pr.tr.Size, err = pr.readInt(); err != nil {
+			return Chunk{}, false, err
+		}
+		if _, err := io.ReadFull(pr.br, pr.tr.Digest[:]); err != nil {
+			return Chunk{}, false, err
+		}
+		d, err := binary.ReadVarint(pr.br)
+		pr.tr.Duration = time.Duration(d)
+		return Chunk{}, true, err
+	}
+	if length > 1<<40 {
+		return Chunk{}, false, fmt.Errorf("%w: chunk of %d bytes", ErrCorrupt, length)
+	}
+	c := Chunk{Offset: pr.size, Length: int(length)}
+	_, err = io.ReadFull(pr.br, c.Digest[:])
+	return c, false, err
+}
+
+func (pr *Reader) readBinaryHeader() error {
+	v, err := binary.ReadUvarint(pr.br)
+	if err != nil {
+		return ErrFormat
+	}
+	if v != Version {
+		return fmt.Errorf("%w %d", ErrVersion, v)
+	}
+	pr.hdr.Version = Version
+	if pr.hdr.Algorithm, err = pr.readString(); err != nil {
+		return ErrFormat
+	}
+	var sizes [3]uint64
+	for i := range sizes {
+		if sizes[i], err = binary.ReadUvarint(pr.br); err != nil || sizes[i] > 1<<40 {
+			return ErrFormat
+		}
+	}
+	pr.hdr.MinSize, pr.hdr.NormalSize, pr.hdr.MaxSize = int(sizes[0]), int(sizes[1]), int(sizes[2])
+	keyed, err := pr.br.ReadByte()
+	if err != nil || keyed > 1 {
+		return ErrFormat
+	}
+	pr.hdr.Keyed = keyed == 1
+	if pr.hdr.Key, err = pr.readString(); err != nil {
+		return ErrFormat
+	}
+	return nil
+}
+
+func (pr *Reader) readInt() (int64, error) {
+	v, err := binary.ReadUvarint(pr.br)
+	if err == nil && v > 1<<62 {
+		err = ErrCorrupt
+	}
+	return int64(v), err
+}
+
+func (pr *Reader) readString() (string, error) {
+	n, err := binary.ReadUvarint(pr.br)
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<10 {
+		return "", ErrCorrupt
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(pr.br, b)
+	return string(b), err
+}
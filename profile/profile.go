@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package profile records and checks boundary profiles: the offset, length
+// and SHA-256 of every chunk a chunker cuts from an input, with the
+// algorithm and sizes that cut them. A profile stored with a release pins
+// its boundaries; regenerating it from the same input and diffing the two
+// shows every chunk a later change moved.
+//
+// Profiles are streamed: a Generator profiles an input chunk by chunk, a
+// Reader decodes a stored profile chunk by chunk, and Encode and Diff work
+// on either, so neither side has to hold the chunk list in memory.
+package profile
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// Version is the version of the profile schema, the same in both encodings.
+// A profile of another version is refused rather than misread, except for
+// the unversioned JSON profiles of earlier releases, which Reader reads as
+// version 0.
+const Version = 1
+
+var (
+	ErrFormat  = errors.New("not a cdc profile")
+	ErrVersion = errors.New("unsupported profile version")
+	ErrCorrupt = errors.New("corrupt profile")
+	ErrBounds  = errors.New("chunk size out of bounds")
+)
+
+// Header describes how a profile was cut. The key of a keyed algorithm is
+// never recorded, only its fingerprint.
+type Header struct {
+	Version    int    `json:"cdc_profile"`
+	Algorithm  string `json:"algorithm"`
+	MinSize    int    `json:"min_size"`
+	NormalSize int    `json:"normal_size"`
+	MaxSize    int    `json:"max_size"`
+	Keyed      bool   `json:"keyed,omitempty"`
+	Key        string `json:"key_fingerprint,omitempty"`
+}
+
+// Opts returns the chunker options the header records, with key for a keyed
+// algorithm, to cut the input again.
+func (h Header) Opts(key []byte) *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{MinSize: h.MinSize, NormalSize: h.NormalSize, MaxSize: h.MaxSize, Key: key}
+}
+
+// Chunk is one chunk of the profiled input.
+type Chunk struct {
+	Offset int64
+	Length int
+	Digest [sha256.Size]byte
+}
+
+// Trailer closes a profile with totals over the whole input. Duration, the
+// time the profile took to generate, is informational: Diff ignores it.
+type Trailer struct {
+	Chunks   int64
+	Size     int64
+	Digest   [sha256.Size]byte
+	Duration time.Duration
+}
+
+// Source is a profile being generated or read. Next returns the chunks in
+// order, then io.EOF; Trailer is valid once it has.
+type Source interface {
+	Header() Header
+	Next() (Chunk, error)
+	Trailer() Trailer
+}
+
+// Generator profiles an input as it chunks it.
+type Generator struct {
+	chunker *chunkers.Chunker
+	rd      *countingReader
+	hdr     Header
+	tr      Trailer
+	file    hash.Hash
+	start   time.Time
+	done    bool
+}
+
+// NewGenerator returns a Generator cutting rd with the named algorithm.
+func NewGenerator(rd io.Reader, algorithm string, opts *chunkers.ChunkerOpts) (*Generator, error) {
+	cr := &countingReader{r: rd}
+	chunker, err := chunkers.NewChunker(algorithm, cr, opts)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{chunker: chunker, rd: cr, file: sha256.New(), start: time.Now()}
+	g.hdr = Header{
+		Version:    Version,
+		Algorithm:  algorithm,
+		MinSize:    chunker.MinSize(),
+		NormalSize: chunker.NormalSize(),
+		MaxSize:    chunker.MaxSize(),
+	}
+	if opts != nil && opts.Key != nil {
+		g.hdr.Keyed, g.hdr.Key = true, keyflag.Fingerprint(opts.Key)
+	}
+	return g, nil
+}
+
+func (g *Generator) Header() Header { return g.hdr }
+
+func (g *Generator) Trailer() Trailer { return g.tr }
+
+// Next returns the next chunk. A chunk larger than MaxSize, or one below
+// MinSize anywhere but at the end of the input, fails with ErrBounds.
+func (g *Generator) Next() (Chunk, error) {
+	for !g.done {
+		data, err := g.chunker.Next()
+		if err != nil && err != io.EOF {
+			return Chunk{}, err
+		}
+		g.done = err == io.EOF
+		if len(data) > g.hdr.MaxSize {
+			return Chunk{}, fmt.Errorf("%w: chunk %d at offset %d is %d bytes, above MaxSize %d",
+				ErrBounds, g.tr.Chunks, g.tr.Size, len(data), g.hdr.MaxSize)
+		}
+		if g.done {
+			if err := g.finish(len(data)); err != nil {
+				return Chunk{}, err
+			}
+		} else if len(data) < g.hdr.MinSize {
+			return Chunk{}, fmt.Errorf("%w: chunk %d at offset %d is %d bytes, below MinSize %d",
+				ErrBounds, g.tr.Chunks, g.tr.Size, len(data), g.hdr.MinSize)
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		c := Chunk{Offset: g.tr.Size, Length: len(data), Digest: sha256.Sum256(data)}
+		g.file.Write(data)
+		g.tr.Chunks++
+		g.tr.Size += int64(len(data))
+		if g.done {
+			g.close()
+		}
+		return c, nil
+	}
+	return Chunk{}, io.EOF
+}
+
+// finish checks the last chunk, of n bytes, really ends the input: the
+// chunker also stops at any chunk below MinSize, which an algorithm cutting
+// too early would return with the rest of the input still unread.
+func (g *Generator) finish(n int) error {
+	var one [1]byte
+	extra, _ := io.ReadFull(g.rd, one[:])
+	if end := g.tr.Size + int64(n); extra != 0 || g.rd.n != end {
+		return fmt.Errorf("%w: chunk %d at offset %d is %d bytes, below MinSize %d, with input left after it",
+			ErrBounds, g.tr.Chunks, g.tr.Size, n, g.hdr.MinSize)
+	}
+	if n == 0 {
+		g.close()
+	}
+	return nil
+}
+
+func (g *Generator) close() {
+	copy(g.tr.Digest[:], g.file.Sum(nil))
+	g.tr.Duration = time.Since(g.start)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
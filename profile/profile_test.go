@@ -0,0 +1,291 @@
+package profile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
+	"github.com/PlakarKorp/go-cdc-chunkers/profile"
+)
+
+var opts = chunkers.ChunkerOpts{MinSize: 2 << 10, NormalSize: 8 << 10, MaxSize: 64 << 10}
+
+func generator(t *testing.T, data []byte, algorithm string) *profile.Generator {
+	t.Helper()
+	o := opts
+	g, err := profile.NewGenerator(bytes.NewReader(data), algorithm, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func encode(t *testing.T, data []byte, algorithm string, f profile.Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := profile.Encode(&buf, f, generator(t, data, algorithm)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func reader(t *testing.T, enc []byte) *profile.Reader {
+	t.Helper()
+	pr, err := profile.NewReader(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pr
+}
+
+func collect(t *testing.T, src profile.Source) []profile.Chunk {
+	t.Helper()
+	var out []profile.Chunk
+	for {
+		c, err := src.Next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, c)
+	}
+}
+
+func diff(t *testing.T, want, got profile.Source) []profile.Mismatch {
+	t.Helper()
+	var ms []profile.Mismatch
+	n, err := profile.Diff(want, got, func(m profile.Mismatch) error {
+		ms = append(ms, m)
+		return nil
+	})
+	if err != nil || n != len(ms) {
+		t.Fatalf("Diff: %d mismatches, %d reported: %v", n, len(ms), err)
+	}
+	return ms
+}
+
+func TestRoundTrip(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Text, 1<<20, 1)
+	g := generator(t, data, "fastcdc-v1.0.0")
+	want := collect(t, g)
+	if tr := g.Trailer(); tr.Size != int64(len(data)) || tr.Chunks != int64(len(want)) {
+		t.Fatalf("trailer %+v for %d chunks of %d bytes", tr, len(want), len(data))
+	}
+
+	jsonEnc := encode(t, data, "fastcdc-v1.0.0", profile.JSON)
+	binEnc := encode(t, data, "fastcdc-v1.0.0", profile.Binary)
+	if 2*len(binEnc) > len(jsonEnc) {
+		t.Fatalf("binary profile is %d bytes, JSON %d", len(binEnc), len(jsonEnc))
+	}
+	for _, enc := range [][]byte{jsonEnc, binEnc} {
+		pr := reader(t, enc)
+		if h := pr.Header(); h.Algorithm != "fastcdc-v1.0.0" || h.MinSize != opts.MinSize || h.Version != profile.Version {
+			t.Fatalf("header %+v", h)
+		}
+		got := collect(t, pr)
+		if len(got) != len(want) {
+			t.Fatalf("%d chunks read back, %d generated", len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("chunk %d: %+v, generated %+v", i, got[i], want[i])
+			}
+		}
+		if pr.Trailer().Digest != g.Trailer().Digest {
+			t.Fatal("trailer digest differs")
+		}
+	}
+
+	// A stored profile checks against a fresh run, whatever its encoding.
+	if ms := diff(t, reader(t, jsonEnc), generator(t, data, "fastcdc-v1.0.0")); len(ms) != 0 {
+		t.Fatalf("identical profiles: %v", ms)
+	}
+	if ms := diff(t, reader(t, jsonEnc), reader(t, binEnc)); len(ms) != 0 {
+		t.Fatalf("JSON and binary profiles: %v", ms)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 1<<20, 1)
+	stored := encode(t, data, "fastcdc-v1.0.0", profile.Binary)
+
+	edited := bytes.Clone(data)
+	edited[500000] ^= 0xff
+	ms := diff(t, reader(t, stored), generator(t, edited, "fastcdc-v1.0.0"))
+	kinds := make(map[profile.MismatchKind]int)
+	for _, m := range ms {
+		kinds[m.Kind]++
+		if m.Kind != profile.TrailerMismatch && (m.Chunk.Offset > 500000 || m.Chunk.Offset+int64(m.Chunk.Length) <= 500000-64<<10) {
+			t.Fatalf("%s far from the edit", m)
+		}
+	}
+	// A flipped byte changes the chunk holding it, and maybe its cut point.
+	if kinds[profile.TrailerMismatch] != 1 || kinds[profile.DigestMismatch]+kinds[profile.MissingChunk] == 0 ||
+		kinds[profile.MissingChunk] > 3 || kinds[profile.ExtraChunk] > 3 {
+		t.Fatalf("mismatches %v", ms)
+	}
+
+	// Another algorithm: the header and every boundary differ, and all of
+	// it is reported.
+	ms = diff(t, reader(t, stored), generator(t, data, "jc-v1.0.0"))
+	if ms[0].Kind != profile.HeaderMismatch || ms[0].Field != "algorithm" {
+		t.Fatalf("first mismatch %s", ms[0])
+	}
+	var missing, extra int
+	for _, m := range ms {
+		switch m.Kind {
+		case profile.MissingChunk:
+			missing++
+		case profile.ExtraChunk:
+			extra++
+		}
+	}
+	if missing < 50 || extra < 50 {
+		t.Fatalf("%d missing and %d extra chunks", missing, extra)
+	}
+
+	stop := errors.New("stop")
+	if n, err := profile.Diff(reader(t, stored), generator(t, edited, "fastcdc-v1.0.0"),
+		func(profile.Mismatch) error { return stop }); n != 1 || err != stop {
+		t.Fatalf("Diff went on after fn failed: %d, %v", n, err)
+	}
+}
+
+// short cuts every chunk at half MinSize, which the Chunker takes for the
+// end of the input.
+type short struct{}
+
+func (short) DefaultOptions() *chunkers.ChunkerOpts { return &opts }
+func (short) Setup(*chunkers.ChunkerOpts) error     { return nil }
+func (short) Validate(*chunkers.ChunkerOpts) error  { return nil }
+func (short) Algorithm(o *chunkers.ChunkerOpts, data []byte, n int) int {
+	return min(n, o.MinSize/2)
+}
+
+// NewGenerator looks algorithms up by name: register short once, rather than
+// in a test that may run more than once.
+func init() {
+	_ = chunkers.Register("profile-test-short", func() chunkers.ChunkerImplementation { return short{} })
+}
+
+func TestBounds(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 100000, 1)
+	_, err := profile.Encode(io.Discard, profile.JSON, generator(t, data, "profile-test-short"))
+	if !errors.Is(err, profile.ErrBounds) {
+		t.Fatalf("a chunk below MinSize was accepted: %v", err)
+	}
+	// At the very end of the input a short chunk is expected.
+	if _, err := profile.Encode(io.Discard, profile.JSON, generator(t, data[:500], "profile-test-short")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 200000, 1)
+	for _, f := range []profile.Format{profile.JSON, profile.Binary} {
+		enc := encode(t, data, "fastcdc-v1.0.0", f)
+		err := drain(reader(t, enc[:len(enc)-40]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("format %d: truncated profile: %v", f, err)
+		}
+	}
+
+	jsonEnc := string(encode(t, data, "fastcdc-v1.0.0", profile.JSON))
+	for _, tc := range []struct {
+		profile string
+		err     error
+	}{
+		{"", profile.ErrFormat},
+		{"not a profile", profile.ErrFormat},
+		{`{"algorithm":"fastcdc-v1.0.0"}`, profile.ErrFormat},
+		{strings.Replace(jsonEnc, `"cdc_profile":1`, `"cdc_profile":2`, 1), profile.ErrVersion},
+		{"CDCP\x02", profile.ErrVersion},
+	} {
+		if _, err := profile.NewReader(strings.NewReader(tc.profile)); !errors.Is(err, tc.err) {
+			t.Fatalf("%.30q: %v, want %v", tc.profile, err, tc.err)
+		}
+	}
+
+	lines := strings.SplitAfter(jsonEnc, "\n")
+	dropped := strings.Join(append(lines[:2:2], lines[3:]...), "")
+	if err := drain(reader(t, []byte(dropped))); !errors.Is(err, profile.ErrCorrupt) {
+		t.Fatalf("profile missing a chunk: %v", err)
+	}
+}
+
+func drain(src profile.Source) error {
+	for {
+		if _, err := src.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// legacyProfile is the profile cdcprofile wrote before the schema was
+// versioned.
+type legacyProfile struct {
+	Algorithm  string `json:"algorithm"`
+	Keyed      bool   `json:"keyed"`
+	Key        string `json:"key_fingerprint,omitempty"`
+	MinSize    int    `json:"min_size"`
+	NormalSize int    `json:"normal_size"`
+	MaxSize    int    `json:"max_size"`
+	Chunks     []struct {
+		Offset int
+		Length int
+		Digest []byte
+	} `json:"chunks"`
+	Digest   []byte        `json:"digest"`
+	Duration time.Duration `json:"duration"`
+}
+
+func TestLegacy(t *testing.T) {
+	data, _ := corpus.Bytes(corpus.Random, 300000, 1)
+	g := generator(t, data, "fastcdc-v1.0.0")
+	chunks := collect(t, g)
+	h, tr := g.Header(), g.Trailer()
+	lp := legacyProfile{Algorithm: h.Algorithm, MinSize: h.MinSize, NormalSize: h.NormalSize, MaxSize: h.MaxSize,
+		Digest: tr.Digest[:], Duration: tr.Duration}
+	for _, c := range chunks {
+		lp.Chunks = append(lp.Chunks, struct {
+			Offset int
+			Length int
+			Digest []byte
+		}{int(c.Offset), c.Length, bytes.Clone(c.Digest[:])})
+	}
+	enc, _ := json.Marshal(lp)
+
+	pr := reader(t, enc)
+	if v := pr.Header().Version; v != 0 {
+		t.Fatalf("legacy profile read as version %d", v)
+	}
+	if ms := diff(t, pr, generator(t, data, "fastcdc-v1.0.0")); len(ms) != 0 {
+		t.Fatalf("legacy profile differs from its input: %v", ms)
+	}
+	if pr.Trailer() != tr {
+		t.Fatalf("trailer %+v, want %+v", pr.Trailer(), tr)
+	}
+
+	lp.Chunks[1].Offset++
+	enc, _ = json.Marshal(lp)
+	if err := drain(reader(t, enc)); !errors.Is(err, profile.ErrCorrupt) {
+		t.Fatalf("legacy profile with a moved chunk: %v", err)
+	}
+	lp.Chunks[1].Digest = lp.Chunks[1].Digest[:8]
+	enc, _ = json.Marshal(lp)
+	if _, err := profile.NewReader(bytes.NewReader(enc)); !errors.Is(err, profile.ErrCorrupt) {
+		t.Fatalf("legacy profile with a short digest: %v", err)
+	}
+}
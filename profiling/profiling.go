@@ -6,20 +6,20 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"os"
 	"runtime/pprof"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
 )
 
 const (
 	datalen = 128 << 22
 )
 
-var rb, _ = io.ReadAll(io.LimitReader(rand.New(rand.NewSource(0)), datalen))
+var rb, _ = corpus.Bytes(corpus.Random, datalen, 0)
 
 // build then: go tool pprof -http=localhost:6060 cpu.prof
 func main() {
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package prolly
+
+// Range is a byte range of one version of the input.
+type Range struct {
+	Offset uint64
+	Length uint64
+}
+
+// Changes is the result of Diff: the byte ranges of the old version that the
+// new one no longer shares, and the byte ranges of the new version that the
+// old one did not have. Adjacent ranges are merged.
+type Changes struct {
+	Removed []Range
+	Added   []Range
+}
+
+// AddedBytes is the number of bytes that would have to be transferred to turn
+// the old version into the new one.
+func (c *Changes) AddedBytes() uint64 {
+	return sumRanges(c.Added)
+}
+
+// RemovedBytes is the number of bytes of the old version that are gone.
+func (c *Changes) RemovedBytes() uint64 {
+	return sumRanges(c.Removed)
+}
+
+func sumRanges(ranges []Range) uint64 {
+	var n uint64
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return n
+}
+
+// item is a position in a tree walk: a node of the given level, or a chunk
+// when level is chunkLevel, covering [offset, offset+length).
+type item struct {
+	digest [DigestSize]byte
+	level  int
+	offset uint64
+	length uint64
+}
+
+const chunkLevel = -1
+
+// Diff compares two trees stored in store. It walks both trees one level at a
+// time, dropping every entry whose digest appears in the other tree at the
+// same level: that whole subtree is shared and never read. Only the
+// remaining, differing entries are expanded, so the number of nodes read is
+// proportional to the number of changes times the tree height.
+//
+// Sharing is decided per digest, not per position, so content that moved
+// within the file is still recognised as shared.
+func Diff(store Store, a, b Root) (*Changes, error) {
+	as, bs := frontier(a), frontier(b)
+
+	for len(as) != 0 || len(bs) != 0 {
+		la, lb := frontierLevel(as), frontierLevel(bs)
+
+		// Bring the taller tree down to the level of the other one first:
+		// digests can only match between entries of the same level.
+		if la != lb {
+			var err error
+			if la > lb {
+				as, err = expand(store, as)
+			} else {
+				bs, err = expand(store, bs)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		as, bs = prune(as, bs)
+		if la == chunkLevel {
+			break
+		}
+
+		var err error
+		if as, err = expand(store, as); err != nil {
+			return nil, err
+		}
+		if bs, err = expand(store, bs); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Changes{Removed: ranges(as), Added: ranges(bs)}, nil
+}
+
+func frontier(r Root) []item {
+	if r.IsEmpty() {
+		return nil
+	}
+	return []item{{digest: r.Digest, level: r.Level, length: r.Length}}
+}
+
+// frontierLevel returns the level of a frontier. Every item of a frontier is
+// at the same level since whole frontiers are expanded at once; an empty
+// frontier matches whatever level the other side is at.
+func frontierLevel(items []item) int {
+	if len(items) == 0 {
+		return chunkLevel
+	}
+	return items[0].level
+}
+
+// prune drops the items present on both sides.
+func prune(as, bs []item) ([]item, []item) {
+	inA := make(map[[DigestSize]byte]struct{}, len(as))
+	for _, it := range as {
+		inA[it.digest] = struct{}{}
+	}
+	inB := make(map[[DigestSize]byte]struct{}, len(bs))
+	for _, it := range bs {
+		inB[it.digest] = struct{}{}
+	}
+
+	keep := func(items []item, other map[[DigestSize]byte]struct{}) []item {
+		out := items[:0]
+		for _, it := range items {
+			if _, ok := other[it.digest]; !ok {
+				out = append(out, it)
+			}
+		}
+		return out
+	}
+	return keep(as, inB), keep(bs, inA)
+}
+
+// expand replaces every node of a frontier with its entries, one level down.
+func expand(store Store, items []item) ([]item, error) {
+	var out []item
+	for _, it := range items {
+		node, err := readNode(store, it.digest)
+		if err != nil {
+			return nil, err
+		}
+		childLevel := node.Level - 1
+		if node.Level == 0 {
+			childLevel = chunkLevel
+		}
+		offset := it.offset
+		for _, e := range node.Entries {
+			out = append(out, item{digest: e.Digest, level: childLevel, offset: offset, length: e.Length})
+			offset += e.Length
+		}
+	}
+	return out, nil
+}
+
+// ranges turns a frontier of chunks, in stream order, into merged ranges.
+func ranges(items []item) []Range {
+	var out []Range
+	for _, it := range items {
+		if n := len(out); n != 0 && out[n-1].Offset+out[n-1].Length == it.offset {
+			out[n-1].Length += it.length
+			continue
+		}
+		out = append(out, Range{Offset: it.offset, Length: it.length})
+	}
+	return out
+}
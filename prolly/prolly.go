@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package prolly builds a content-defined Merkle tree (a "prolly tree") over
+// the chunk stream produced by a Chunker. Leaves are chunk digests; a node
+// ends after an entry whose digest matches the fanout mask, so node
+// boundaries are content defined at every level and two versions of a file
+// share every subtree the edits did not touch. Diff walks two trees top-down
+// and only descends into subtrees whose digests differ, which makes comparing
+// two huge versions cost O(changes) instead of O(size).
+package prolly
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// DigestSize is the size of chunk and node digests (SHA-256).
+const DigestSize = sha256.Size
+
+// DefaultFanout is the average number of entries per node when NewBuilder is
+// given a zero fanout.
+const DefaultFanout = 64
+
+// maxFanoutFactor caps a node at maxFanoutFactor*fanout entries, so a run of
+// digests that never match the mask cannot grow a node without bound.
+const maxFanoutFactor = 4
+
+// nodeVersion is the first byte of every encoded node.
+const nodeVersion = 1
+
+var ErrFanout = errors.New("fanout must be a power of two >= 2")
+var ErrNotFound = errors.New("node not found in store")
+var ErrCorruptNode = errors.New("corrupt tree node")
+
+// Store is where tree nodes are written and read back, keyed by the SHA-256
+// of their encoding. It is meant to be the same content-addressed store the
+// chunks themselves live in.
+type Store interface {
+	Put(digest [DigestSize]byte, data []byte) error
+	Get(digest [DigestSize]byte) ([]byte, error)
+}
+
+// MemoryStore is an in-memory Store, mostly useful for tests.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	nodes map[[DigestSize]byte][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nodes: make(map[[DigestSize]byte][]byte)}
+}
+
+func (s *MemoryStore) Put(digest [DigestSize]byte, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[digest] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryStore) Get(digest [DigestSize]byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.nodes[digest]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Len returns the number of distinct nodes stored.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.nodes)
+}
+
+// Entry references either a chunk (in a level 0 node) or a child node (in a
+// node of level > 0), along with the number of input bytes it covers.
+type Entry struct {
+	Digest [DigestSize]byte
+	Length uint64
+}
+
+// Node is one tree node. Level 0 nodes list chunks; level n nodes list nodes
+// of level n-1.
+type Node struct {
+	Level   int
+	Entries []Entry
+}
+
+// Length returns the number of input bytes covered by the node.
+func (n *Node) Length() uint64 {
+	var length uint64
+	for _, e := range n.Entries {
+		length += e.Length
+	}
+	return length
+}
+
+// MarshalBinary encodes the node as: version byte, uvarint level, uvarint
+// entry count, then for each entry its digest and uvarint length.
+func (n *Node) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(n.Entries)*(DigestSize+binary.MaxVarintLen64))
+	buf = append(buf, nodeVersion)
+	buf = binary.AppendUvarint(buf, uint64(n.Level))
+	buf = binary.AppendUvarint(buf, uint64(len(n.Entries)))
+	for _, e := range n.Entries {
+		buf = append(buf, e.Digest[:]...)
+		buf = binary.AppendUvarint(buf, e.Length)
+	}
+	return buf, nil
+}
+
+func (n *Node) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != nodeVersion {
+		return ErrCorruptNode
+	}
+	data = data[1:]
+
+	level, k := binary.Uvarint(data)
+	if k <= 0 {
+		return ErrCorruptNode
+	}
+	data = data[k:]
+	count, k := binary.Uvarint(data)
+	if k <= 0 || count > uint64(len(data))/DigestSize {
+		return ErrCorruptNode
+	}
+	data = data[k:]
+
+	n.Level = int(level)
+	n.Entries = make([]Entry, count)
+	for i := range n.Entries {
+		if len(data) < DigestSize {
+			return ErrCorruptNode
+		}
+		copy(n.Entries[i].Digest[:], data)
+		data = data[DigestSize:]
+		length, k := binary.Uvarint(data)
+		if k <= 0 {
+			return ErrCorruptNode
+		}
+		n.Entries[i].Length = length
+		data = data[k:]
+	}
+	if len(data) != 0 {
+		return ErrCorruptNode
+	}
+	return nil
+}
+
+// Root identifies a tree: the digest and level of its top node and the total
+// number of bytes it covers. The zero Root is the empty tree.
+type Root struct {
+	Digest [DigestSize]byte
+	Level  int
+	Length uint64
+}
+
+func (r Root) IsEmpty() bool {
+	return r.Length == 0 && r.Digest == [DigestSize]byte{}
+}
+
+// readNode fetches and decodes a node.
+func readNode(store Store, digest [DigestSize]byte) (*Node, error) {
+	data, err := store.Get(digest)
+	if err != nil {
+		return nil, fmt.Errorf("%x: %w", digest, err)
+	}
+	if sha256.Sum256(data) != digest {
+		return nil, fmt.Errorf("%x: %w", digest, ErrCorruptNode)
+	}
+	node := &Node{}
+	if err := node.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%x: %w", digest, err)
+	}
+	return node, nil
+}
+
+// level is the builder state of one tree level: the entries of the node
+// currently being filled and how many nodes it already closed.
+type level struct {
+	entries []Entry
+	closed  int
+}
+
+// Builder builds a tree incrementally from a stream of chunk digests, writing
+// every node to the store as soon as it closes. Memory is bounded by the tree
+// height times the maximum node size.
+type Builder struct {
+	store  Store
+	mask   uint64
+	max    int
+	levels []*level
+	err    error
+}
+
+// NewBuilder returns a Builder writing nodes to store. fanout is the average
+// number of entries per node and must be a power of two; 0 selects
+// DefaultFanout.
+func NewBuilder(store Store, fanout int) (*Builder, error) {
+	if fanout == 0 {
+		fanout = DefaultFanout
+	}
+	if fanout < 2 || fanout&(fanout-1) != 0 {
+		return nil, ErrFanout
+	}
+	return &Builder{
+		store: store,
+		mask:  uint64(fanout - 1),
+		max:   fanout * maxFanoutFactor,
+	}, nil
+}
+
+// isBoundary reports whether a node ends after the entry with this digest.
+// Digests are uniformly distributed, so their low bits serve directly as the
+// content-defined fingerprint.
+func (b *Builder) isBoundary(digest [DigestSize]byte) bool {
+	return binary.LittleEndian.Uint64(digest[DigestSize-8:])&b.mask == 0
+}
+
+// Add appends one chunk to the tree.
+func (b *Builder) Add(digest [DigestSize]byte, length uint64) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.err = b.add(0, Entry{Digest: digest, Length: length})
+	return b.err
+}
+
+func (b *Builder) add(l int, e Entry) error {
+	if l == len(b.levels) {
+		b.levels = append(b.levels, &level{})
+	}
+	lv := b.levels[l]
+	lv.entries = append(lv.entries, e)
+	if b.isBoundary(e.Digest) || len(lv.entries) >= b.max {
+		return b.close(l)
+	}
+	return nil
+}
+
+// close writes the pending node of level l and adds it to level l+1.
+func (b *Builder) close(l int) error {
+	lv := b.levels[l]
+	node := &Node{Level: l, Entries: lv.entries}
+	digest, err := b.put(node)
+	if err != nil {
+		return err
+	}
+	length := node.Length()
+	lv.entries = lv.entries[:0]
+	lv.closed++
+	return b.add(l+1, Entry{Digest: digest, Length: length})
+}
+
+func (b *Builder) put(node *Node) ([DigestSize]byte, error) {
+	data, err := node.MarshalBinary()
+	if err != nil {
+		return [DigestSize]byte{}, err
+	}
+	digest := sha256.Sum256(data)
+	return digest, b.store.Put(digest, data)
+}
+
+// Finish closes every pending node and returns the root of the tree. The
+// Builder must not be used afterwards.
+func (b *Builder) Finish() (Root, error) {
+	if b.err != nil {
+		return Root{}, b.err
+	}
+	for l := 0; l < len(b.levels); l++ {
+		lv := b.levels[l]
+		// A level that never closed a node and holds a single entry is the
+		// top of the tree: that entry is the root node. Level 0 entries are
+		// chunks, not nodes, so they always get wrapped in a node.
+		if l > 0 && lv.closed == 0 && len(lv.entries) == 1 {
+			return Root{Digest: lv.entries[0].Digest, Level: l - 1, Length: lv.entries[0].Length}, nil
+		}
+		if len(lv.entries) != 0 {
+			if err := b.close(l); err != nil {
+				b.err = err
+				return Root{}, err
+			}
+		}
+	}
+	return Root{}, nil
+}
+
+// Build chunks the chunker's stream with Split and returns the root of the
+// tree built over the chunk digests. Only tree nodes are written to the store;
+// callers that also want the chunks stored can use a Builder directly.
+func Build(chunker *chunkers.Chunker, store Store, fanout int) (Root, error) {
+	b, err := NewBuilder(store, fanout)
+	if err != nil {
+		return Root{}, err
+	}
+	err = chunker.Split(func(offset, length uint, chunk []byte) error {
+		if length == 0 {
+			return nil
+		}
+		return b.Add(sha256.Sum256(chunk), uint64(length))
+	})
+	if err != nil {
+		return Root{}, err
+	}
+	return b.Finish()
+}
+
+// Leaves calls fn for every chunk of the tree, in stream order.
+func Leaves(store Store, root Root, fn func(offset, length uint64, digest [DigestSize]byte) error) error {
+	if root.IsEmpty() {
+		return nil
+	}
+	_, err := leaves(store, root.Digest, 0, fn)
+	return err
+}
+
+func leaves(store Store, digest [DigestSize]byte, offset uint64, fn func(offset, length uint64, digest [DigestSize]byte) error) (uint64, error) {
+	node, err := readNode(store, digest)
+	if err != nil {
+		return offset, err
+	}
+	for _, e := range node.Entries {
+		if node.Level == 0 {
+			if err := fn(offset, e.Length, e.Digest); err != nil {
+				return offset, err
+			}
+			offset += e.Length
+			continue
+		}
+		if offset, err = leaves(store, e.Digest, offset, fn); err != nil {
+			return offset, err
+		}
+	}
+	return offset, nil
+}
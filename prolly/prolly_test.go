@@ -0,0 +1,180 @@
+package prolly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fastcdc"
+)
+
+const testFanout = 8
+
+func randomData(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func build(t *testing.T, store Store, data []byte) Root {
+	t.Helper()
+	c, err := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Build(c, store, testFanout)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return root
+}
+
+// TestLeavesMatchChunker checks the tree lists exactly the chunks the chunker
+// produced, in order, and covers the whole input.
+func TestLeavesMatchChunker(t *testing.T) {
+	data := randomData(1, 8<<20)
+	store := NewMemoryStore()
+	root := build(t, store, data)
+	if root.Length != uint64(len(data)) {
+		t.Fatalf("root covers %d bytes, want %d", root.Length, len(data))
+	}
+	if root.Level < 1 {
+		t.Fatalf("expected a multi-level tree, got root level %d", root.Level)
+	}
+
+	c, _ := chunkers.NewChunker("fastcdc-v1.0.0", bytes.NewReader(data), nil)
+	var want [][DigestSize]byte
+	c.Split(func(_, length uint, chunk []byte) error {
+		if length != 0 {
+			want = append(want, sha256.Sum256(chunk))
+		}
+		return nil
+	})
+
+	i := 0
+	var next uint64
+	err := Leaves(store, root, func(offset, length uint64, digest [DigestSize]byte) error {
+		if offset != next {
+			t.Fatalf("leaf %d at %d, want %d", i, offset, next)
+		}
+		if i >= len(want) || digest != want[i] {
+			t.Fatalf("leaf %d does not match the chunker", i)
+		}
+		next += length
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Leaves: %v", err)
+	}
+	if i != len(want) || next != uint64(len(data)) {
+		t.Fatalf("walked %d leaves/%d bytes, want %d/%d", i, next, len(want), len(data))
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	data := randomData(2, 4<<20)
+	store := NewMemoryStore()
+	a := build(t, store, data)
+	b := build(t, store, data)
+	if a != b {
+		t.Fatalf("same input built different roots")
+	}
+	changes, err := Diff(store, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 0 || len(changes.Removed) != 0 {
+		t.Fatalf("identical trees reported changes: %+v", changes)
+	}
+}
+
+// TestDiffLocalEdit checks that a small edit only adds a handful of nodes to
+// the store and that Diff reports a small range around the edit.
+func TestDiffLocalEdit(t *testing.T) {
+	orig := randomData(3, 8<<20)
+	pos := len(orig) / 3
+	edited := append(append(append([]byte(nil), orig[:pos]...), []byte("hello")...), orig[pos:]...)
+
+	store := NewMemoryStore()
+	a := build(t, store, orig)
+	before := store.Len()
+	b := build(t, store, edited)
+
+	// Only the path from the edited leaf to the root is rewritten.
+	if added := store.Len() - before; added > 2*(b.Level+1) {
+		t.Fatalf("edit added %d nodes for a tree of height %d", added, b.Level+1)
+	}
+
+	changes, err := Diff(store, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) == 0 || len(changes.Removed) == 0 {
+		t.Fatalf("expected changes, got %+v", changes)
+	}
+	if changes.AddedBytes() > 4*64*1024 {
+		t.Fatalf("diff reports %d added bytes for a 5-byte insertion", changes.AddedBytes())
+	}
+	r := changes.Added[0]
+	if uint64(pos) < r.Offset || uint64(pos) >= r.Offset+r.Length {
+		t.Fatalf("added range %+v does not cover the edit at %d", r, pos)
+	}
+}
+
+func TestDiffDifferentHeights(t *testing.T) {
+	small := randomData(4, 64*1024)
+	large := append(append([]byte(nil), small...), randomData(5, 8<<20)...)
+
+	store := NewMemoryStore()
+	a := build(t, store, small)
+	b := build(t, store, large)
+	changes, err := Diff(store, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.AddedBytes() < uint64(len(large)-len(small)) {
+		t.Fatalf("added %d bytes, want at least %d", changes.AddedBytes(), len(large)-len(small))
+	}
+
+	changes, err = Diff(store, Root{}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.AddedBytes() != uint64(len(large)) || len(changes.Added) != 1 {
+		t.Fatalf("diff against the empty tree: %+v", changes)
+	}
+}
+
+func TestNodeEncoding(t *testing.T) {
+	node := &Node{Level: 3, Entries: []Entry{
+		{Digest: sha256.Sum256([]byte("a")), Length: 1},
+		{Digest: sha256.Sum256([]byte("b")), Length: 1 << 40},
+	}}
+	data, err := node.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Node
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got.Level != node.Level || len(got.Entries) != 2 || got.Entries[1] != node.Entries[1] {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+	if err := got.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated node decoded without error")
+	}
+}
+
+func TestEmptyAndFanout(t *testing.T) {
+	store := NewMemoryStore()
+	if root := build(t, store, nil); !root.IsEmpty() {
+		t.Fatalf("empty input built a non-empty root: %+v", root)
+	}
+	if _, err := NewBuilder(store, 3); err != ErrFanout {
+		t.Fatalf("fanout 3: want ErrFanout, got %v", err)
+	}
+}
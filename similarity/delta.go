@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package similarity
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A delta is the target length followed by a sequence of xdelta-style
+// instructions, each an opcode byte and uvarint arguments:
+//
+//	opInsert len  <len literal bytes>
+//	opCopy   offset len              (copy len bytes from base[offset:])
+const (
+	opInsert = 0
+	opCopy   = 1
+)
+
+const (
+	// blockSize is the shortest match Encode looks for. Matches are extended
+	// in both directions once found, so this only bounds what can start one.
+	blockSize = 16
+
+	// indexStep is the stride at which base blocks are indexed. Any match
+	// of at least blockSize+indexStep-1 bytes is still found, at a quarter
+	// of the index size.
+	indexStep = 4
+)
+
+var ErrCorruptDelta = errors.New("corrupt delta")
+
+func blockHash(b []byte) uint64 {
+	lo := binary.LittleEndian.Uint64(b)
+	hi := binary.LittleEndian.Uint64(b[8:])
+	return (lo*0x9e3779b97f4a7c15 ^ hi) * 0xbf58476d1ce4e5b9
+}
+
+// Encode returns a delta that rebuilds target from base. It is worth storing
+// instead of target only when it is smaller, which the caller decides.
+func Encode(base, target []byte) []byte {
+	delta := binary.AppendUvarint(nil, uint64(len(target)))
+
+	index := make(map[uint64]int, len(base)/indexStep+1)
+	for i := 0; i+blockSize <= len(base); i += indexStep {
+		h := blockHash(base[i:])
+		if _, ok := index[h]; !ok {
+			index[h] = i
+		}
+	}
+
+	literal := 0
+	for i := 0; i+blockSize <= len(target); {
+		off, ok := index[blockHash(target[i:])]
+		if !ok || string(base[off:off+blockSize]) != string(target[i:i+blockSize]) {
+			i++
+			continue
+		}
+
+		// Extend backwards into the pending literal, then forwards.
+		start, bstart := i, off
+		for start > literal && bstart > 0 && target[start-1] == base[bstart-1] {
+			start--
+			bstart--
+		}
+		end, bend := i+blockSize, off+blockSize
+		for end < len(target) && bend < len(base) && target[end] == base[bend] {
+			end++
+			bend++
+		}
+
+		delta = appendInsert(delta, target[literal:start])
+		delta = append(delta, opCopy)
+		delta = binary.AppendUvarint(delta, uint64(bstart))
+		delta = binary.AppendUvarint(delta, uint64(end-start))
+		i, literal = end, end
+	}
+	return appendInsert(delta, target[literal:])
+}
+
+func appendInsert(delta, literal []byte) []byte {
+	if len(literal) == 0 {
+		return delta
+	}
+	delta = append(delta, opInsert)
+	delta = binary.AppendUvarint(delta, uint64(len(literal)))
+	return append(delta, literal...)
+}
+
+// Decode rebuilds the target a delta was encoded from, given the same base.
+func Decode(base, delta []byte) ([]byte, error) {
+	size, k := binary.Uvarint(delta)
+	if k <= 0 {
+		return nil, ErrCorruptDelta
+	}
+	delta = delta[k:]
+	// Do not trust size for the allocation beyond what the delta could
+	// possibly expand to.
+	out := make([]byte, 0, min(size, uint64(len(base)+len(delta))*2))
+
+	for len(delta) != 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch op {
+		case opInsert:
+			n, k := binary.Uvarint(delta)
+			if k <= 0 || n > uint64(len(delta)-k) {
+				return nil, ErrCorruptDelta
+			}
+			delta = delta[k:]
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+		case opCopy:
+			off, k := binary.Uvarint(delta)
+			if k <= 0 {
+				return nil, ErrCorruptDelta
+			}
+			delta = delta[k:]
+			n, k := binary.Uvarint(delta)
+			if k <= 0 || off > uint64(len(base)) || n > uint64(len(base))-off {
+				return nil, ErrCorruptDelta
+			}
+			delta = delta[k:]
+			out = append(out, base[off:off+n]...)
+		default:
+			return nil, ErrCorruptDelta
+		}
+	}
+	if uint64(len(out)) != size {
+		return nil, ErrCorruptDelta
+	}
+	return out, nil
+}
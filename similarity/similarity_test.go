@@ -0,0 +1,110 @@
+package similarity
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomChunk(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+// mutate flips a few bytes at random positions, the near-duplicate case CDC
+// cannot dedup.
+func mutate(chunk []byte, edits int, seed int64) []byte {
+	r := rand.New(rand.NewSource(seed))
+	out := append([]byte(nil), chunk...)
+	for i := 0; i < edits; i++ {
+		out[r.Intn(len(out))] ^= 0xff
+	}
+	return out
+}
+
+func TestSketchSimilar(t *testing.T) {
+	for _, method := range []Method{Broder, Finesse} {
+		opts := DefaultOptions()
+		opts.Method = method
+
+		base := randomChunk(1, 8192)
+		similar := mutate(base, 2, 2)
+		unrelated := randomChunk(3, 8192)
+
+		ix := NewIndex()
+		sb, err := NewSketch(opts, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix.Add([32]byte{1}, sb)
+
+		ss, _ := NewSketch(opts, similar)
+		if id, matches, ok := ix.Lookup(ss); !ok || id != ([32]byte{1}) || matches == 0 {
+			t.Fatalf("%s: near-duplicate chunk not detected", method)
+		}
+		su, _ := NewSketch(opts, unrelated)
+		if _, _, ok := ix.Lookup(su); ok {
+			t.Fatalf("%s: unrelated chunk reported as similar", method)
+		}
+	}
+}
+
+func TestSketchDeterministic(t *testing.T) {
+	chunk := randomChunk(4, 4096)
+	a, _ := NewSketch(DefaultOptions(), chunk)
+	b, _ := NewSketch(DefaultOptions(), chunk)
+	if len(a) != 3 {
+		t.Fatalf("expected 3 super-features, got %d", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("sketch is not deterministic")
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if _, err := NewSketch(&Options{Method: Broder, Features: 10, SuperFeatures: 3}, nil); err != ErrFeatures {
+		t.Fatalf("want ErrFeatures, got %v", err)
+	}
+	if _, err := ParseMethod("nope"); err != ErrMethod {
+		t.Fatalf("want ErrMethod, got %v", err)
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := randomChunk(5, 16384)
+	cases := map[string][]byte{
+		"identical": base,
+		"flips":     mutate(base, 8, 6),
+		"insert":    append(append(append([]byte(nil), base[:5000]...), []byte("inserted")...), base[5000:]...),
+		"unrelated": randomChunk(7, 1000),
+		"empty":     {},
+		"short":     []byte("abc"),
+	}
+	for name, target := range cases {
+		delta := Encode(base, target)
+		got, err := Decode(base, delta)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, target) {
+			t.Fatalf("%s: round trip mismatch", name)
+		}
+	}
+
+	if d := Encode(base, cases["flips"]); len(d) > 512 {
+		t.Fatalf("8 byte flips encoded to a %d byte delta", len(d))
+	}
+}
+
+func TestDeltaCorrupt(t *testing.T) {
+	base := randomChunk(8, 1024)
+	delta := Encode(base, mutate(base, 1, 9))
+	for _, bad := range [][]byte{nil, delta[:len(delta)-1], append(append([]byte(nil), delta...), 0x7f)} {
+		if _, err := Decode(base, bad); err == nil {
+			t.Fatalf("corrupt delta %x decoded without error", bad)
+		}
+	}
+}
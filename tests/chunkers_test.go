@@ -5,7 +5,6 @@ import (
 	crand "crypto/rand"
 	"crypto/sha256"
 	"io"
-	"math/rand"
 	"testing"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
@@ -14,6 +13,7 @@ import (
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/fixed"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/jc"
 	_ "github.com/PlakarKorp/go-cdc-chunkers/chunkers/ultracdc"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
 )
 
 const (
@@ -30,7 +30,7 @@ func (fn writerFunc) Write(p []byte) (int, error) {
 	return fn(p)
 }
 
-var rb, _ = io.ReadAll(io.LimitReader(rand.New(rand.NewSource(0)), datalen))
+var rb, _ = corpus.Bytes(corpus.Random, datalen, 0)
 
 func Test_LegacyFastCDC_Next(t *testing.T) {
 	r := bytes.NewReader(rb)
@@ -2052,3 +2052,16 @@ func Benchmark_PlakarKorp_Fixed_4MiB_Next(b *testing.B) {
 	}
 	b.ReportMetric(float64(nchunks)/float64(b.N), "chunks")
 }
+
+func Test_ValidateOptions(t *testing.T) {
+	if err := chunkers.ValidateOptions("kfastcdc", nil); err == nil {
+		t.Fatal("kfastcdc validated without a key")
+	}
+	if err := chunkers.ValidateOptions("kfastcdc", &chunkers.ChunkerOpts{Key: make([]byte, 32)}); err != nil {
+		t.Fatalf("kfastcdc refused a key: %v", err)
+	}
+	opts := &chunkers.ChunkerOpts{MinSize: 12 << 10, NormalSize: 48 << 10, MaxSize: 192 << 10}
+	if err := chunkers.ValidateOptions("fastcdc", opts); err == nil {
+		t.Fatal("fastcdc validated a NormalSize that is not a power of two")
+	}
+}
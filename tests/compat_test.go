@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"sort"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
+	"github.com/PlakarKorp/go-cdc-chunkers/internal/keyflag"
+)
+
+// compatRecord records the compatibility cases the corpus lacks, and leaves
+// every recorded one as it is:
+//
+//	go test ./tests/ -run TestCompat -compat-record
+//
+// It is run from the change that adds an algorithm, a version or an option
+// set. Unlike -update for the goldens, it never rewrites a fingerprint: a
+// drift fails the recording too.
+var compatRecord = flag.Bool("compat-record", false, "record missing compatibility cases")
+
+const compatFile = "testdata/compat.json"
+
+const compatVersion = 1
+
+// compatCorpus holds the fingerprints of every case, produced through the
+// public NewChunker path when the case was recorded. Every registered name
+// must reproduce them forever: stored chunks are looked up by the digests of
+// those cut points. The corpus was first recorded from this tree, not from
+// the tags before it, so it pins the cut points from then on; that they
+// match the older releases is for the goldens to hold.
+type compatCorpus struct {
+	Version int                    `json:"compat"`
+	Cases   map[string]compatPrint `json:"cases"`
+}
+
+// compatPrint is a fingerprint without the content digest: the inputs are
+// regenerated from fixed seeds, and reconstruction is checked directly.
+type compatPrint struct {
+	Chunks   int    `json:"chunks"`
+	CutsHash string `json:"cuts_hash"`
+}
+
+// compatSizes are the option sets recorded for every algorithm that accepts
+// them. The equal triples are there for fixed-size chunking.
+var compatSizes = []sizeProfile{
+	{name: "2K-8K-64K", min: 2 << 10, normal: 8 << 10, max: 64 << 10},
+	{name: "4K-16K-64K", min: 4 << 10, normal: 16 << 10, max: 64 << 10},
+	{name: "16K-64K-256K", min: 16 << 10, normal: 64 << 10, max: 256 << 10},
+	{name: "64K-256K-1M", min: 64 << 10, normal: 256 << 10, max: 1 << 20},
+	{name: "4K-4K-4K", min: 4 << 10, normal: 4 << 10, max: 4 << 10},
+	{name: "64K-64K-64K", min: 64 << 10, normal: 64 << 10, max: 64 << 10},
+}
+
+// compatInputs are the corpus kinds recorded, each 2 MiB from seed 1.
+var compatInputs = []corpus.Kind{corpus.Random, corpus.Text, corpus.LowEntropy, corpus.VMImage}
+
+// compatCase is one algorithm, option set and input the current code can
+// chunk.
+type compatCase struct {
+	name string
+	algo string
+	opts *chunkers.ChunkerOpts
+	kind corpus.Kind
+}
+
+// compatCases lists every registered algorithm over every option set it
+// validates, keyed algorithms taking the fixed key.
+func compatCases(t *testing.T) []compatCase {
+	t.Helper()
+	var cases []compatCase
+	for _, algo := range chunkers.Algorithms() {
+		n := len(cases)
+		for _, sp := range compatSizes {
+			opts, err := keyflag.Resolve(algo, optsFor(algoParams{name: algo}, sp), fixedKey)
+			if err != nil {
+				continue
+			}
+			for _, kind := range compatInputs {
+				cases = append(cases, compatCase{name: caseName(algo, sp.name, string(kind)), algo: algo, opts: opts, kind: kind})
+			}
+		}
+		if len(cases) == n {
+			t.Errorf(`%s: accepts none of the compatibility option sets`, algo)
+		}
+	}
+	return cases
+}
+
+func compatRun(t *testing.T, c compatCase, data []byte) compatPrint {
+	t.Helper()
+	ch, err := chunkers.NewChunker(c.algo, bytes.NewReader(data), c.opts)
+	if err != nil {
+		t.Fatalf(`%s: %s`, c.name, err)
+	}
+	lengths, all, err := collectNext(ch)
+	if err != nil {
+		t.Fatalf(`%s: %s`, c.name, err)
+	}
+	if !bytes.Equal(all, data) {
+		t.Fatalf(`%s: reconstruction != input (got %d want %d)`, c.name, len(all), len(data))
+	}
+	fp := fingerprintFrom(lengths, all)
+	return compatPrint{Chunks: fp.Chunks, CutsHash: fp.CutsHash}
+}
+
+// TestCompat checks the current code reproduces every recorded fingerprint,
+// and that every case it can run is recorded, so that a
+// new algorithm version fails until its fingerprints are in the corpus.
+func TestCompat(t *testing.T) {
+	cc := loadCompat(t)
+
+	inputs := make(map[corpus.Kind][]byte)
+	for _, kind := range compatInputs {
+		data, err := corpus.Bytes(kind, 2<<20, 1)
+		if err != nil {
+			t.Fatalf(`corpus %s: %s`, kind, err)
+		}
+		inputs[kind] = data
+	}
+
+	got := make(map[string]compatPrint)
+	for _, c := range compatCases(t) {
+		got[c.name] = compatRun(t, c, inputs[c.kind])
+	}
+
+	names := make([]string, 0, len(cc.Cases))
+	for n := range cc.Cases {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		w := cc.Cases[n]
+		g, ok := got[n]
+		if !ok {
+			t.Errorf(`%s: recorded, no longer registered or accepted`, n)
+			continue
+		}
+		if w != g {
+			t.Errorf("%s: differs from the recorded fingerprint\n  want %+v\n  got  %+v", n, w, g)
+		}
+	}
+
+	var missing []string
+	for n := range got {
+		if _, ok := cc.Cases[n]; !ok {
+			missing = append(missing, n)
+		}
+	}
+	sort.Strings(missing)
+
+	if !*compatRecord {
+		for _, n := range missing {
+			t.Errorf(`%s: not recorded (record with -compat-record)`, n)
+		}
+		return
+	}
+	if t.Failed() {
+		t.Fatal(`not recording over failing cases`)
+	}
+	if len(missing) == 0 {
+		t.Log("nothing to record")
+		return
+	}
+	for _, n := range missing {
+		cc.Cases[n] = got[n]
+	}
+	buf, err := json.MarshalIndent(cc, "", "  ")
+	if err != nil {
+		t.Fatalf(`marshal compat: %s`, err)
+	}
+	if err := os.WriteFile(compatFile, append(buf, '\n'), 0o644); err != nil {
+		t.Fatalf(`write compat: %s`, err)
+	}
+	t.Logf("recorded %d cases in %s", len(missing), compatFile)
+}
+
+func loadCompat(t *testing.T) *compatCorpus {
+	t.Helper()
+	buf, err := os.ReadFile(compatFile)
+	if os.IsNotExist(err) && *compatRecord {
+		return &compatCorpus{Version: compatVersion, Cases: make(map[string]compatPrint)}
+	}
+	if err != nil {
+		t.Fatalf(`read compat: %s`, err)
+	}
+	var cc compatCorpus
+	if err := json.Unmarshal(buf, &cc); err != nil {
+		t.Fatalf(`unmarshal compat: %s`, err)
+	}
+	if cc.Version != compatVersion {
+		t.Fatalf(`compat corpus version %d, want %d`, cc.Version, compatVersion)
+	}
+	return &cc
+}
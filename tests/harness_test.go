@@ -19,9 +19,9 @@ package tests
 import (
 	"bytes"
 	"io"
-	"math/rand"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+	"github.com/PlakarKorp/go-cdc-chunkers/corpus"
 )
 
 // This file is shared scaffolding for the equivalence, golden and fuzz tests.
@@ -99,10 +99,8 @@ type inputShape struct {
 // MaxSize across the size profiles.
 func makeInputs(maxMax int) []inputShape {
 	rnd := func(n int) []byte {
-		b := make([]byte, n)
-		// Fixed seed: goldens must be reproducible across machines.
-		r := rand.New(rand.NewSource(0))
-		r.Read(b)
+		// Seed 0, the rand.NewSource(0) stream the goldens were made from.
+		b, _ := corpus.Bytes(corpus.Random, int64(n), 0)
 		return b
 	}
 	zeros := func(n int) []byte { return make([]byte, n) }
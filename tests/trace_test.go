@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
+)
+
+// TestTraceMatchesAlgorithm holds every AlgorithmTrace to its Algorithm:
+// tracing must explain the cut points, never move them.
+func TestTraceMatchesAlgorithm(t *testing.T) {
+	algos := append(slices.Clone(allAlgorithms),
+		algoParams{name: "jc-v1.1.0"}, algoParams{name: "ultracdc-v1.0.0"}, algoParams{name: "fixed-v1.0.0"})
+	for _, a := range algos {
+		for _, sp := range sizeProfiles[:2] {
+			for _, in := range makeInputs(sp.max) {
+				want, _, err := collectNext(mustChunker(t, a, sp, in.data))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ch := mustChunker(t, a, sp, in.data)
+				var cuts []chunkers.Cut
+				ch.SetTrace(func(c chunkers.Cut) { cuts = append(cuts, c) })
+				got, _, err := collectNext(ch)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				name := a.name + "/" + sp.name + "/" + in.name
+				if !slices.Equal(got, want) {
+					t.Fatalf("%s: tracing changed the cut points", name)
+				}
+				var offset uint64
+				for i, c := range cuts {
+					if c.Length == 0 {
+						continue // the empty stream
+					}
+					if c.Offset != offset || c.Length != got[i] {
+						t.Fatalf("%s: cut %d at %d+%d, want %d+%d", name, i, c.Offset, c.Length, offset, got[i])
+					}
+					offset += uint64(c.Length)
+					last := i == len(got)-1
+					switch {
+					case c.Reason == chunkers.CutEndOfStream && !last:
+						t.Fatalf("%s: end-of-stream cut %d before the last chunk", name, i)
+					case c.Reason == chunkers.CutMaxSize && c.Length != ch.MaxSize():
+						t.Fatalf("%s: max-size cut %d of %d bytes", name, i, c.Length)
+					case c.Reason == chunkers.CutUnknown:
+						t.Fatalf("%s: cut %d has no reason", name, i)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTraceReasons(t *testing.T) {
+	sp := sizeProfiles[0]
+	inputs := makeInputs(sp.max)
+	reasons := func(algo string, data []byte) map[chunkers.CutReason]int {
+		ch := mustChunker(t, algoParams{name: algo}, sp, data)
+		seen := make(map[chunkers.CutReason]int)
+		ch.SetTrace(func(c chunkers.Cut) { seen[c.Reason]++ })
+		if _, _, err := collectNext(ch); err != nil {
+			t.Fatal(err)
+		}
+		return seen
+	}
+	random, zeros := inputs[3].data, inputs[4].data
+
+	if r := reasons("fastcdc-v1.0.0", random); r[chunkers.CutMaskS]+r[chunkers.CutMaskL] == 0 || r[chunkers.CutEndOfStream] != 1 {
+		t.Fatalf("fastcdc on random data: %v", r)
+	}
+	if r := reasons("fastcdc-v1.0.0", zeros); r[chunkers.CutMaxSize] == 0 {
+		t.Fatalf("fastcdc on zeros: %v", r)
+	}
+	if r := reasons("ultracdc", zeros); r[chunkers.CutLowEntropy] == 0 {
+		t.Fatalf("ultracdc on zeros: %v", r)
+	}
+	if r := reasons("jc-v1.1.0", random); r[chunkers.CutMask] == 0 {
+		t.Fatalf("jc on random data: %v", r)
+	}
+	if r := reasons("fixed-v1.0.0", random); r[chunkers.CutMaxSize] == 0 {
+		t.Fatalf("fixed on random data: %v", r)
+	}
+}
+
+func mustChunker(t *testing.T, a algoParams, sp sizeProfile, data []byte) *chunkers.Chunker {
+	t.Helper()
+	ch, err := newBufioChunker(a.name, data, optsFor(a, sp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
@@ -0,0 +1,121 @@
+package chunkers
+
+/*
+ * Copyright (c) 2026 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// CutReason tells why a chunker cut where it did.
+type CutReason int
+
+const (
+	// CutUnknown is reported for content-defined cuts of implementations
+	// that do not implement Tracer.
+	CutUnknown CutReason = iota
+	// CutMask: the fingerprint matched the cut mask.
+	CutMask
+	// CutMaskS: the fingerprint matched the strict mask used below
+	// NormalSize (normalized chunking).
+	CutMaskS
+	// CutMaskL: the fingerprint matched the loose mask used past NormalSize.
+	CutMaskL
+	// CutLowEntropy: a run of repeated content reached the low-entropy
+	// threshold (UltraCDC).
+	CutLowEntropy
+	// CutRegression: no cut before MaxSize, so the best earlier candidate
+	// was taken (FastCDC4Stadia's regression).
+	CutRegression
+	// CutMaxSize: no cut before MaxSize, which forced one.
+	CutMaxSize
+	// CutEndOfStream: the data ran out before any cut.
+	CutEndOfStream
+	// CutHint: a boundary hint forced the cut.
+	CutHint
+)
+
+var cutReasonNames = []string{"unknown", "mask", "maskS", "maskL", "low-entropy", "regression", "max-size", "end-of-stream", "hint"}
+
+func (r CutReason) String() string {
+	if r < 0 || int(r) >= len(cutReasonNames) {
+		return "invalid"
+	}
+	return cutReasonNames[r]
+}
+
+// Cut describes one cut point, as reported to the function set with
+// SetTrace.
+type Cut struct {
+	Offset uint64 // stream offset of the chunk
+	Length int
+	Reason CutReason
+
+	// Fingerprint is the rolling value the algorithm tested at the cut
+	// (for UltraCDC, the Hamming distance of its window), 0 when it has
+	// none.
+	Fingerprint uint64
+
+	// Jumps is the number of jumps taken while scanning the chunk (JC).
+	Jumps int
+}
+
+// Tracer is implemented by ChunkerImplementations that can explain their cut
+// points. AlgorithmTrace must return the same cut point as Algorithm for the
+// same input; it is only called while a trace function is set, so Algorithm
+// stays free of any tracing cost.
+//
+// An implementation that finds no content-defined cut in the segment reports
+// CutMaxSize: the chunker turns it into CutEndOfStream or CutHint when the
+// segment was cut short by the end of the stream or by a boundary hint.
+type Tracer interface {
+	AlgorithmTrace(*ChunkerOpts, []byte, int) (int, Cut)
+}
+
+// SetTrace makes Next call fn with the reason of every cut point, before
+// returning the chunk. Implementations that do not implement Tracer report
+// their content-defined cuts as CutUnknown. A nil fn stops tracing.
+func (chunker *Chunker) SetTrace(fn func(Cut)) {
+	chunker.trace = fn
+}
+
+// algorithm runs the implementation over segment[:n], the data from base in
+// the current window, and reports the cut to the trace function if one is
+// set. atHint tells the segment ends at a boundary hint.
+func (chunker *Chunker) algorithm(segment []byte, n, base int, atHint bool) int {
+	if chunker.trace == nil {
+		return chunker.implementation.Algorithm(chunker.options, segment, n)
+	}
+
+	var cutpoint int
+	var cut Cut
+	if t, ok := chunker.implementation.(Tracer); ok {
+		cutpoint, cut = t.AlgorithmTrace(chunker.options, segment, n)
+	} else {
+		cutpoint = chunker.implementation.Algorithm(chunker.options, segment, n)
+		if cutpoint == n || base+cutpoint == chunker.options.MaxSize {
+			cut.Reason = CutMaxSize
+		}
+	}
+
+	if cut.Reason == CutMaxSize && base+cutpoint < chunker.options.MaxSize {
+		if atHint && cutpoint == n {
+			cut.Reason = CutHint
+		} else {
+			cut.Reason = CutEndOfStream
+		}
+	}
+	cut.Offset = chunker.offset
+	cut.Length = base + cutpoint
+	chunker.trace(cut)
+	return cutpoint
+}